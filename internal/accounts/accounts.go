@@ -0,0 +1,289 @@
+// accounts.go - management of multiple named accounts
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package accounts manages multiple named accounts sharing the same client configuration.
+// Each account has its own ECDSA key and therefore its own wallet file, with separate
+// long-term secret, credentials and balances.
+package accounts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/nymtech/nym-validator/client/config"
+	"github.com/nymtech/qt-validator-client-demo/internal/keystore"
+	"github.com/nymtech/qt-validator-client-demo/internal/mnemonic"
+	"github.com/nymtech/qt-validator-client-demo/internal/sensitive"
+	"github.com/nymtech/qt-validator-client-demo/internal/wallet"
+)
+
+const (
+	// DefaultAccount is the name of the account using the key file specified in the configuration.
+	DefaultAccount = "default"
+
+	// IndexSuffix is appended to the path of the configured key file to obtain location of the accounts index.
+	IndexSuffix = ".accounts"
+
+	keyFileSuffix = ".key"
+)
+
+var (
+	// ErrUnknownAccount is returned when no account with the given name exists.
+	ErrUnknownAccount = errors.New("no account exists with that name")
+	// ErrAccountExists is returned on attempt to create an account with already used name.
+	ErrAccountExists = errors.New("account with that name already exists")
+
+	validName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+)
+
+// Account describes a single named account.
+type Account struct {
+	Name    string `json:"name"`
+	KeyFile string `json:"keyfile"`
+}
+
+// Address returns the hex encoded address derived from the key of the account.
+func (a Account) Address() (string, error) {
+	address, err := keystore.Address(a.KeyFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to load the key of account %v: %v", a.Name, err)
+	}
+	return address.Hex(), nil
+}
+
+// index is the on-disk list of all accounts. It does not include the default account, which always exists.
+type index struct {
+	Accounts []Account `json:"accounts"`
+}
+
+// Manager keeps track of all the accounts and lazily creates wallets for them.
+// It is safe for concurrent use.
+type Manager struct {
+	sync.Mutex
+
+	cfg       *config.Config
+	indexPath string
+	accounts  []Account
+	wallets   map[string]*wallet.Wallet
+}
+
+// NewManager loads the accounts index located next to the key file specified in the configuration.
+// The index is only created once an additional account is added.
+func NewManager(cfg *config.Config) (*Manager, error) {
+	m := &Manager{
+		cfg:       cfg,
+		indexPath: cfg.Nym.AccountKeysFile + IndexSuffix,
+		accounts:  []Account{{Name: DefaultAccount, KeyFile: cfg.Nym.AccountKeysFile}},
+		wallets:   make(map[string]*wallet.Wallet),
+	}
+
+	raw, err := ioutil.ReadFile(m.indexPath)
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read the accounts index: %v", err)
+	}
+
+	var idx index
+	if err := json.Unmarshal(raw, &idx); err != nil {
+		return nil, fmt.Errorf("malformed accounts index: %v", err)
+	}
+	for _, acc := range idx.Accounts {
+		if acc.Name == DefaultAccount || !validName.MatchString(acc.Name) {
+			return nil, fmt.Errorf("malformed accounts index: invalid account name '%v'", acc.Name)
+		}
+		m.accounts = append(m.accounts, acc)
+	}
+	return m, nil
+}
+
+// save must be called with the lock held.
+func (m *Manager) save() error {
+	idx := index{Accounts: m.accounts[1:]}
+	raw, err := json.MarshalIndent(&idx, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(m.indexPath, raw, 0600)
+}
+
+// find must be called with the lock held.
+func (m *Manager) find(name string) (Account, bool) {
+	for _, acc := range m.accounts {
+		if acc.Name == name {
+			return acc, true
+		}
+	}
+	return Account{}, false
+}
+
+// Accounts returns all the accounts, starting with the default one.
+func (m *Manager) Accounts() []Account {
+	m.Lock()
+	defer m.Unlock()
+
+	accounts := make([]Account, len(m.accounts))
+	copy(accounts, m.accounts)
+	return accounts
+}
+
+// Names returns names of all the accounts, starting with the default one.
+func (m *Manager) Names() []string {
+	m.Lock()
+	defer m.Unlock()
+
+	names := make([]string, len(m.accounts))
+	for i, acc := range m.accounts {
+		names[i] = acc.Name
+	}
+	return names
+}
+
+// Account returns the account with the given name.
+func (m *Manager) Account(name string) (Account, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	acc, ok := m.find(name)
+	if !ok {
+		return Account{}, ErrUnknownAccount
+	}
+	return acc, nil
+}
+
+// Add creates new account with a key derived from a fresh seed phrase, which is returned alongside the account.
+// The key is stored next to the key of the default account.
+func (m *Manager) Add(name string) (Account, string, error) {
+	if !validName.MatchString(name) {
+		return Account{}, "", errors.New("account name must consist of 1 to 32 letters, digits, '-' or '_'")
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if _, ok := m.find(name); ok || name == DefaultAccount {
+		return Account{}, "", ErrAccountExists
+	}
+
+	acc := Account{
+		Name:    name,
+		KeyFile: filepath.Join(filepath.Dir(m.cfg.Nym.AccountKeysFile), name+keyFileSuffix),
+	}
+	phrase, err := mnemonic.New()
+	if err != nil {
+		return Account{}, "", fmt.Errorf("could not generate a seed phrase: %v", err)
+	}
+	seed, err := mnemonic.ToSeed(phrase)
+	if err != nil {
+		return Account{}, "", err
+	}
+	defer seed.Wipe()
+	privateKey, err := seed.AccountKey()
+	if err != nil {
+		return Account{}, "", err
+	}
+	defer sensitive.WipeKey(privateKey)
+	if err := keystore.SaveNew(acc.KeyFile, privateKey); err != nil {
+		if err == keystore.ErrKeyFileExists {
+			return Account{}, "", fmt.Errorf("key file %v already exists", acc.KeyFile)
+		}
+		return Account{}, "", err
+	}
+
+	m.accounts = append(m.accounts, acc)
+	if err := m.save(); err != nil {
+		m.accounts = m.accounts[:len(m.accounts)-1]
+		return Account{}, "", fmt.Errorf("could not save the accounts index: %v", err)
+	}
+	return acc, phrase, nil
+}
+
+// Config returns copy of the client configuration using the key of the account.
+func (m *Manager) Config(name string) (*config.Config, error) {
+	acc, err := m.Account(name)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := *m.cfg
+	nymCfg := *m.cfg.Nym
+	nymCfg.AccountKeysFile = acc.KeyFile
+	cfg.Nym = &nymCfg
+	return &cfg, nil
+}
+
+// LoadedWallet returns the wallet of the account if it was already created.
+func (m *Manager) LoadedWallet(name string) (*wallet.Wallet, bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	w, ok := m.wallets[name]
+	return w, ok
+}
+
+// Wallet returns the wallet of the account, creating it on the first call, which is indicated by the second return value.
+// The passphrase is needed to create the wallet if the account key is encrypted, otherwise it is ignored.
+// Events of a newly created wallet must be consumed by the caller and the wallet still needs to be opened.
+func (m *Manager) Wallet(name, keyPassphrase string) (*wallet.Wallet, bool, error) {
+	cfg, err := m.Config(name)
+	if err != nil {
+		return nil, false, err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if w, ok := m.wallets[name]; ok {
+		return w, false, nil
+	}
+
+	w, err := wallet.New(cfg, keyPassphrase)
+	if err != nil {
+		return nil, false, fmt.Errorf("could not use the config to create client instance: %v", err)
+	}
+	m.wallets[name] = w
+	return w, true, nil
+}
+
+// LockWallets wipes and closes all the created wallets and forgets them, so that they would have to be
+// created and opened with the passphrase again. None of the wallets may be in use.
+func (m *Manager) LockWallets() {
+	m.Lock()
+	defer m.Unlock()
+
+	for name, w := range m.wallets {
+		w.Wipe()
+		w.Close()
+		delete(m.wallets, name)
+	}
+}
+
+// WipeWallets wipes the secrets of all the created wallets, for example when the application exits,
+// without closing the wallets. Any operations still in progress will fail.
+func (m *Manager) WipeWallets() {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, w := range m.wallets {
+		w.Wipe()
+	}
+}
@@ -0,0 +1,198 @@
+// backup.go - encrypted bundle of everything needed to move the wallet to another machine
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package backup exports and restores a single passphrase-encrypted bundle containing the client config,
+// the account key, the long-term secret, all the credentials and the transaction ledger of a wallet.
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nymtech/nym-validator/client/config"
+	"github.com/nymtech/qt-validator-client-demo/internal/keystore"
+	"github.com/nymtech/qt-validator-client-demo/internal/sensitive"
+	"github.com/nymtech/qt-validator-client-demo/internal/storage"
+	"github.com/nymtech/qt-validator-client-demo/internal/wallet"
+)
+
+const bundleVersion = 1
+
+// Bundle is the plaintext content of the backup file.
+type Bundle struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	// Config is the raw content of the client config file.
+	Config []byte `json:"config"`
+	// Key is the raw content of the account key file, which might be encrypted on its own.
+	Key    []byte           `json:"key"`
+	Wallet storage.Snapshot `json:"wallet"`
+}
+
+// Export writes the bundle of the wallet, encrypted with its passphrase, to the path.
+// The config file is the one the wallet was created from. An existing file is never overwritten.
+// An encrypted account key must be protected by the passphrase of the wallet, as Restore uses the passphrase
+// of the bundle for both; Export refuses to write a bundle that could not be restored.
+func Export(path, configFile string, w *wallet.Wallet, passphrase string) error {
+	cfgRaw, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return fmt.Errorf("could not read the config file: %v", err)
+	}
+	keyFile := w.Config().Nym.AccountKeysFile
+	keyRaw, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return fmt.Errorf("could not read the account key: %v", err)
+	}
+	snapshot, err := w.Snapshot(passphrase)
+	if err != nil {
+		return err
+	}
+	key, err := keystore.Load(keyFile, passphrase)
+	if err != nil {
+		if err == keystore.ErrInvalidPassphrase {
+			return errors.New("the account key is protected by a different passphrase than the wallet")
+		}
+		return fmt.Errorf("could not load the account key: %v", err)
+	}
+	sensitive.WipeKey(key)
+
+	plaintext, err := json.Marshal(&Bundle{
+		Version: bundleVersion,
+		Created: time.Now(),
+		Config:  cfgRaw,
+		Key:     keyRaw,
+		Wallet:  snapshot,
+	})
+	if err != nil {
+		return err
+	}
+	sealed, err := storage.Seal(plaintext, []byte(passphrase))
+	if err != nil {
+		return fmt.Errorf("could not encrypt the backup: %v", err)
+	}
+	if err := writeNew(path, sealed); err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("%v already exists and will not be overwritten", path)
+		}
+		return fmt.Errorf("could not write the backup: %v", err)
+	}
+	return nil
+}
+
+// writeNew creates the file with the given content, failing if it already exists.
+// The file is removed if its content could not be written in full.
+func writeNew(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// mkdirAll creates the directory along with any missing parents and returns the created ones, outermost first.
+func mkdirAll(dir string) ([]string, error) {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil || d == filepath.Dir(d) {
+			break
+		}
+		missing = append([]string{d}, missing...)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return missing, nil
+}
+
+// Restore decrypts the bundle and recreates the config file at configPath, followed by the key file and the wallet
+// at the locations specified by the config. The restored wallet is protected by the same passphrase as the bundle,
+// which must also decrypt the account key if the latter is encrypted.
+// None of the files may already exist; if any step fails, all the files created so far are removed.
+func Restore(bundlePath, configPath, passphrase string) (cfg *config.Config, err error) {
+	raw, err := ioutil.ReadFile(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := storage.Unseal(raw, []byte(passphrase))
+	if err != nil {
+		if err == storage.ErrInvalidPassphrase {
+			return nil, errors.New("could not decrypt the backup - invalid passphrase?")
+		}
+		return nil, fmt.Errorf("invalid backup file: %v", err)
+	}
+
+	var bundle Bundle
+	if err := json.Unmarshal(plaintext, &bundle); err != nil {
+		return nil, fmt.Errorf("malformed backup: %v", err)
+	}
+	if bundle.Version != bundleVersion {
+		return nil, fmt.Errorf("unsupported backup version %v", bundle.Version)
+	}
+
+	// the files and directories are removed in the reverse order of their creation
+	var created []string
+	defer func() {
+		if err != nil {
+			for i := len(created) - 1; i >= 0; i-- {
+				os.Remove(created[i])
+			}
+		}
+	}()
+
+	if err := writeNew(configPath, bundle.Config); err != nil {
+		return nil, fmt.Errorf("could not restore the config file: %v", err)
+	}
+	created = append(created, configPath)
+	if cfg, err = config.LoadFile(configPath); err != nil {
+		return nil, fmt.Errorf("the restored config is invalid: %v", err)
+	}
+
+	keyFile := cfg.Nym.AccountKeysFile
+	dirs, err := mkdirAll(filepath.Dir(keyFile))
+	if err != nil {
+		return nil, fmt.Errorf("could not create the directory of the account key: %v", err)
+	}
+	created = append(created, dirs...)
+	if err := writeNew(keyFile, bundle.Key); err != nil {
+		return nil, fmt.Errorf("could not restore the account key: %v", err)
+	}
+	created = append(created, keyFile)
+	if _, err := keystore.Load(keyFile, passphrase); err != nil {
+		return nil, fmt.Errorf("the restored account key is invalid: %v", err)
+	}
+
+	walletFile := keyFile + wallet.WalletFileSuffix
+	store, err := storage.Create(walletFile, []byte(passphrase), bundle.Wallet)
+	if err != nil {
+		return nil, fmt.Errorf("could not restore the wallet: %v", err)
+	}
+	// the wallet gets opened again by its user, this instance only wipes its key
+	store.Close()
+	created = append(created, walletFile)
+	return cfg, nil
+}
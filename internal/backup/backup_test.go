@@ -0,0 +1,268 @@
+// backup_test.go - tests of the wallet backups
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/nymtech/nym-validator/client/config"
+	"github.com/nymtech/qt-validator-client-demo/internal/keystore"
+	"github.com/nymtech/qt-validator-client-demo/internal/storage"
+	"github.com/nymtech/qt-validator-client-demo/internal/wallet"
+	"github.com/nymtech/qt-validator-client-demo/internal/wallet/fake"
+)
+
+const testPassphrase = "correct horse battery staple"
+
+// testWallet is a wallet backed by the fake client, whose config and encrypted account key are kept in dir.
+type testWallet struct {
+	*wallet.Wallet
+	client  *fake.Client
+	dir     string
+	cfgFile string
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "nym-backup-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func startWallet(t *testing.T, cfgFile string, client *fake.Client) *wallet.Wallet {
+	cfg, err := config.LoadFile(cfgFile)
+	if err != nil {
+		t.Fatalf("could not load the config: %v", err)
+	}
+	w := wallet.NewWithClient(cfg, client)
+	go func() {
+		for range w.Events() {
+		}
+	}()
+	return w
+}
+
+// newTestWallet creates the wallet holding a long-term secret and a single credential. The account key
+// is encrypted with the given passphrase.
+func newTestWallet(t *testing.T, keyPassphrase string) *testWallet {
+	dir := tempDir(t)
+	cfgFile, err := fake.WriteConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ethcrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keystore.SaveEncrypted(filepath.Join(dir, "account.key"), key, keyPassphrase); err != nil {
+		t.Fatal(err)
+	}
+
+	client := fake.NewClient(0)
+	client.SetBalances(0, 0, 100)
+	client.SetAccountExists(true)
+	w := startWallet(t, cfgFile, client)
+	if err := w.CreateStore(testPassphrase); err != nil {
+		t.Fatalf("could not create the wallet: %v", err)
+	}
+	if err := w.GenerateSecret(); err != nil {
+		t.Fatalf("could not generate the long-term secret: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := w.GetCredential(ctx, w.AllowedValues()[0]); err != nil {
+		t.Fatalf("could not obtain the credential: %v", err)
+	}
+	return &testWallet{Wallet: w, client: client, dir: dir, cfgFile: cfgFile}
+}
+
+func (tw *testWallet) close() {
+	tw.Wipe()
+	tw.Close()
+	os.RemoveAll(tw.dir)
+}
+
+// expectEmpty checks that the directory exists and that nothing was left behind in it.
+func expectEmpty(t *testing.T, dir string) {
+	t.Helper()
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		names := make([]string, len(files))
+		for i, f := range files {
+			names[i] = f.Name()
+		}
+		t.Fatalf("expected no files, got %v", names)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	w := newTestWallet(t, testPassphrase)
+	defer os.RemoveAll(w.dir)
+
+	secret, err := w.ExportSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentials := w.Credentials()
+	keyFile := w.Config().Nym.AccountKeysFile
+	address, err := keystore.Address(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bundlePath := filepath.Join(w.dir, "wallet.backup")
+	if err := Export(bundlePath, w.cfgFile, w.Wallet, testPassphrase); err != nil {
+		t.Fatalf("could not export the wallet: %v", err)
+	}
+
+	// the files are removed as if the bundle was moved to another machine
+	w.Wipe()
+	w.Close()
+	for _, f := range []string{w.cfgFile, keyFile, keyFile + wallet.WalletFileSuffix} {
+		if err := os.Remove(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := Restore(bundlePath, w.cfgFile, "wrong passphrase"); err == nil {
+		t.Fatal("restored the backup with an invalid passphrase")
+	}
+	if _, err := os.Lstat(w.cfgFile); !os.IsNotExist(err) {
+		t.Fatalf("the config was restored with an invalid passphrase: %v", err)
+	}
+
+	cfg, err := Restore(bundlePath, w.cfgFile, testPassphrase)
+	if err != nil {
+		t.Fatalf("could not restore the wallet: %v", err)
+	}
+	if cfg.Nym.AccountKeysFile != keyFile {
+		t.Fatalf("expected the account key at %v, got %v", keyFile, cfg.Nym.AccountKeysFile)
+	}
+	if restored, err := keystore.Address(keyFile); err != nil || restored != address {
+		t.Fatalf("expected the account %v, got %v (%v)", address.Hex(), restored.Hex(), err)
+	}
+	if _, err := keystore.Load(keyFile, testPassphrase); err != nil {
+		t.Fatalf("could not load the restored account key: %v", err)
+	}
+
+	restored := startWallet(t, w.cfgFile, w.client)
+	defer restored.Close()
+	if err := restored.OpenStore(testPassphrase); err != nil {
+		t.Fatalf("could not open the restored wallet: %v", err)
+	}
+	defer restored.Wipe()
+	if restoredSecret, err := restored.ExportSecret(); err != nil || restoredSecret != secret {
+		t.Errorf("the long-term secret was not restored: %v", err)
+	}
+	restoredCredentials := restored.Credentials()
+	if len(restoredCredentials) != len(credentials) || restoredCredentials[0].ID != credentials[0].ID {
+		t.Errorf("expected the credentials %+v, got %+v", credentials, restoredCredentials)
+	}
+
+	// none of the restored files gets overwritten by another restore
+	if _, err := Restore(bundlePath, w.cfgFile, testPassphrase); err == nil {
+		t.Error("restored over the existing files")
+	}
+}
+
+func TestExportExisting(t *testing.T) {
+	w := newTestWallet(t, testPassphrase)
+	defer w.close()
+
+	bundlePath := filepath.Join(w.dir, "wallet.backup")
+	if err := ioutil.WriteFile(bundlePath, []byte("existing"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Export(bundlePath, w.cfgFile, w.Wallet, testPassphrase); err == nil {
+		t.Fatal("overwrote the existing file")
+	}
+	if raw, err := ioutil.ReadFile(bundlePath); err != nil || !bytes.Equal(raw, []byte("existing")) {
+		t.Fatalf("the existing file was modified: %v", err)
+	}
+}
+
+func TestExportKeyPassphrase(t *testing.T) {
+	// the bundle could not be restored if the account key was protected by a different passphrase
+	w := newTestWallet(t, "another passphrase")
+	defer w.close()
+
+	bundlePath := filepath.Join(w.dir, "wallet.backup")
+	if err := Export(bundlePath, w.cfgFile, w.Wallet, testPassphrase); err == nil {
+		t.Fatal("exported the wallet with an account key protected by another passphrase")
+	}
+	if _, err := os.Lstat(bundlePath); !os.IsNotExist(err) {
+		t.Fatalf("the backup was written: %v", err)
+	}
+}
+
+func TestRestoreCleanup(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// the config places the account key in nested directories which do not exist yet
+	templateDir := tempDir(t)
+	defer os.RemoveAll(templateDir)
+	templateFile, err := fake.WriteConfig(templateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template, err := ioutil.ReadFile(templateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "keys", "nym", "account.key")
+	cfgRaw := strings.Replace(string(template), filepath.Join(templateDir, "account.key"), keyFile, 1)
+
+	// the restore fails after the config, the directories and the key file were created, as the key is invalid
+	plaintext, err := json.Marshal(&Bundle{
+		Version: bundleVersion,
+		Created: time.Now(),
+		Config:  []byte(cfgRaw),
+		Key:     []byte("not a key"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := storage.Seal(plaintext, []byte(testPassphrase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := filepath.Join(templateDir, "wallet.backup")
+	if err := ioutil.WriteFile(bundlePath, sealed, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Restore(bundlePath, filepath.Join(dir, "config.toml"), testPassphrase); err == nil {
+		t.Fatal("restored the invalid account key")
+	}
+	// the directories could only be removed after the key file
+	expectEmpty(t, dir)
+}
@@ -0,0 +1,251 @@
+// jobs.go - manager of concurrent long-running operations
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package jobs runs long-running wallet operations concurrently, keeping track of their state and progress.
+package jobs
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+const updatesBufferSize = 64
+
+// State represents the lifecycle state of a job.
+type State int
+
+const (
+	// Queued jobs are waiting for a free execution slot.
+	Queued State = iota
+	// Running jobs are currently being executed.
+	Running
+	// Succeeded jobs have finished without an error.
+	Succeeded
+	// Failed jobs have finished with an error or exceeded their deadline.
+	Failed
+	// Cancelled jobs were aborted on request.
+	Cancelled
+)
+
+func (s State) String() string {
+	switch s {
+	case Queued:
+		return "queued"
+	case Running:
+		return "running"
+	case Succeeded:
+		return "succeeded"
+	case Failed:
+		return "failed"
+	case Cancelled:
+		return "cancelled"
+	}
+	return "unknown"
+}
+
+// Finished indicates whether the state is final.
+func (s State) Finished() bool {
+	return s == Succeeded || s == Failed || s == Cancelled
+}
+
+// Func is the body of a job. It should return as soon as possible once the context is done.
+type Func func(ctx context.Context) error
+
+// Job is a snapshot of the state of a single job.
+type Job struct {
+	ID    int
+	Name  string
+	State State
+	// Stage is the name of the last progress stage reported by the job.
+	Stage    string
+	Err      error
+	Created  time.Time
+	Finished time.Time
+}
+
+type job struct {
+	Job
+	cancel context.CancelFunc
+}
+
+// Manager assigns identifiers to jobs, executes them with bounded concurrency
+// and publishes every change of their state.
+type Manager struct {
+	sync.Mutex
+
+	jobs        map[int]*job
+	lastID      int
+	maxFinished int
+	slots       chan struct{}
+
+	updates chan Job
+}
+
+// NewManager creates new job manager. At most maxConcurrent jobs are run at the same time,
+// with the remaining ones being queued, a non-positive value indicates no limit.
+// Up to maxFinished finished jobs are remembered.
+func NewManager(maxConcurrent, maxFinished int) *Manager {
+	m := &Manager{
+		jobs:        make(map[int]*job),
+		maxFinished: maxFinished,
+		updates:     make(chan Job, updatesBufferSize),
+	}
+	if maxConcurrent > 0 {
+		m.slots = make(chan struct{}, maxConcurrent)
+	}
+	return m
+}
+
+// Updates returns channel on which snapshots of the jobs are published whenever they change.
+// The channel must be continuously drained by the caller as otherwise the jobs will block.
+func (m *Manager) Updates() <-chan Job {
+	return m.updates
+}
+
+// Start queues new job and returns its identifier. The context passed to the job is cancelled
+// once the timeout elapses or the job is cancelled with Cancel.
+func (m *Manager) Start(name string, timeout time.Duration, fn Func) int {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+
+	m.Lock()
+	m.lastID++
+	j := &job{
+		Job: Job{
+			ID:      m.lastID,
+			Name:    name,
+			State:   Queued,
+			Created: time.Now(),
+		},
+		cancel: cancel,
+	}
+	m.jobs[j.ID] = j
+	snapshot := j.Job
+	m.Unlock()
+
+	m.updates <- snapshot
+	go m.run(ctx, j, fn)
+	return snapshot.ID
+}
+
+// Cancel requests cancellation of the job. It returns false if the job does not exist or has already finished.
+func (m *Manager) Cancel(id int) bool {
+	m.Lock()
+	defer m.Unlock()
+
+	j, ok := m.jobs[id]
+	if !ok || j.State.Finished() {
+		return false
+	}
+	j.cancel()
+	return true
+}
+
+// Jobs returns snapshots of all active and recently finished jobs ordered by their identifiers.
+func (m *Manager) Jobs() []Job {
+	m.Lock()
+	defer m.Unlock()
+
+	jobs := make([]Job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		jobs = append(jobs, j.Job)
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].ID < jobs[k].ID })
+	return jobs
+}
+
+// ActiveCount returns number of jobs that are either queued or running.
+func (m *Manager) ActiveCount() int {
+	m.Lock()
+	defer m.Unlock()
+
+	active := 0
+	for _, j := range m.jobs {
+		if !j.State.Finished() {
+			active++
+		}
+	}
+	return active
+}
+
+func (m *Manager) update(j *job, f func(j *job)) {
+	m.Lock()
+	f(j)
+	snapshot := j.Job
+	m.Unlock()
+
+	m.updates <- snapshot
+}
+
+func (m *Manager) run(ctx context.Context, j *job, fn Func) {
+	defer j.cancel()
+
+	if m.slots != nil {
+		select {
+		case m.slots <- struct{}{}:
+			defer func() { <-m.slots }()
+		case <-ctx.Done():
+			m.finish(ctx, j, ctx.Err())
+			return
+		}
+	}
+
+	m.update(j, func(j *job) { j.State = Running })
+
+	progressCtx := WithProgress(ctx, func(stage string) {
+		m.update(j, func(j *job) { j.Stage = stage })
+	})
+	m.finish(ctx, j, fn(progressCtx))
+}
+
+func (m *Manager) finish(ctx context.Context, j *job, err error) {
+	m.update(j, func(j *job) {
+		j.Finished = time.Now()
+		switch {
+		case err == nil:
+			j.State = Succeeded
+		case ctx.Err() == context.Canceled:
+			j.State = Cancelled
+			j.Err = err
+		default:
+			j.State = Failed
+			j.Err = err
+		}
+	})
+
+	m.Lock()
+	m.pruneFinished()
+	m.Unlock()
+}
+
+// pruneFinished forgets the oldest finished jobs above the limit. It must be called with the lock held.
+func (m *Manager) pruneFinished() {
+	var finished []*job
+	for _, j := range m.jobs {
+		if j.State.Finished() {
+			finished = append(finished, j)
+		}
+	}
+	if len(finished) <= m.maxFinished {
+		return
+	}
+
+	sort.Slice(finished, func(i, k int) bool { return finished[i].ID < finished[k].ID })
+	for _, j := range finished[:len(finished)-m.maxFinished] {
+		delete(m.jobs, j.ID)
+	}
+}
@@ -0,0 +1,231 @@
+// jobs_test.go - tests of the job manager
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testTimeout = 10 * time.Second
+
+// drain discards all the updates of the manager in the background.
+func drain(m *Manager) {
+	go func() {
+		for range m.Updates() {
+		}
+	}()
+}
+
+// waitFor waits until the job reaches the state.
+func waitFor(t *testing.T, m *Manager, id int, state State) Job {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for time.Now().Before(deadline) {
+		for _, job := range m.Jobs() {
+			if job.ID == id && job.State == state {
+				return job
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("job %v did not become %v within %v", id, state, testTimeout)
+	return Job{}
+}
+
+// nextUpdate returns the next update of the job, skipping those of any other jobs.
+func nextUpdate(t *testing.T, m *Manager, id int) Job {
+	t.Helper()
+	timeout := time.After(testTimeout)
+	for {
+		select {
+		case job := <-m.Updates():
+			if job.ID == id {
+				return job
+			}
+		case <-timeout:
+			t.Fatalf("no update of job %v within %v", id, testTimeout)
+		}
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	m := NewManager(0, 10)
+	release := make(chan struct{})
+	failure := errors.New("failure")
+
+	id := m.Start("job", testTimeout, func(ctx context.Context) error {
+		ReportStage(ctx, "started")
+		<-release
+		return failure
+	})
+
+	if job := nextUpdate(t, m, id); job.State != Queued || job.Name != "job" {
+		t.Fatalf("expected queued job, got %+v", job)
+	}
+	if job := nextUpdate(t, m, id); job.State != Running {
+		t.Fatalf("expected running job, got %+v", job)
+	}
+	if job := nextUpdate(t, m, id); job.State != Running || job.Stage != "started" {
+		t.Fatalf("expected the stage to be reported, got %+v", job)
+	}
+	if active := m.ActiveCount(); active != 1 {
+		t.Fatalf("expected 1 active job, got %v", active)
+	}
+
+	close(release)
+	job := nextUpdate(t, m, id)
+	if job.State != Failed || job.Err != failure || job.Finished.IsZero() {
+		t.Fatalf("expected failed job, got %+v", job)
+	}
+	if active := m.ActiveCount(); active != 0 {
+		t.Fatalf("expected no active jobs, got %v", active)
+	}
+
+	id = m.Start("job", testTimeout, func(ctx context.Context) error { return nil })
+	nextUpdate(t, m, id)
+	nextUpdate(t, m, id)
+	if job := nextUpdate(t, m, id); job.State != Succeeded || job.Err != nil {
+		t.Fatalf("expected succeeded job, got %+v", job)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	m := NewManager(0, 10)
+	drain(m)
+
+	id := m.Start("job", testTimeout, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	waitFor(t, m, id, Running)
+	if !m.Cancel(id) {
+		t.Fatal("could not cancel running job")
+	}
+	if job := waitFor(t, m, id, Cancelled); job.Err != context.Canceled {
+		t.Fatalf("expected the cancellation error, got %v", job.Err)
+	}
+
+	if m.Cancel(id) {
+		t.Error("cancelled already finished job")
+	}
+	if m.Cancel(id + 1) {
+		t.Error("cancelled non-existent job")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	m := NewManager(0, 10)
+	drain(m)
+
+	id := m.Start("job", 10*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	// jobs exceeding their deadline fail rather than get cancelled
+	if job := waitFor(t, m, id, Failed); job.Err != context.DeadlineExceeded {
+		t.Fatalf("expected the deadline error, got %v", job.Err)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	const limit = 2
+	m := NewManager(limit, 10)
+	drain(m)
+
+	release := make(chan struct{})
+	var running, maxRunning int32
+	fn := func(ctx context.Context) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&running, -1)
+		return nil
+	}
+
+	ids := make([]int, 2*limit)
+	for i := range ids {
+		ids[i] = m.Start("job", testTimeout, fn)
+	}
+	deadline := time.Now().Add(testTimeout)
+	for atomic.LoadInt32(&running) < limit && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	// give the queued jobs a chance to exceed the limit
+	time.Sleep(50 * time.Millisecond)
+
+	states := make(map[State][]int)
+	for _, job := range m.Jobs() {
+		states[job.State] = append(states[job.State], job.ID)
+	}
+	if len(states[Running]) != limit || len(states[Queued]) != len(ids)-limit {
+		t.Fatalf("expected %v running and %v queued jobs, got %v", limit, len(ids)-limit, states)
+	}
+	if active := m.ActiveCount(); active != len(ids) {
+		t.Fatalf("expected %v active jobs, got %v", len(ids), active)
+	}
+
+	// cancelled queued job never runs
+	cancelled := states[Queued][0]
+	m.Cancel(cancelled)
+	waitFor(t, m, cancelled, Cancelled)
+
+	close(release)
+	for _, id := range ids {
+		if id != cancelled {
+			waitFor(t, m, id, Succeeded)
+		}
+	}
+	if max := atomic.LoadInt32(&maxRunning); max != limit {
+		t.Fatalf("expected at most %v jobs to run at once, got %v", limit, max)
+	}
+}
+
+func TestPruneFinished(t *testing.T) {
+	const maxFinished = 3
+	m := NewManager(0, maxFinished)
+	drain(m)
+
+	var last int
+	for i := 0; i < 2*maxFinished; i++ {
+		last = m.Start("job", testTimeout, func(ctx context.Context) error { return nil })
+	}
+
+	// the oldest jobs are forgotten regardless of the order in which the jobs finish
+	deadline := time.Now().Add(testTimeout)
+	jobs := m.Jobs()
+	for (m.ActiveCount() > 0 || len(jobs) != maxFinished) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		jobs = m.Jobs()
+	}
+	if len(jobs) != maxFinished {
+		t.Fatalf("expected %v remembered jobs, got %v", maxFinished, len(jobs))
+	}
+	for i, job := range jobs {
+		if expected := last - maxFinished + 1 + i; job.ID != expected {
+			t.Errorf("expected job %v to be remembered, got %v", expected, job.ID)
+		}
+	}
+}
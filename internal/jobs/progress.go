@@ -0,0 +1,45 @@
+// progress.go - reporting progress of jobs
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package jobs
+
+import (
+	"context"
+	"fmt"
+)
+
+type progressKey struct{}
+
+// ProgressFunc is called whenever an operation reaches a new named stage.
+type ProgressFunc func(stage string)
+
+// WithProgress returns a copy of the context carrying the progress callback.
+func WithProgress(ctx context.Context, f ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, f)
+}
+
+// ReportStage reports that the operation running with the context has reached the stage.
+// It is a no-op if the context does not carry a progress callback.
+func ReportStage(ctx context.Context, stage string) {
+	if f, ok := ctx.Value(progressKey{}).(ProgressFunc); ok && f != nil {
+		f(stage)
+	}
+}
+
+// ReportStagef is like ReportStage, but formats the stage name.
+func ReportStagef(ctx context.Context, format string, a ...interface{}) {
+	ReportStage(ctx, fmt.Sprintf(format, a...))
+}
@@ -0,0 +1,307 @@
+// keystore.go - plaintext and encrypted account key files
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package keystore handles the account key files, which are either legacy hex encoded
+// private keys, as written by ethcrypto.SaveECDSA, or passphrase-encrypted Ethereum keystore (v3) files.
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/nymtech/qt-validator-client-demo/internal/sensitive"
+)
+
+var (
+	// ErrInvalidPassphrase is returned when the keystore file could not be decrypted with the provided passphrase.
+	ErrInvalidPassphrase = errors.New("could not decrypt the account key - invalid passphrase?")
+	// ErrAlreadyEncrypted is returned on attempt to encrypt a key file that is already encrypted.
+	ErrAlreadyEncrypted = errors.New("the account key is already encrypted")
+	// ErrKeyFileExists is returned on attempt to write a new key to a path that is already taken.
+	ErrKeyFileExists = errors.New("the key file already exists")
+)
+
+// backupTimeFormat is used in the names of the backups of replaced key files.
+const backupTimeFormat = "20060102-150405"
+
+// encryptedKey contains the fields of the keystore file that can be read without the passphrase.
+type encryptedKey struct {
+	Address string          `json:"address"`
+	Crypto  json.RawMessage `json:"crypto"`
+	Version int             `json:"version"`
+}
+
+func readEncrypted(raw []byte) (*encryptedKey, bool) {
+	var ek encryptedKey
+	if err := json.Unmarshal(raw, &ek); err != nil || len(ek.Crypto) == 0 {
+		return nil, false
+	}
+	return &ek, true
+}
+
+// IsEncrypted checks whether the key file is an encrypted keystore file.
+func IsEncrypted(path string) (bool, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	_, ok := readEncrypted(raw)
+	return ok, nil
+}
+
+// Address returns the address associated with the key file. Unlike the private key itself,
+// it is available without the passphrase for both kinds of the files.
+func Address(path string) (ethcommon.Address, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ethcommon.Address{}, err
+	}
+	if ek, ok := readEncrypted(raw); ok {
+		if !ethcommon.IsHexAddress(ek.Address) {
+			return ethcommon.Address{}, errors.New("malformed keystore file: invalid address")
+		}
+		return ethcommon.HexToAddress(ek.Address), nil
+	}
+
+	privateKey, err := ethcrypto.LoadECDSA(path)
+	if err != nil {
+		return ethcommon.Address{}, err
+	}
+	return ethcrypto.PubkeyToAddress(privateKey.PublicKey), nil
+}
+
+// Load loads the private key from the key file. The passphrase is ignored for plaintext files.
+func Load(path, passphrase string) (*ecdsa.PrivateKey, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := readEncrypted(raw); !ok {
+		return ethcrypto.LoadECDSA(path)
+	}
+
+	key, err := keystore.DecryptKey(raw, passphrase)
+	if err != nil {
+		if err == keystore.ErrDecrypt {
+			return nil, ErrInvalidPassphrase
+		}
+		return nil, fmt.Errorf("could not decrypt the account key: %v", err)
+	}
+	return key.PrivateKey, nil
+}
+
+// SaveEncrypted encrypts the private key with the passphrase and atomically writes it to the path
+// as a standard keystore file, replacing any existing file.
+func SaveEncrypted(path string, key *ecdsa.PrivateKey, passphrase string) error {
+	// the keystore names files on its own, so the key is written to a temporary directory
+	// on the same filesystem and then moved to the desired location
+	tmpDir, err := ioutil.TempDir(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ks := keystore.NewKeyStore(tmpDir, keystore.StandardScryptN, keystore.StandardScryptP)
+	acc, err := ks.ImportECDSA(key, passphrase)
+	if err != nil {
+		return fmt.Errorf("could not encrypt the account key: %v", err)
+	}
+	return os.Rename(acc.URL.Path, path)
+}
+
+// Encrypt migrates the plaintext key file into an encrypted keystore file protected by the passphrase.
+func Encrypt(path, passphrase string) error {
+	encrypted, err := IsEncrypted(path)
+	if err != nil {
+		return err
+	}
+	if encrypted {
+		return ErrAlreadyEncrypted
+	}
+
+	key, err := ethcrypto.LoadECDSA(path)
+	if err != nil {
+		return err
+	}
+	return SaveEncrypted(path, key, passphrase)
+}
+
+// ChangePassphrase re-encrypts the key file with the new passphrase.
+// Plaintext key files get encrypted, in which case the old passphrase is ignored.
+func ChangePassphrase(path, oldPassphrase, newPassphrase string) error {
+	key, err := Load(path, oldPassphrase)
+	if err != nil {
+		return err
+	}
+	return SaveEncrypted(path, key, newPassphrase)
+}
+
+// writeNew atomically creates the file with the given content. It fails with ErrKeyFileExists
+// rather than replacing an existing file, no matter whether the latter could be read or not.
+func writeNew(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// unlike rename, link never replaces the target
+	if err := os.Link(tmp.Name(), path); err != nil {
+		if os.IsExist(err) {
+			return ErrKeyFileExists
+		}
+		return err
+	}
+	return nil
+}
+
+// SaveNew saves the private key to the path in the plaintext format. An existing file is never overwritten,
+// it has to be moved away with Backup first.
+func SaveNew(path string, key *ecdsa.PrivateKey) error {
+	if err := writeNew(path, []byte(hex.EncodeToString(ethcrypto.FromECDSA(key)))); err != nil {
+		if err == ErrKeyFileExists {
+			return err
+		}
+		return fmt.Errorf("could not save the new key: %v", err)
+	}
+	return nil
+}
+
+// ParseHex parses the hex encoded private key, i.e. the content of a plaintext key file.
+func ParseHex(hexKey string) (*ecdsa.PrivateKey, error) {
+	key, err := ethcrypto.HexToECDSA(strings.TrimPrefix(strings.TrimSpace(hexKey), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %v", err)
+	}
+	return key, nil
+}
+
+// ImportFile copies the key file from src to path, after making sure the key can be loaded with the passphrase.
+// Encrypted keystore files are copied as they are and hence remain protected by the same passphrase.
+// Like SaveNew, it never overwrites an existing file.
+func ImportFile(path, src, passphrase string) (ethcommon.Address, error) {
+	key, err := Load(src, passphrase)
+	if err != nil {
+		return ethcommon.Address{}, err
+	}
+	raw, err := ioutil.ReadFile(src)
+	if err != nil {
+		return ethcommon.Address{}, err
+	}
+
+	if _, ok := readEncrypted(raw); ok {
+		err = writeNew(path, raw)
+	} else {
+		err = SaveNew(path, key)
+	}
+	if err != nil {
+		return ethcommon.Address{}, err
+	}
+	return ethcrypto.PubkeyToAddress(key.PublicKey), nil
+}
+
+// Backup moves the file to a timestamped backup next to it and returns the path of the backup.
+func Backup(path string) (string, error) {
+	backupPath := fmt.Sprintf("%v.%v.bak", path, time.Now().Format(backupTimeFormat))
+	// as with new keys, an existing backup must never get replaced
+	if err := os.Link(path, backupPath); err != nil {
+		return "", fmt.Errorf("could not back up %v: %v", path, err)
+	}
+	if err := os.Remove(path); err != nil {
+		return "", fmt.Errorf("could not remove %v after backing it up: %v", path, err)
+	}
+	return backupPath, nil
+}
+
+// plaintextKeyDirPrefix prefixes the names of the directories holding temporary plaintext keys.
+const plaintextKeyDirPrefix = ".nym-plaintext-key"
+
+// staleKeyDirAge is the age after which a temporary plaintext key directory is assumed to have been left behind
+// by a process that did not exit cleanly.
+const staleKeyDirAge = time.Hour
+
+// removeStaleKeyDirs removes temporary plaintext keys left behind in the directory by crashed or killed processes.
+func removeStaleKeyDirs(dir string) {
+	leftovers, err := filepath.Glob(filepath.Join(dir, plaintextKeyDirPrefix+"*"))
+	if err != nil {
+		return
+	}
+	for _, leftover := range leftovers {
+		if info, err := os.Lstat(leftover); err == nil && info.IsDir() && time.Since(info.ModTime()) > staleKeyDirAge {
+			os.RemoveAll(leftover)
+		}
+	}
+}
+
+// WithPlaintextKey temporarily writes the private key to a fresh file, inside a new directory accessible only
+// by the current user, created within dir, and calls f with its path. Both are removed as soon as f returns.
+// The dir should be the one holding the key file, so that the key never leaves the location already trusted with it,
+// which is also where any plaintext keys left behind by crashed processes get cleaned up.
+// It exists solely for the sake of libraries that can only load the key from a plaintext file.
+func WithPlaintextKey(dir string, key *ecdsa.PrivateKey, f func(path string) error) error {
+	removeStaleKeyDirs(dir)
+
+	// TempDir creates the directory with 0700 permissions
+	tmpDir, err := ioutil.TempDir(dir, plaintextKeyDirPrefix)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "key")
+	keyFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	rawKey := ethcrypto.FromECDSA(key)
+	hexKey := make([]byte, hex.EncodedLen(len(rawKey)))
+	hex.Encode(hexKey, rawKey)
+	_, err = keyFile.Write(hexKey)
+	sensitive.Zero(rawKey)
+	sensitive.Zero(hexKey)
+	if closeErr := keyFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return f(path)
+}
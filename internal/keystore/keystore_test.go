@@ -0,0 +1,240 @@
+// keystore_test.go - tests of the account key files
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package keystore
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	testPassphrase = "correct horse battery staple"
+	newPassphrase  = "new passphrase"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// newKeyFile saves a fresh plaintext key in the directory.
+func newKeyFile(t *testing.T, dir string) (string, *ecdsa.PrivateKey) {
+	key, err := ethcrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "account.key")
+	if err := SaveNew(path, key); err != nil {
+		t.Fatal(err)
+	}
+	return path, key
+}
+
+// expectFiles checks that the directory contains exactly the expected number of files, e.g. that no temporary
+// files were left behind.
+func expectFiles(t *testing.T, dir string, expected int) {
+	t.Helper()
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != expected {
+		names := make([]string, len(files))
+		for i, f := range files {
+			names[i] = f.Name()
+		}
+		t.Fatalf("expected %v files, got %v", expected, names)
+	}
+}
+
+func expectKey(t *testing.T, path, passphrase string, expected *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := Load(path, passphrase)
+	if err != nil {
+		t.Fatalf("could not load the key: %v", err)
+	}
+	if key.D.Cmp(expected.D) != 0 {
+		t.Fatal("loaded a different key")
+	}
+}
+
+func expectAddress(t *testing.T, path string, key *ecdsa.PrivateKey) {
+	t.Helper()
+	address, err := Address(path)
+	if err != nil {
+		t.Fatalf("could not read the address: %v", err)
+	}
+	if address != ethcrypto.PubkeyToAddress(key.PublicKey) {
+		t.Fatalf("expected address %v, got %v", ethcrypto.PubkeyToAddress(key.PublicKey).Hex(), address.Hex())
+	}
+}
+
+func TestNeverOverwrite(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	path, key := newKeyFile(t, dir)
+	original, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectKey(t, path, "", key)
+	expectAddress(t, path, key)
+
+	other, err := ethcrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveNew(path, other); err != ErrKeyFileExists {
+		t.Errorf("expected %v, got %v", ErrKeyFileExists, err)
+	}
+
+	// importing is refused as well, even if the source is the very same key
+	src := filepath.Join(dir, "src.key")
+	if err := ioutil.WriteFile(src, original, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ImportFile(path, src, ""); err != ErrKeyFileExists {
+		t.Errorf("expected %v, got %v", ErrKeyFileExists, err)
+	}
+
+	// not even an unreadable file gets replaced
+	garbage := filepath.Join(dir, "garbage.key")
+	if err := ioutil.WriteFile(garbage, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveNew(garbage, other); err != ErrKeyFileExists {
+		t.Errorf("expected %v, got %v", ErrKeyFileExists, err)
+	}
+
+	if raw, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(raw, original) {
+		t.Error("the existing key file was modified")
+	}
+	expectFiles(t, dir, 3)
+}
+
+func TestBackup(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	path, key := newKeyFile(t, dir)
+	backup, err := Backup(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Fatalf("the key file remains after the backup: %v", err)
+	}
+	expectKey(t, backup, "", key)
+
+	// the path is free for a new key
+	path, key = newKeyFile(t, dir)
+
+	// an existing backup is never replaced, in which case the file stays in place
+	now := time.Now()
+	for _, tm := range []time.Time{now, now.Add(time.Second)} {
+		taken := fmt.Sprintf("%v.%v.bak", path, tm.Format(backupTimeFormat))
+		if taken == backup {
+			continue
+		}
+		if err := ioutil.WriteFile(taken, []byte("taken"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := Backup(path); err == nil {
+		t.Fatal("replaced an existing backup")
+	}
+	expectKey(t, path, "", key)
+}
+
+func TestEncrypt(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	path, key := newKeyFile(t, dir)
+	if err := Encrypt(path, testPassphrase); err != nil {
+		t.Fatal(err)
+	}
+	if encrypted, err := IsEncrypted(path); err != nil || !encrypted {
+		t.Fatalf("the key file was not encrypted: %v", err)
+	}
+	if raw, err := ioutil.ReadFile(path); err != nil || bytes.Contains(raw, []byte(fmt.Sprintf("%x", ethcrypto.FromECDSA(key)))) {
+		t.Fatalf("the key is still present in plaintext: %v", err)
+	}
+
+	expectAddress(t, path, key)
+	expectKey(t, path, testPassphrase, key)
+	if _, err := Load(path, "wrong passphrase"); err != ErrInvalidPassphrase {
+		t.Errorf("expected %v, got %v", ErrInvalidPassphrase, err)
+	}
+	if err := Encrypt(path, testPassphrase); err != ErrAlreadyEncrypted {
+		t.Errorf("expected %v, got %v", ErrAlreadyEncrypted, err)
+	}
+	expectFiles(t, dir, 1)
+}
+
+func TestChangePassphrase(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	path, key := newKeyFile(t, dir)
+	if err := SaveEncrypted(path, key, testPassphrase); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ChangePassphrase(path, "wrong passphrase", newPassphrase); err != ErrInvalidPassphrase {
+		t.Fatalf("expected %v, got %v", ErrInvalidPassphrase, err)
+	}
+	expectKey(t, path, testPassphrase, key)
+
+	if err := ChangePassphrase(path, testPassphrase, newPassphrase); err != nil {
+		t.Fatal(err)
+	}
+	expectKey(t, path, newPassphrase, key)
+	if _, err := Load(path, testPassphrase); err != ErrInvalidPassphrase {
+		t.Errorf("the old passphrase still works: %v", err)
+	}
+	expectAddress(t, path, key)
+	expectFiles(t, dir, 1)
+}
+
+func TestChangePassphrasePlaintext(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// the old passphrase of plaintext files is ignored
+	path, key := newKeyFile(t, dir)
+	if err := ChangePassphrase(path, "anything", newPassphrase); err != nil {
+		t.Fatal(err)
+	}
+	if encrypted, err := IsEncrypted(path); err != nil || !encrypted {
+		t.Fatalf("the key file was not encrypted: %v", err)
+	}
+	expectKey(t, path, newPassphrase, key)
+	expectAddress(t, path, key)
+}
@@ -0,0 +1,284 @@
+// logging.go - structured logging that never reveals secrets
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package logging provides structured logging, where each record consists of a message followed by key-value pairs.
+// Values of keys that look sensitive, as well as values of the sensitive package types, are always redacted.
+// The most recent records are also kept in memory, so that they could be displayed by the application.
+package logging
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nymtech/qt-validator-client-demo/internal/sensitive"
+)
+
+// Level is the severity of a record.
+type Level int
+
+// The levels are the same as the ones accepted by the [Logging] section of the config.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelNotice
+	LevelWarning
+	LevelError
+	LevelCritical
+)
+
+var levelNames = map[Level]string{
+	LevelDebug:    "DEBUG",
+	LevelInfo:     "INFO",
+	LevelNotice:   "NOTICE",
+	LevelWarning:  "WARNING",
+	LevelError:    "ERROR",
+	LevelCritical: "CRITICAL",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return "UNKNOWN"
+}
+
+// ParseLevel parses the name of the level, as used in the config.
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level '%v'", name)
+}
+
+const (
+	timeFormat = "2006-01-02 15:04:05.000"
+
+	// number of the records kept in memory
+	recentRecords = 500
+)
+
+// Record is a single formatted log entry.
+type Record struct {
+	Time    time.Time
+	Level   Level
+	Module  string
+	Message string
+	// Fields are the formatted key-value pairs of the record, with all the sensitive values redacted.
+	Fields string
+}
+
+// String returns the record as written to the log.
+func (r Record) String() string {
+	s := fmt.Sprintf("%v %v %v: %v", r.Time.Format(timeFormat), r.Level, r.Module, r.Message)
+	if r.Fields != "" {
+		s += " " + r.Fields
+	}
+	return s
+}
+
+// fragments of the keys whose values are never logged
+var sensitiveKeys = []string{"secret", "passphrase", "password", "mnemonic", "phrase", "seed", "privatekey"}
+
+var (
+	outputLock sync.Mutex
+	output     io.Writer = os.Stderr
+	minLevel             = LevelInfo
+	disabled   bool
+	// ring buffer of the most recent records, next is the position of the oldest one once it is full
+	recent []Record
+	next   int
+	hook   func(Record)
+)
+
+// SetOutput changes the destination of all the records.
+func SetOutput(w io.Writer) {
+	outputLock.Lock()
+	defer outputLock.Unlock()
+	setOutput(w)
+}
+
+// setOutput must be called with the lock held.
+func setOutput(w io.Writer) {
+	if closer, ok := output.(io.Closer); ok && output != os.Stdout && output != os.Stderr {
+		closer.Close()
+	}
+	output = w
+}
+
+// SetLevel changes the minimum severity of the records that get written.
+func SetLevel(level Level) {
+	outputLock.Lock()
+	defer outputLock.Unlock()
+	minLevel = level
+}
+
+// AppLogFile returns the file to which the records are written when the config specifies the log file.
+// The configured file itself is written by the logger of the nym-validator client, hence the records of the
+// application go to a separate file next to it, e.g. client.wallet.log for client.log.
+func AppLogFile(file string) string {
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + ".wallet" + ext
+}
+
+// Configure applies the [Logging] section of the config. With a file, the records are written to its AppLogFile,
+// otherwise to the fallback. If the configuration is invalid, it is not applied at all.
+func Configure(disable bool, file, level string, fallback io.Writer) error {
+	parsedLevel, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer
+	switch {
+	case disable:
+		w = ioutil.Discard
+	case file != "":
+		if w, err = newRotatingFile(AppLogFile(file)); err != nil {
+			return fmt.Errorf("could not open the log file: %v", err)
+		}
+	default:
+		w = fallback
+	}
+
+	outputLock.Lock()
+	defer outputLock.Unlock()
+	setOutput(w)
+	minLevel = parsedLevel
+	disabled = disable
+	return nil
+}
+
+// Subscribe sets the function called with every record that gets written, in addition to writing it to the output,
+// and returns the most recent records written so far, the oldest ones first. The function replaces any previous one.
+// It is called outside of any locks, hence it may log on its own, but it must not block for long.
+func Subscribe(f func(Record)) []Record {
+	outputLock.Lock()
+	defer outputLock.Unlock()
+	hook = f
+
+	records := make([]Record, 0, len(recent))
+	records = append(records, recent[next:]...)
+	return append(records, recent[:next]...)
+}
+
+// Logger writes records of a single module.
+type Logger struct {
+	module string
+}
+
+// New returns logger of the module.
+func New(module string) *Logger {
+	return &Logger{module: module}
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, fragment := range sensitiveKeys {
+		if strings.Contains(key, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatValue(key string, value interface{}) string {
+	if isSensitiveKey(key) {
+		return sensitive.Redacted
+	}
+	switch v := value.(type) {
+	case *sensitive.Bytes, *ecdsa.PrivateKey, ecdsa.PrivateKey:
+		return sensitive.Redacted
+	case error:
+		return fmt.Sprintf("%q", v.Error())
+	case string:
+		return fmt.Sprintf("%q", v)
+	case fmt.Stringer:
+		return fmt.Sprintf("%q", v.String())
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// formatFields formats the key-value pairs. The keys and values are expected to alternate, a trailing key gets an empty value.
+func formatFields(kv []interface{}) string {
+	fields := make([]string, 0, (len(kv)+1)/2)
+	for i := 0; i < len(kv); i += 2 {
+		key := fmt.Sprint(kv[i])
+		var value interface{} = ""
+		if i+1 < len(kv) {
+			value = kv[i+1]
+		}
+		fields = append(fields, key+"="+formatValue(key, value))
+	}
+	return strings.Join(fields, " ")
+}
+
+func (l *Logger) log(level Level, msg string, kv []interface{}) {
+	outputLock.Lock()
+	if disabled || level < minLevel {
+		outputLock.Unlock()
+		return
+	}
+
+	rec := Record{
+		Time:    time.Now(),
+		Level:   level,
+		Module:  l.module,
+		Message: msg,
+		Fields:  formatFields(kv),
+	}
+	io.WriteString(output, rec.String()+"\n")
+	if len(recent) < recentRecords {
+		recent = append(recent, rec)
+	} else {
+		recent[next] = rec
+		next = (next + 1) % recentRecords
+	}
+	f := hook
+	outputLock.Unlock()
+
+	if f != nil {
+		f(rec)
+	}
+}
+
+// Debug writes the record with LevelDebug.
+func (l *Logger) Debug(msg string, kv ...interface{}) {
+	l.log(LevelDebug, msg, kv)
+}
+
+// Info writes the record with LevelInfo.
+func (l *Logger) Info(msg string, kv ...interface{}) {
+	l.log(LevelInfo, msg, kv)
+}
+
+// Warning writes the record with LevelWarning.
+func (l *Logger) Warning(msg string, kv ...interface{}) {
+	l.log(LevelWarning, msg, kv)
+}
+
+// Error writes the record with LevelError.
+func (l *Logger) Error(msg string, kv ...interface{}) {
+	l.log(LevelError, msg, kv)
+}
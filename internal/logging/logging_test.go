@@ -0,0 +1,162 @@
+// logging_test.go - tests of the structured logging
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package logging
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nymtech/qt-validator-client-demo/internal/sensitive"
+)
+
+const secretValue = "hunter2-very-secret"
+
+// captureOutput directs the records of all levels to the returned buffer until the returned function is called.
+func captureOutput() (*bytes.Buffer, func()) {
+	buf := new(bytes.Buffer)
+	SetOutput(buf)
+	SetLevel(LevelDebug)
+	return buf, func() {
+		SetOutput(os.Stderr)
+		SetLevel(LevelInfo)
+	}
+}
+
+func TestRedaction(t *testing.T) {
+	buf, restore := captureOutput()
+	defer restore()
+
+	var records []Record
+	Subscribe(func(r Record) { records = append(records, r) })
+	defer Subscribe(nil)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := New("test")
+	log.Info("sensitive keys",
+		"passphrase", secretValue,
+		"newPassphrase", secretValue,
+		"Password", secretValue,
+		"mnemonic", secretValue,
+		"seedPhrase", secretValue,
+		"longtermSecret", secretValue,
+		"privateKey", []byte(secretValue),
+	)
+	log.Error("sensitive values",
+		"data", sensitive.NewBytes([]byte(secretValue)),
+		"key", key,
+		"keyValue", *key,
+		// the key does not look sensitive, but the nested value still formats as redacted
+		"wrapped", struct{ Data *sensitive.Bytes }{sensitive.NewBytes([]byte(secretValue))},
+	)
+
+	output := buf.String()
+	for _, forbidden := range []string{secretValue, fmt.Sprintf("%v", []byte(secretValue)), key.D.String(), key.D.Text(16)} {
+		if strings.Contains(output, forbidden) {
+			t.Errorf("the output contains %q: %v", forbidden, output)
+		}
+	}
+	if n := strings.Count(output, sensitive.Redacted); n != 11 {
+		t.Errorf("expected 11 redacted values, got %v: %v", n, output)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records to be published, got %v", len(records))
+	}
+	for _, r := range records {
+		if strings.Contains(r.Fields, secretValue) {
+			t.Errorf("the published record contains the secret: %v", r)
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	buf, restore := captureOutput()
+	defer restore()
+
+	New("test").Warning("message", "account", "alice", "count", 3, "err", errors.New("failure"), "trailing")
+	expected := `WARNING test: message account="alice" count=3 err="failure" trailing=""` + "\n"
+	if output := buf.String(); !strings.HasSuffix(output, expected) {
+		t.Errorf("expected the record to end with %q, got %q", expected, output)
+	}
+
+	buf.Reset()
+	SetLevel(LevelInfo)
+	New("test").Debug("ignored")
+	if buf.Len() != 0 {
+		t.Errorf("the record below the minimum level was written: %q", buf.String())
+	}
+}
+
+func TestRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const backups = 3
+	path := filepath.Join(dir, "client.wallet.log")
+	rf, err := newRotatingFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	// every file holds a single record
+	rf.maxSize = 16
+	rf.backups = backups
+
+	const records = 10
+	for i := 0; i < records; i++ {
+		if _, err := fmt.Fprintf(rf, "record %02d\n", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != backups+1 {
+		t.Fatalf("expected the current file and %v backups, got %v files", backups, len(files))
+	}
+	// the most recent backup is <file>.1
+	for i := 0; i <= backups; i++ {
+		name := path
+		if i > 0 {
+			name = fmt.Sprintf("%v.%v", path, i)
+		}
+		content, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := fmt.Sprintf("record %02d\n", records-1-i); string(content) != expected {
+			t.Errorf("expected %v to contain %q, got %q", name, expected, content)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// rotate.go - log file rotated once it grows too big
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package logging
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	// default size after which the log file is rotated
+	maxFileSize = 10 << 20
+	// default number of the rotated files kept next to the current one, as <file>.1 (the most recent) to <file>.N
+	maxBackups = 5
+)
+
+// rotatingFile is a log file which gets renamed to <file>.1 once it exceeds maxSize, with the previous backups
+// shifted by one. It is not safe for concurrent use, the writes are serialized by the logger.
+type rotatingFile struct {
+	path    string
+	f       *os.File
+	size    int64
+	maxSize int64
+	backups int
+}
+
+func newRotatingFile(path string) (*rotatingFile, error) {
+	rf := &rotatingFile{path: path, maxSize: maxFileSize, backups: maxBackups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.f = f
+	rf.size = info.Size()
+	return nil
+}
+
+func (rf *rotatingFile) rotate() error {
+	if err := rf.f.Close(); err != nil {
+		return err
+	}
+	for i := rf.backups - 1; i > 0; i-- {
+		// missing backups are fine
+		os.Rename(fmt.Sprintf("%v.%v", rf.path, i), fmt.Sprintf("%v.%v", rf.path, i+1))
+	}
+	renameErr := os.Rename(rf.path, rf.path+".1")
+	// if the rename failed, the current file simply keeps growing
+	if err := rf.open(); err != nil {
+		return err
+	}
+	return renameErr
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	if rf.size+int64(len(p)) > rf.maxSize && rf.size > 0 {
+		// a failed rotation is retried with the next write, logging must go on regardless
+		rf.rotate()
+	}
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// Close implements io.Closer.
+func (rf *rotatingFile) Close() error {
+	return rf.f.Close()
+}
@@ -0,0 +1,178 @@
+// mnemonic.go - seed phrase from which all the secrets of an account are derived
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package mnemonic implements BIP39 seed phrases from which both the account key
+// and the Coconut long-term secret are deterministically derived, so that the phrase
+// is the only thing that needs to be backed up. The account key is derived along the standard
+// Ethereum BIP44 path, hence the same phrase restores the same account in other Ethereum wallets.
+package mnemonic
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"strings"
+
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/nymtech/qt-validator-client-demo/internal/sensitive"
+	"github.com/tyler-smith/go-bip39"
+)
+
+const (
+	// entropyBits determines the length of the phrase, 256 bits correspond to 24 words.
+	entropyBits = 256
+
+	// coconutSecretLabel separates the long-term secret from the BIP32 key tree of the account key
+	coconutSecretLabel = "nym coconut long-term secret"
+
+	// masterKeyLabel is the BIP32 key of the HMAC producing the master key from the seed
+	masterKeyLabel = "Bitcoin seed"
+
+	// hardened marks indices of the hardened BIP32 child keys
+	hardened = 0x80000000
+)
+
+// accountKeyPath is the BIP44 path of the first Ethereum account, m/44'/60'/0'/0/0,
+// which is what MetaMask, Ledger and the other Ethereum wallets use by default.
+var accountKeyPath = []uint32{hardened + 44, hardened + 60, hardened + 0, 0, 0}
+
+// ErrInvalidMnemonic is returned when the phrase is not a valid BIP39 mnemonic, for example due to a typo.
+var ErrInvalidMnemonic = errors.New("invalid seed phrase - are all the words spelled correctly?")
+
+// Seed is the BIP39 seed obtained from the phrase.
+type Seed []byte
+
+// New generates a fresh seed phrase.
+func New() (string, error) {
+	entropy, err := bip39.NewEntropy(entropyBits)
+	if err != nil {
+		return "", err
+	}
+	return bip39.NewMnemonic(entropy)
+}
+
+// Normalize collapses all the whitespace in the phrase and converts it to lower case.
+func Normalize(phrase string) string {
+	return strings.Join(strings.Fields(strings.ToLower(phrase)), " ")
+}
+
+// ToSeed validates the phrase and turns it into the seed.
+func ToSeed(phrase string) (Seed, error) {
+	phrase = Normalize(phrase)
+	if !bip39.IsMnemonicValid(phrase) {
+		return nil, ErrInvalidMnemonic
+	}
+	return Seed(bip39.NewSeed(phrase, "")), nil
+}
+
+func (s Seed) derive(label string, counter byte) []byte {
+	mac := hmac.New(sha512.New, []byte(label))
+	mac.Write(s)
+	mac.Write([]byte{counter})
+	return mac.Sum(nil)
+}
+
+// Wipe overwrites the seed with zeroes.
+func (s Seed) Wipe() {
+	sensitive.Zero(s)
+}
+
+// serialize256 encodes the number as 32 big endian bytes.
+func serialize256(n *big.Int) []byte {
+	b := make([]byte, 32)
+	nb := n.Bytes()
+	copy(b[32-len(nb):], nb)
+	sensitive.Zero(nb)
+	return b
+}
+
+// compressedPublicKey returns the SEC1 compressed public key of the private key.
+func compressedPublicKey(k *big.Int) []byte {
+	kb := serialize256(k)
+	defer sensitive.Zero(kb)
+	x, y := ethcrypto.S256().ScalarBaseMult(kb)
+	return append([]byte{0x02 + byte(y.Bit(0))}, serialize256(x)...)
+}
+
+// childKey derives the BIP32 private child key with the given index and returns it with its chain code.
+func childKey(k *big.Int, chainCode []byte, index uint32) (*big.Int, []byte, error) {
+	var data []byte
+	if index >= hardened {
+		data = append([]byte{0}, serialize256(k)...)
+	} else {
+		data = compressedPublicKey(k)
+	}
+	data = append(data, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[len(data)-4:], index)
+
+	mac := hmac.New(sha512.New, chainCode)
+	mac.Write(data)
+	sensitive.Zero(data)
+	derived := mac.Sum(nil)
+	defer sensitive.Zero(derived)
+
+	n := ethcrypto.S256().Params().N
+	child := new(big.Int).SetBytes(derived[:32])
+	if child.Cmp(n) >= 0 {
+		return nil, nil, errors.New("invalid child key")
+	}
+	child.Add(child, k)
+	child.Mod(child, n)
+	if child.Sign() == 0 {
+		return nil, nil, errors.New("invalid child key")
+	}
+	return child, append([]byte(nil), derived[32:]...), nil
+}
+
+// AccountKey derives the ECDSA key of the Ethereum/Nym account according to BIP32 along the BIP44 path
+// of the first Ethereum account.
+func (s Seed) AccountKey() (*ecdsa.PrivateKey, error) {
+	mac := hmac.New(sha512.New, []byte(masterKeyLabel))
+	mac.Write(s)
+	master := mac.Sum(nil)
+	defer sensitive.Zero(master)
+
+	// the chance of any of the derived values not being a valid key is negligible, but not zero
+	k := new(big.Int).SetBytes(master[:32])
+	if k.Sign() == 0 || k.Cmp(ethcrypto.S256().Params().N) >= 0 {
+		return nil, errors.New("could not derive a valid account key")
+	}
+	chainCode := append([]byte(nil), master[32:]...)
+	for _, index := range accountKeyPath {
+		child, childChainCode, err := childKey(k, chainCode, index)
+		sensitive.Zero(chainCode)
+		k.SetInt64(0)
+		if err != nil {
+			return nil, errors.New("could not derive a valid account key")
+		}
+		k, chainCode = child, childChainCode
+	}
+	sensitive.Zero(chainCode)
+
+	kb := serialize256(k)
+	defer sensitive.Zero(kb)
+	k.SetInt64(0)
+	return ethcrypto.ToECDSA(kb)
+}
+
+// SecretMaterial derives the bytes from which the Coconut long-term secret is obtained.
+// It is long enough to be reduced modulo the curve order without a noticeable bias.
+func (s Seed) SecretMaterial() []byte {
+	return s.derive(coconutSecretLabel, 0)
+}
@@ -0,0 +1,80 @@
+// mnemonic_test.go - tests of the derivation of the account secrets
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package mnemonic
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+)
+
+// the standard test phrase, as restored by the other Ethereum wallets
+const (
+	testPhrase     = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	testAccountKey = "1ab42cc412b618bdea3a599e3c9bae199ebf030895b039e9db1e30dafb12b727"
+	testAddress    = "0x9858EfFD232B4033E47d90003D41EC34EcaEda94"
+)
+
+func TestAccountKey(t *testing.T) {
+	seed, err := ToSeed("  Abandon abandon abandon abandon abandon abandon\nabandon abandon abandon abandon abandon about ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer seed.Wipe()
+
+	key, err := seed.AccountKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(ethcrypto.FromECDSA(key)); got != testAccountKey {
+		t.Fatalf("expected account key %v, got %v", testAccountKey, got)
+	}
+	if got := ethcrypto.PubkeyToAddress(key.PublicKey).Hex(); got != testAddress {
+		t.Fatalf("expected address %v, got %v", testAddress, got)
+	}
+}
+
+func TestSecretMaterial(t *testing.T) {
+	seed, err := ToSeed(testPhrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer seed.Wipe()
+
+	key, err := seed.AccountKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	material := seed.SecretMaterial()
+	if len(material) != 64 {
+		t.Fatalf("expected 64 bytes of secret material, got %v", len(material))
+	}
+	if bytes.Contains(material, ethcrypto.FromECDSA(key)) {
+		t.Fatal("the long-term secret must be independent of the account key")
+	}
+	if !bytes.Equal(material, seed.SecretMaterial()) {
+		t.Fatal("the derivation is not deterministic")
+	}
+}
+
+func TestInvalidPhrase(t *testing.T) {
+	if _, err := ToSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon"); err != ErrInvalidMnemonic {
+		t.Fatalf("expected ErrInvalidMnemonic, got %v", err)
+	}
+}
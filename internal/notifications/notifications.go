@@ -0,0 +1,251 @@
+// notifications.go - history of notifications presented to the user
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package notifications keeps the history of notifications until they are dismissed,
+// coalescing repeated messages and limiting the rate at which new ones are accepted.
+package notifications
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultDedupWindow is how long after its last occurrence a notification absorbs identical messages.
+	DefaultDedupWindow = time.Minute
+	// DefaultRateLimit is how many distinct notifications are accepted within DefaultRatePeriod.
+	DefaultRateLimit  = 5
+	DefaultRatePeriod = 10 * time.Second
+	// DefaultMaxItems is how many notifications are remembered, the oldest ones are forgotten first.
+	DefaultMaxItems = 100
+
+	suppressedTitle = "Notifications suppressed"
+)
+
+// Severity of a notification.
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Error
+	// Critical notifications require the immediate attention of the user. They are never rate limited.
+	Critical
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	case Critical:
+		return "critical"
+	}
+	return "unknown"
+}
+
+// Notification is a snapshot of a single entry of the history.
+type Notification struct {
+	ID       int
+	Severity Severity
+	Title    string
+	Message  string
+	// Category is the optional classification of the failure the notification is about.
+	Category string
+	// First and Last are the times of the first and the most recent occurrence of the message.
+	First time.Time
+	Last  time.Time
+	// Count is the number of times the message was posted.
+	Count int
+}
+
+type key struct {
+	severity Severity
+	title    string
+	message  string
+}
+
+// Center holds the notifications until they are dismissed.
+type Center struct {
+	sync.Mutex
+
+	items  []*Notification
+	byKey  map[key]*Notification
+	lastID int
+
+	dedupWindow time.Duration
+	rateLimit   int
+	ratePeriod  time.Duration
+	maxItems    int
+	// times at which the distinct notifications were accepted within the current rate period
+	accepted []time.Time
+	// collects everything rejected by the rate limit
+	suppressed *Notification
+	// returns the current time, it is only replaced by the tests
+	now func() time.Time
+}
+
+// NewCenter creates new notification center using the default limits.
+func NewCenter() *Center {
+	return &Center{
+		byKey:       make(map[key]*Notification),
+		dedupWindow: DefaultDedupWindow,
+		rateLimit:   DefaultRateLimit,
+		ratePeriod:  DefaultRatePeriod,
+		maxItems:    DefaultMaxItems,
+		now:         time.Now,
+	}
+}
+
+// Post records the notification, only its severity, title, message and category are used.
+// It returns the snapshot of the entry that was created or updated because of it. A message identical
+// to a recent one only increments its counter, while a message exceeding the rate limit is counted by
+// a single summary entry instead. Identifiers of the entries forgotten due to the size limit are returned as well.
+func (c *Center) Post(notification Notification) (Notification, []int) {
+	c.Lock()
+	defer c.Unlock()
+
+	now := c.now()
+	severity := notification.Severity
+	k := key{severity, notification.Title, notification.Message}
+	if n, ok := c.byKey[k]; ok && now.Sub(n.Last) < c.dedupWindow {
+		n.Last = now
+		n.Count++
+		return *n, nil
+	}
+
+	if severity != Critical && !c.allow(now) {
+		if c.suppressed == nil || now.Sub(c.suppressed.Last) >= c.dedupWindow {
+			c.suppressed = c.add(Warning, suppressedTitle, now)
+			c.suppressed.Count = 0
+		}
+		c.suppressed.Count++
+		c.suppressed.Last = now
+		c.suppressed.Message = fmt.Sprintf("%d notifications arrived too quickly and were not shown, see the log for details", c.suppressed.Count)
+		return *c.suppressed, c.prune()
+	}
+
+	n := c.add(severity, notification.Title, now)
+	n.Message = notification.Message
+	n.Category = notification.Category
+	c.byKey[k] = n
+	return *n, c.prune()
+}
+
+// Dismiss forgets the notification. It returns false if it does not exist.
+func (c *Center) Dismiss(id int) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	for i, n := range c.items {
+		if n.ID == id {
+			c.remove(i)
+			return true
+		}
+	}
+	return false
+}
+
+// DismissAll forgets all the notifications.
+func (c *Center) DismissAll() {
+	c.Lock()
+	defer c.Unlock()
+
+	c.items = nil
+	c.byKey = make(map[key]*Notification)
+	c.suppressed = nil
+}
+
+// Notifications returns snapshots of all the notifications, the oldest first.
+func (c *Center) Notifications() []Notification {
+	c.Lock()
+	defer c.Unlock()
+
+	notifications := make([]Notification, len(c.items))
+	for i, n := range c.items {
+		notifications[i] = *n
+	}
+	return notifications
+}
+
+// Len returns the number of notifications that were not dismissed.
+func (c *Center) Len() int {
+	c.Lock()
+	defer c.Unlock()
+
+	return len(c.items)
+}
+
+// allow checks the rate limit and, if it is not exceeded, counts a new notification against it.
+// It must be called with the lock held.
+func (c *Center) allow(now time.Time) bool {
+	recent := c.accepted[:0]
+	for _, t := range c.accepted {
+		if now.Sub(t) < c.ratePeriod {
+			recent = append(recent, t)
+		}
+	}
+	c.accepted = recent
+
+	if len(c.accepted) >= c.rateLimit {
+		return false
+	}
+	c.accepted = append(c.accepted, now)
+	return true
+}
+
+// add must be called with the lock held.
+func (c *Center) add(severity Severity, title string, now time.Time) *Notification {
+	c.lastID++
+	n := &Notification{
+		ID:       c.lastID,
+		Severity: severity,
+		Title:    title,
+		First:    now,
+		Last:     now,
+		Count:    1,
+	}
+	c.items = append(c.items, n)
+	return n
+}
+
+// prune forgets the oldest notifications above the limit and returns their identifiers.
+// It must be called with the lock held.
+func (c *Center) prune() []int {
+	var pruned []int
+	for len(c.items) > c.maxItems {
+		pruned = append(pruned, c.items[0].ID)
+		c.remove(0)
+	}
+	return pruned
+}
+
+// remove must be called with the lock held.
+func (c *Center) remove(i int) {
+	n := c.items[i]
+	c.items = append(c.items[:i], c.items[i+1:]...)
+	k := key{n.Severity, n.Title, n.Message}
+	if c.byKey[k] == n {
+		delete(c.byKey, k)
+	}
+	if c.suppressed == n {
+		c.suppressed = nil
+	}
+}
@@ -0,0 +1,207 @@
+// notifications_test.go - tests of the notification center
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package notifications
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// clock is the manually advanced time of the center.
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newTestCenter() (*Center, *clock) {
+	clk := &clock{t: time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)}
+	c := NewCenter()
+	c.now = clk.now
+	return c, clk
+}
+
+func post(c *Center, severity Severity, msg string) Notification {
+	n, _ := c.Post(Notification{Severity: severity, Title: "Title", Message: msg})
+	return n
+}
+
+func TestDedup(t *testing.T) {
+	c, clk := newTestCenter()
+
+	first := post(c, Error, "failure")
+	clk.advance(DefaultDedupWindow / 2)
+	second := post(c, Error, "failure")
+	if second.ID != first.ID || second.Count != 2 || !second.First.Equal(first.First) || !second.Last.Equal(clk.now()) {
+		t.Fatalf("the message was not coalesced: %+v", second)
+	}
+
+	// the window is extended by every occurrence
+	clk.advance(DefaultDedupWindow / 2)
+	if n := post(c, Error, "failure"); n.ID != first.ID || n.Count != 3 {
+		t.Fatalf("the message was not coalesced: %+v", n)
+	}
+
+	// messages differing in any of severity, title or text are distinct
+	if n := post(c, Warning, "failure"); n.ID == first.ID {
+		t.Fatalf("messages of different severities were coalesced")
+	}
+	if n, _ := c.Post(Notification{Severity: Error, Title: "Other", Message: "failure"}); n.ID == first.ID {
+		t.Fatalf("messages of different titles were coalesced")
+	}
+
+	clk.advance(DefaultDedupWindow)
+	if n := post(c, Error, "failure"); n.ID == first.ID || n.Count != 1 {
+		t.Fatalf("the message was coalesced after the window: %+v", n)
+	}
+	if c.Len() != 4 {
+		t.Fatalf("expected 4 notifications, got %v", c.Len())
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	c, clk := newTestCenter()
+
+	accepted := make([]Notification, DefaultRateLimit)
+	for i := range accepted {
+		accepted[i] = post(c, Error, fmt.Sprintf("failure %v", i))
+		if accepted[i].Title != "Title" {
+			t.Fatalf("notification %v was suppressed", i)
+		}
+	}
+
+	var suppressed Notification
+	for i := 1; i <= 3; i++ {
+		suppressed = post(c, Error, fmt.Sprintf("suppressed %v", i))
+		if suppressed.Title != suppressedTitle || suppressed.Severity != Warning || suppressed.Count != i {
+			t.Fatalf("expected summary of %v suppressed notifications, got %+v", i, suppressed)
+		}
+	}
+	expected := "3 notifications arrived too quickly and were not shown, see the log for details"
+	if suppressed.Message != expected {
+		t.Errorf("expected the summary %q, got %q", expected, suppressed.Message)
+	}
+
+	// duplicates of the accepted notifications are still counted, as the dedup goes first
+	if n := post(c, Error, "failure 0"); n.ID != accepted[0].ID || n.Count != 2 {
+		t.Fatalf("the duplicate was not coalesced: %+v", n)
+	}
+	// critical notifications are never suppressed
+	if n := post(c, Critical, "critical"); n.Title != "Title" {
+		t.Fatalf("the critical notification was suppressed: %+v", n)
+	}
+	if c.Len() != DefaultRateLimit+2 {
+		t.Fatalf("expected %v notifications, got %v", DefaultRateLimit+2, c.Len())
+	}
+
+	// the limit applies to a sliding period
+	clk.advance(DefaultRatePeriod)
+	if n := post(c, Error, "later"); n.Title != "Title" {
+		t.Fatalf("the notification was suppressed after the rate period: %+v", n)
+	}
+}
+
+func TestSuppressedSummary(t *testing.T) {
+	c, clk := newTestCenter()
+
+	exceed := func(prefix string) Notification {
+		for i := 0; i < DefaultRateLimit; i++ {
+			post(c, Info, fmt.Sprintf("%v %v", prefix, i))
+		}
+		return post(c, Info, prefix+" suppressed")
+	}
+
+	first := exceed("first")
+	// the summary keeps counting within the dedup window
+	clk.advance(DefaultRatePeriod)
+	if n := exceed("second"); n.ID != first.ID || n.Count != 2 {
+		t.Fatalf("expected the summary to be updated, got %+v", n)
+	}
+
+	// a new summary is started afterwards
+	clk.advance(DefaultDedupWindow)
+	third := exceed("third")
+	if third.ID == first.ID || third.Count != 1 {
+		t.Fatalf("expected a new summary, got %+v", third)
+	}
+
+	// as well as once the previous one is dismissed
+	if !c.Dismiss(third.ID) {
+		t.Fatal("could not dismiss the summary")
+	}
+	if n := post(c, Info, "fourth suppressed"); n.Title != suppressedTitle || n.ID == third.ID || n.Count != 1 {
+		t.Fatalf("expected a new summary, got %+v", n)
+	}
+}
+
+func TestDismiss(t *testing.T) {
+	c, _ := newTestCenter()
+
+	first := post(c, Error, "failure")
+	post(c, Error, "other")
+	if !c.Dismiss(first.ID) {
+		t.Fatal("could not dismiss the notification")
+	}
+	if c.Dismiss(first.ID) {
+		t.Error("dismissed the notification twice")
+	}
+	if notifications := c.Notifications(); len(notifications) != 1 || notifications[0].Message != "other" {
+		t.Fatalf("unexpected notifications %+v", notifications)
+	}
+
+	// the dismissed message is no longer coalesced
+	if n := post(c, Error, "failure"); n.ID == first.ID || n.Count != 1 {
+		t.Fatalf("the message was coalesced with the dismissed one: %+v", n)
+	}
+
+	c.DismissAll()
+	if c.Len() != 0 {
+		t.Fatalf("expected no notifications, got %v", c.Len())
+	}
+}
+
+func TestPrune(t *testing.T) {
+	c, _ := newTestCenter()
+	c.maxItems = 3
+	c.rateLimit = 10
+
+	var ids []int
+	for i := 0; i < 5; i++ {
+		n, pruned := c.Post(Notification{Severity: Info, Title: "Title", Message: fmt.Sprint(i)})
+		ids = append(ids, n.ID)
+		if i < c.maxItems && len(pruned) != 0 {
+			t.Fatalf("pruned %v below the limit", pruned)
+		}
+		if i >= c.maxItems && (len(pruned) != 1 || pruned[0] != ids[i-c.maxItems]) {
+			t.Fatalf("expected the oldest notification %v to be pruned, got %v", ids[i-c.maxItems], pruned)
+		}
+	}
+
+	notifications := c.Notifications()
+	for i, n := range notifications {
+		if n.ID != ids[2+i] {
+			t.Errorf("expected notification %v, got %v", ids[2+i], n.ID)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// sensitive.go - secret material that can be wiped and is never formatted
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package sensitive wraps secret material, so that it could be explicitly overwritten once no longer needed
+// and would never end up in logs or error messages by accident.
+//
+// Wiping is best effort: the garbage collector might have already copied the data elsewhere
+// and any values derived from it are not affected.
+package sensitive
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"io"
+)
+
+// Redacted is what all the sensitive values are formatted as.
+const Redacted = "[REDACTED]"
+
+// Bytes holds secret bytes. The zero value, as well as nil, holds no data.
+type Bytes struct {
+	b []byte
+}
+
+// NewBytes copies the data into new Bytes.
+func NewBytes(data []byte) *Bytes {
+	b := make([]byte, len(data))
+	copy(b, data)
+	return &Bytes{b: b}
+}
+
+// Data returns the underlying data, which gets overwritten by Wipe. It must not be retained by the caller.
+func (s *Bytes) Data() []byte {
+	if s == nil {
+		return nil
+	}
+	return s.b
+}
+
+// Wipe overwrites the data with zeroes and releases it.
+func (s *Bytes) Wipe() {
+	if s == nil {
+		return
+	}
+	Zero(s.b)
+	s.b = nil
+}
+
+// String implements fmt.Stringer.
+func (s *Bytes) String() string {
+	return Redacted
+}
+
+// Format implements fmt.Formatter, so that the data would not be printed even with the %#v or %x verbs.
+func (s *Bytes) Format(f fmt.State, verb rune) {
+	io.WriteString(f, Redacted)
+}
+
+// MarshalText implements encoding.TextMarshaler, so that the data would not be revealed by the encoding packages either.
+func (s *Bytes) MarshalText() ([]byte, error) {
+	return []byte(Redacted), nil
+}
+
+// Zero overwrites the slice with zeroes.
+func Zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// WipeKey overwrites the private part of the ECDSA key.
+func WipeKey(key *ecdsa.PrivateKey) {
+	if key == nil || key.D == nil {
+		return
+	}
+	words := key.D.Bits()
+	for i := range words {
+		words[i] = 0
+	}
+	key.D.SetInt64(0)
+}
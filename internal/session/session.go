@@ -0,0 +1,645 @@
+// session.go - operations requested through the user interface
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package session performs the operations requested through the user interface on the wallet of the active account.
+// Instead of returning errors, it reports the outcome of every operation as a notification, which the interface
+// only has to display. It does not depend on Qt, so that all the slots of the bridge could be exercised without it.
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nymtech/qt-validator-client-demo/internal/backup"
+	"github.com/nymtech/qt-validator-client-demo/internal/jobs"
+	"github.com/nymtech/qt-validator-client-demo/internal/logging"
+	"github.com/nymtech/qt-validator-client-demo/internal/notifications"
+	"github.com/nymtech/qt-validator-client-demo/internal/wallet"
+)
+
+var log = logging.New("session")
+
+// The titles of the notifications, which also determine their severity.
+const (
+	// only the critical notifications interrupt the user, all the other ones go to the notification list
+	CriticalTitle = "Critical Error"
+	ErrorTitle    = "Error"
+	WarningTitle  = "Warning"
+	InfoTitle     = "Notification"
+)
+
+// amount of Nym requested from the faucet, for now just hardcode it
+const faucetAmount = 50
+
+var (
+	// ErrNoWallet is reported by the operations requested before any wallet was activated.
+	ErrNoWallet = errors.New("no wallet is open")
+	// ErrLocked is reported by the operations requested while the wallet of the active account is locked.
+	ErrLocked = errors.New("the wallet is locked - unlock it with its passphrase first")
+)
+
+// Hooks are the functions through which the session updates the user interface. Any of them may be nil.
+// They are called from arbitrary goroutines, hence they must not touch the interface directly.
+type Hooks struct {
+	// Notified is called with every posted notification and the identifiers of the ones it has displaced.
+	Notified func(n notifications.Notification, pruned []int)
+	// EthereumWaitOver is called whenever an operation stops waiting for the Ethereum transactions.
+	EthereumWaitOver func()
+}
+
+// Session holds the wallet of the active account and performs operations on it, either right away
+// or as jobs. Apart from the notification methods, it must only be used on a single goroutine,
+// such as the main thread of the application.
+type Session struct {
+	jobs          *jobs.Manager
+	notifications *notifications.Center
+	hooks         Hooks
+
+	// timeout of all the operations waiting for Ethereum or Nym blockchain
+	timeout time.Duration
+	// wallet of the active account, it is nil before any account is activated and while the wallet is locked
+	wallet  *wallet.Wallet
+	account string
+	locked  bool
+}
+
+// New creates a session without any active wallet. The caller remains responsible for draining the updates
+// of the job manager.
+func New(jobManager *jobs.Manager, center *notifications.Center, hooks Hooks) *Session {
+	return &Session{
+		jobs:          jobManager,
+		notifications: center,
+		hooks:         hooks,
+		timeout:       wallet.DefaultOperationTimeout,
+	}
+}
+
+// SetOperationTimeout changes the timeout of the operations started from now on.
+func (s *Session) SetOperationTimeout(timeout time.Duration) {
+	s.timeout = timeout
+}
+
+// Activate makes the wallet of the named account the target of all the operations.
+func (s *Session) Activate(account string, w *wallet.Wallet) {
+	s.wallet = w
+	s.account = account
+	s.locked = false
+}
+
+// Lock makes the session forget the active wallet. The name of the account is retained, so that it could be unlocked.
+func (s *Session) Lock() {
+	s.wallet = nil
+	s.locked = true
+}
+
+// Wallet returns the active wallet or nil if there is none.
+func (s *Session) Wallet() *wallet.Wallet {
+	return s.wallet
+}
+
+// Account returns the name of the active account, or the one that was active before the wallet got locked.
+func (s *Session) Account() string {
+	return s.account
+}
+
+// activeWallet returns the active wallet or, if there is none, notifies the user about why the operation
+// can't be performed.
+func (s *Session) activeWallet() (*wallet.Wallet, bool) {
+	if s.wallet == nil {
+		if s.locked {
+			s.NotifyError(ErrLocked)
+		} else {
+			s.NotifyError(ErrNoWallet)
+		}
+		return nil, false
+	}
+	return s.wallet, true
+}
+
+// Notifyf posts the formatted notification with the severity determined by the title.
+// It is safe to call it from any goroutine.
+func (s *Session) Notifyf(title string, fmtMessage string, a ...interface{}) {
+	msg := fmtMessage
+	if a != nil {
+		msg = fmt.Sprintf(fmtMessage, a...)
+	}
+
+	var severity notifications.Severity
+	switch title {
+	case CriticalTitle:
+		severity = notifications.Critical
+		log.Error("notification", "message", msg, "critical", true)
+	case ErrorTitle:
+		severity = notifications.Error
+		log.Error("notification", "message", msg)
+	case WarningTitle:
+		severity = notifications.Warning
+		log.Warning("notification", "message", msg)
+	default:
+		severity = notifications.Info
+		log.Info("notification", "message", msg)
+	}
+
+	s.notify(notifications.Notification{Severity: severity, Title: title, Message: msg})
+}
+
+// NotifyError notifies about the failure of an operation, explaining its cause and suggesting what to do about it
+// if it is recognised. It is safe to call it from any goroutine.
+func (s *Session) NotifyError(err error) {
+	category := wallet.ClassifyError(err)
+	if category == wallet.Uncategorized {
+		s.Notifyf(ErrorTitle, "%v", err)
+		return
+	}
+
+	explanation, action := category.Hint()
+	msg := fmt.Sprintf("%v\n\n%v %v", err, explanation, action)
+	log.Error("notification", "message", err, "category", category)
+	s.notify(notifications.Notification{
+		Severity: notifications.Error,
+		Title:    ErrorTitle,
+		Message:  msg,
+		Category: string(category),
+	})
+}
+
+func (s *Session) notify(notification notifications.Notification) {
+	n, pruned := s.notifications.Post(notification)
+	if s.hooks.Notified != nil {
+		s.hooks.Notified(n, pruned)
+	}
+}
+
+func (s *Session) ethereumWaitOver() {
+	if s.hooks.EthereumWaitOver != nil {
+		s.hooks.EthereumWaitOver()
+	}
+}
+
+// StartJob starts the operation as a new job, bounded by the operation timeout, and returns its identifier.
+// Failure of the job is reported to the user.
+func (s *Session) StartJob(name string, fn jobs.Func) int {
+	timeout := s.timeout
+	id := s.jobs.Start(name, timeout, func(ctx context.Context) error {
+		err := fn(ctx)
+		if err != nil {
+			s.notifyOperationError(ctx, timeout, err)
+		} else {
+			log.Debug("operation finished", "operation", name)
+		}
+		return err
+	})
+	log.Debug("operation started", "operation", name, "job", id, "timeout", timeout)
+	return id
+}
+
+// notifyOperationError notifies the user about failure of the operation, unless it was cancelled on their request.
+func (s *Session) notifyOperationError(ctx context.Context, timeout time.Duration, err error) {
+	switch ctx.Err() {
+	case context.Canceled:
+		s.Notifyf(InfoTitle, "The operation was cancelled")
+	case context.DeadlineExceeded:
+		s.Notifyf(ErrorTitle, "The operation did not complete within %v seconds: %v", int(timeout/time.Second), err)
+	default:
+		s.NotifyError(err)
+	}
+}
+
+func (s *Session) updateBalances(w *wallet.Wallet) {
+	_, err := w.UpdateBalances()
+	if err == nil {
+		return
+	}
+
+	balanceErr, ok := err.(*wallet.BalanceError)
+	if !ok {
+		s.Notifyf(ErrorTitle, "%v", err)
+		return
+	}
+	if balanceErr.ERC20 != nil {
+		s.Notifyf(ErrorTitle, "failed to query for ERC20 Nym Balance: %v", balanceErr.ERC20)
+	}
+	if balanceErr.ERC20Pending != nil {
+		s.Notifyf(ErrorTitle, "failed to query for ERC20 Nym Balance (pending): %v", balanceErr.ERC20Pending)
+	}
+	if balanceErr.Nym != nil {
+		s.Notifyf(WarningTitle, "failed to query for Nym Token Balance: %v\n\nIf your account does not exist, please make sure you did register it (by clicking 'REGISTER ACCOUNT' button",
+			balanceErr.Nym,
+		)
+	}
+}
+
+// parseNym parses the amount of Nym, optionally followed by the unit, as displayed by the interface.
+func parseNym(amount string) (int64, error) {
+	return strconv.ParseInt(strings.TrimSpace(strings.TrimSuffix(amount, "Nym")), 10, 64)
+}
+
+// UpdateBalances queries all the balances of the active wallet in a job, which returns -1 if it could not be started.
+func (s *Session) UpdateBalances() int {
+	w, ok := s.activeWallet()
+	if !ok {
+		return -1
+	}
+
+	// jobs keep using the wallet of the account that was active when they were started
+	return s.StartJob("Update balances", func(ctx context.Context) error {
+		s.updateBalances(w)
+		return nil
+	})
+}
+
+// SendToPipeAccount transfers the ERC20 Nym to the pipe account in a job, which returns -1 if it could not be started.
+func (s *Session) SendToPipeAccount(amount string) int {
+	w, ok := s.activeWallet()
+	if !ok {
+		return -1
+	}
+
+	amountInt64, err := strconv.ParseInt(amount, 10, 64)
+	if err != nil {
+		s.Notifyf(ErrorTitle, "could not parse the value: %v", err)
+		return -1
+	}
+
+	return s.StartJob(fmt.Sprintf("Send %v to Nym", amountInt64), func(ctx context.Context) error {
+		defer s.ethereumWaitOver()
+		return w.SendToPipeAccount(ctx, amountInt64)
+	})
+}
+
+// RedeemTokens redeems the Nym tokens for ERC20 Nym in a job, which returns -1 if it could not be started.
+func (s *Session) RedeemTokens(amount string) int {
+	w, ok := s.activeWallet()
+	if !ok {
+		return -1
+	}
+
+	amountInt64, err := strconv.ParseInt(amount, 10, 64)
+	if err != nil {
+		s.Notifyf(ErrorTitle, "could not parse the value: %v", err)
+		return -1
+	}
+
+	return s.StartJob(fmt.Sprintf("Redeem %v tokens", amountInt64), func(ctx context.Context) error {
+		defer s.ethereumWaitOver()
+		return w.RedeemTokens(ctx, amountInt64)
+	})
+}
+
+// GetCredential obtains a credential of the value in a job, which returns -1 if it could not be started.
+func (s *Session) GetCredential(value string) int {
+	w, ok := s.activeWallet()
+	if !ok {
+		return -1
+	}
+
+	valueInt64, err := parseNym(value)
+	if err != nil {
+		s.Notifyf(ErrorTitle, "could not parse the value: %v", err)
+		return -1
+	}
+
+	return s.StartJob(fmt.Sprintf("Get %vNym credential", valueInt64), func(ctx context.Context) error {
+		cred, err := w.GetCredential(ctx, valueInt64)
+		if cred != nil {
+			s.updateBalances(w)
+		}
+		return err
+	})
+}
+
+// GetCredentialsForAmount obtains credentials worth the amount in total, split into the allowed values,
+// in a job, which returns -1 if it could not be started.
+func (s *Session) GetCredentialsForAmount(amount string) int {
+	w, ok := s.activeWallet()
+	if !ok {
+		return -1
+	}
+
+	amountInt64, err := parseNym(amount)
+	if err != nil {
+		s.Notifyf(ErrorTitle, "could not parse the amount: %v", err)
+		return -1
+	}
+	values, err := wallet.SplitAmount(amountInt64, w.AllowedValues())
+	if err != nil {
+		s.Notifyf(ErrorTitle, "%v", err)
+		return -1
+	}
+
+	return s.StartJob(fmt.Sprintf("Get %v credentials worth %vNym", len(values), amountInt64), func(ctx context.Context) error {
+		res, err := w.GetCredentialsForAmount(ctx, amountInt64)
+		s.reportBatch(w, res, err)
+		return err
+	})
+}
+
+// GetCredentialBatch concurrently obtains count credentials of the value in a job, which returns -1
+// if it could not be started.
+func (s *Session) GetCredentialBatch(value string, count int) int {
+	w, ok := s.activeWallet()
+	if !ok {
+		return -1
+	}
+
+	valueInt64, err := parseNym(value)
+	if err != nil {
+		s.Notifyf(ErrorTitle, "could not parse the value: %v", err)
+		return -1
+	}
+
+	return s.StartJob(fmt.Sprintf("Get %v x %vNym credentials", count, valueInt64), func(ctx context.Context) error {
+		res, err := w.GetCredentialBatch(ctx, valueInt64, count)
+		s.reportBatch(w, res, err)
+		return err
+	})
+}
+
+// reportBatch summarizes the batch once it is done, the failures are reported by the job itself.
+// The credentials are displayed one by one as they get obtained.
+func (s *Session) reportBatch(w *wallet.Wallet, res *wallet.BatchResult, err error) {
+	if res == nil {
+		return
+	}
+	s.updateBalances(w)
+	log.Info("credential batch finished", "requested", len(res.Values), "obtained", len(res.Obtained),
+		"failed", len(res.Failures), "duration", res.Duration, "throughput", res.Throughput())
+	if err == nil {
+		s.Notifyf(InfoTitle, "Obtained %v credentials worth %v Nym in %.1f seconds (%.2f credentials per second)",
+			len(res.Obtained), res.ObtainedAmount(), res.Duration.Seconds(), res.Throughput())
+	}
+}
+
+// SpendCredential spends the credential at the service provider in a job, which returns -1 if it could not be started.
+// Force is required to spend a credential that is known to be spent already.
+func (s *Session) SpendCredential(chosenSP, seqString string, force bool) int {
+	w, ok := s.activeWallet()
+	if !ok {
+		return -1
+	}
+
+	return s.StartJob(fmt.Sprintf("Spend credential at %v", chosenSP), func(ctx context.Context) error {
+		res, err := w.SpendCredential(ctx, chosenSP, seqString, force)
+		if res != nil {
+			if res.Accepted {
+				s.Notifyf(InfoTitle, "We successfully managed to spend credential with value of %v Nyms at SP (%v) with address %v!", res.Value, res.ServiceProvider, res.ServiceProviderAccount)
+			} else {
+				s.Notifyf(InfoTitle, "We failed to spend credential with value of %v Nyms at SP (%v) with address %v - it had already been spent", res.Value, res.ServiceProvider, res.ServiceProviderAccount)
+			}
+		}
+		return err
+	})
+}
+
+// RegisterAccount registers the account on the Nym blockchain in a job, which returns -1 if it could not be started.
+func (s *Session) RegisterAccount() int {
+	w, ok := s.activeWallet()
+	if !ok {
+		return -1
+	}
+
+	return s.StartJob("Register account", func(ctx context.Context) error {
+		return w.RegisterAccount()
+	})
+}
+
+// GetFaucetNym requests Nym from the faucet in a job, which returns -1 if it could not be started.
+func (s *Session) GetFaucetNym() int {
+	w, ok := s.activeWallet()
+	if !ok {
+		return -1
+	}
+
+	return s.StartJob(fmt.Sprintf("Request %v Nym from faucet", faucetAmount), func(ctx context.Context) error {
+		defer s.ethereumWaitOver()
+
+		if err := w.GetFaucetNym(ctx, faucetAmount); err != nil {
+			return err
+		}
+
+		s.updateBalances(w)
+		s.Notifyf(InfoTitle, "Received %v Nym from the faucet (+ some Ether for transaction fees) from the faucet!", faucetAmount)
+		return nil
+	})
+}
+
+// StartCredentialPool starts replenishing the credential pool of the active wallet in the background,
+// the targets are in the <value>:<target>:<threshold> format.
+func (s *Session) StartCredentialPool(targets []string, budget string) bool {
+	w, ok := s.activeWallet()
+	if !ok {
+		return false
+	}
+
+	budgetInt64, err := parseNym(budget)
+	if err != nil {
+		s.Notifyf(ErrorTitle, "could not parse the budget: %v", err)
+		return false
+	}
+	cfg := wallet.PoolConfig{Targets: make(map[int64]wallet.PoolTarget), Budget: budgetInt64}
+	for _, t := range targets {
+		value, target, err := wallet.ParsePoolTarget(t)
+		if err != nil {
+			s.Notifyf(ErrorTitle, "%v", err)
+			return false
+		}
+		cfg.Targets[value] = target
+	}
+
+	if err := w.StartPool(cfg); err != nil {
+		s.Notifyf(ErrorTitle, "could not start the credential pool: %v", err)
+		return false
+	}
+	log.Info("credential pool started", "account", s.account, "targets", targets, "budget", budgetInt64)
+	return true
+}
+
+// StopCredentialPool stops the credential pool of the active wallet, if any.
+func (s *Session) StopCredentialPool() {
+	if s.wallet == nil {
+		return
+	}
+	s.wallet.StopPool()
+	log.Info("credential pool stopped", "account", s.account)
+}
+
+// PoolStatus describes the state of the credential pool of the active wallet. Without a wallet, the pool
+// is not running and the description is empty.
+func (s *Session) PoolStatus() (bool, string) {
+	if s.wallet == nil {
+		return false, ""
+	}
+
+	status := s.wallet.PoolStatus()
+	values := make([]int64, 0, len(status.Unspent))
+	for value := range status.Unspent {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	unspent := make([]string, len(values))
+	for i, value := range values {
+		unspent[i] = fmt.Sprintf("%v x %vNym", status.Unspent[value], value)
+	}
+
+	msg := fmt.Sprintf("Unspent credentials: %v", strings.Join(unspent, ", "))
+	if len(unspent) == 0 {
+		msg = "No unspent credentials"
+	}
+	if status.Running {
+		msg += fmt.Sprintf("\nSpent %v of the %v Nym budget on replenishing", status.Spent, status.Budget)
+		if status.LastError != "" {
+			msg += fmt.Sprintf("\nLast failure: %v", status.LastError)
+		}
+	}
+	return status.Running, msg
+}
+
+// RandomizeCredential returns the re-randomized credential or an empty string on failure.
+func (s *Session) RandomizeCredential(seqString string) string {
+	w, ok := s.activeWallet()
+	if !ok {
+		return ""
+	}
+
+	rcred, err := w.RandomizeCredential(seqString)
+	if err != nil {
+		s.Notifyf(ErrorTitle, "%v", err)
+	}
+	return rcred
+}
+
+// GenerateSecret generates a fresh long-term secret for the active wallet.
+func (s *Session) GenerateSecret() bool {
+	w, ok := s.activeWallet()
+	if !ok {
+		return false
+	}
+
+	if err := w.GenerateSecret(); err != nil {
+		s.Notifyf(ErrorTitle, "%v", err)
+		return false
+	}
+	return true
+}
+
+// ImportSecret sets the hex encoded long-term secret of the active wallet.
+func (s *Session) ImportSecret(hexSecret string) bool {
+	w, ok := s.activeWallet()
+	if !ok {
+		return false
+	}
+
+	if err := w.ImportSecret(hexSecret); err != nil {
+		s.Notifyf(ErrorTitle, "%v", err)
+		return false
+	}
+	return true
+}
+
+// ImportMnemonic sets the long-term secret of the active wallet derived from the seed phrase.
+func (s *Session) ImportMnemonic(phrase string) bool {
+	w, ok := s.activeWallet()
+	if !ok {
+		return false
+	}
+
+	if err := w.ImportMnemonic(phrase); err != nil {
+		s.Notifyf(ErrorTitle, "%v", err)
+		return false
+	}
+	return true
+}
+
+// ExportSecret returns the hex encoded long-term secret of the active wallet or an empty string on failure.
+func (s *Session) ExportSecret() string {
+	w, ok := s.activeWallet()
+	if !ok {
+		return ""
+	}
+
+	secret, err := w.ExportSecret()
+	if err != nil {
+		s.Notifyf(ErrorTitle, "%v", err)
+		return ""
+	}
+	return secret
+}
+
+// ExportBackup saves the backup of the config, the account key and the active wallet to the file.
+func (s *Session) ExportBackup(file, cfgFile, passphrase string) bool {
+	w, ok := s.activeWallet()
+	if !ok {
+		return false
+	}
+
+	if err := backup.Export(file, cfgFile, w, passphrase); err != nil {
+		s.Notifyf(ErrorTitle, "could not export the backup: %v", err)
+		return false
+	}
+	log.Info("backup exported", "file", file, "account", s.account)
+	s.Notifyf(InfoTitle, "The backup was saved to %v. It is encrypted with the passphrase of the wallet.", file)
+	return true
+}
+
+// EncryptAccountKey encrypts the account key of the active wallet with the passphrase.
+func (s *Session) EncryptAccountKey(passphrase string) bool {
+	w, ok := s.activeWallet()
+	if !ok {
+		return false
+	}
+
+	if err := w.EncryptKey(passphrase); err != nil {
+		s.Notifyf(ErrorTitle, "%v", err)
+		return false
+	}
+	s.Notifyf(InfoTitle, "The account key is now encrypted with the passphrase of the wallet")
+	return true
+}
+
+// ChangePassphrase re-encrypts the active wallet and its account key with the new passphrase.
+func (s *Session) ChangePassphrase(oldPassphrase, newPassphrase string) bool {
+	w, ok := s.activeWallet()
+	if !ok {
+		return false
+	}
+
+	if err := w.ChangePassphrase(oldPassphrase, newPassphrase); err != nil {
+		s.Notifyf(ErrorTitle, "could not change the passphrase: %v", err)
+		return false
+	}
+	s.Notifyf(InfoTitle, "The passphrase was changed")
+	return true
+}
+
+// AccountExists checks whether the account of the active wallet is registered on the Nym blockchain.
+func (s *Session) AccountExists() bool {
+	w, ok := s.activeWallet()
+	if !ok {
+		return false
+	}
+
+	exists, err := w.AccountExists()
+	if err != nil {
+		s.Notifyf(ErrorTitle, "%v", err)
+		return false
+	}
+	return exists
+}
@@ -0,0 +1,440 @@
+// session_test.go - tests of the operations requested through the user interface
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package session_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nymtech/nym-validator/client/config"
+	"github.com/nymtech/qt-validator-client-demo/internal/jobs"
+	"github.com/nymtech/qt-validator-client-demo/internal/notifications"
+	"github.com/nymtech/qt-validator-client-demo/internal/session"
+	"github.com/nymtech/qt-validator-client-demo/internal/wallet"
+	"github.com/nymtech/qt-validator-client-demo/internal/wallet/fake"
+)
+
+const (
+	testPassphrase = "correct horse battery staple"
+	testAccount    = "default"
+	testTimeout    = 30 * time.Second
+)
+
+// testSession is a session whose job updates and wallet events are drained in the background.
+// It records all the notifications passed to the interface.
+type testSession struct {
+	*session.Session
+	jobs   *jobs.Manager
+	client *fake.Client
+	wallet *wallet.Wallet
+	dir    string
+
+	ethereumWaits int32
+
+	notifiedLock sync.Mutex
+	notified     []notifications.Notification
+}
+
+// newTestSession creates the session without any active wallet.
+func newTestSession() *testSession {
+	ts := &testSession{jobs: jobs.NewManager(4, 100)}
+	go func() {
+		for range ts.jobs.Updates() {
+		}
+	}()
+	ts.Session = session.New(ts.jobs, notifications.NewCenter(), session.Hooks{
+		Notified: func(n notifications.Notification, pruned []int) {
+			ts.notifiedLock.Lock()
+			defer ts.notifiedLock.Unlock()
+			ts.notified = append(ts.notified, n)
+		},
+		EthereumWaitOver: func() { atomic.AddInt32(&ts.ethereumWaits, 1) },
+	})
+	return ts
+}
+
+// newActiveTestSession creates the session with an active wallet backed by the fake client. The wallet has
+// a long-term secret and its account exists, holding 100 ERC20 Nym and 100 Nym.
+func newActiveTestSession(t *testing.T) *testSession {
+	dir, err := ioutil.TempDir("", "nym-session-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfgFile, err := fake.WriteConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadFile(cfgFile)
+	if err != nil {
+		t.Fatalf("could not load the test config: %v", err)
+	}
+
+	ts := newTestSession()
+	ts.dir = dir
+	ts.client = fake.NewClient(100)
+	ts.client.SetBalances(100, 0, 100)
+	ts.client.SetAccountExists(true)
+
+	ts.wallet = wallet.NewWithClient(cfg, ts.client)
+	go func() {
+		for range ts.wallet.Events() {
+		}
+	}()
+	if err := ts.wallet.CreateStore(testPassphrase); err != nil {
+		t.Fatalf("could not create the wallet: %v", err)
+	}
+	if err := ts.wallet.GenerateSecret(); err != nil {
+		t.Fatalf("could not generate the long-term secret: %v", err)
+	}
+	ts.Activate(testAccount, ts.wallet)
+	return ts
+}
+
+func (ts *testSession) close() {
+	if ts.wallet != nil {
+		ts.wallet.Wipe()
+		ts.wallet.Close()
+	}
+	if ts.dir != "" {
+		os.RemoveAll(ts.dir)
+	}
+}
+
+func (ts *testSession) notifications() []notifications.Notification {
+	ts.notifiedLock.Lock()
+	defer ts.notifiedLock.Unlock()
+	return append([]notifications.Notification{}, ts.notified...)
+}
+
+// expectNotification checks that the most recent notification has the severity and the message starting with the prefix.
+func (ts *testSession) expectNotification(t *testing.T, severity notifications.Severity, prefix string) notifications.Notification {
+	t.Helper()
+	notified := ts.notifications()
+	if len(notified) == 0 {
+		t.Fatalf("expected a notification starting with %q, got none", prefix)
+	}
+	n := notified[len(notified)-1]
+	if n.Severity != severity || !strings.HasPrefix(n.Message, prefix) {
+		t.Fatalf("expected %v notification starting with %q, got %v notification %q", severity, prefix, n.Severity, n.Message)
+	}
+	return n
+}
+
+func (ts *testSession) expectNoErrors(t *testing.T) {
+	t.Helper()
+	for _, n := range ts.notifications() {
+		if n.Severity >= notifications.Error {
+			t.Fatalf("unexpected %v notification %q", n.Severity, n.Message)
+		}
+	}
+}
+
+// waitForJob waits until the job finishes and checks its final state.
+func (ts *testSession) waitForJob(t *testing.T, id int, state jobs.State) jobs.Job {
+	t.Helper()
+	if id < 0 {
+		t.Fatalf("the job was not started")
+	}
+	deadline := time.Now().Add(testTimeout)
+	for time.Now().Before(deadline) {
+		for _, job := range ts.jobs.Jobs() {
+			if job.ID != id || !job.State.Finished() {
+				continue
+			}
+			if job.State != state {
+				t.Fatalf("expected the job to be %v, got %v (%v)", state, job.State, job.Err)
+			}
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("the job did not finish within %v", testTimeout)
+	return jobs.Job{}
+}
+
+func (ts *testSession) smallestValue() int64 {
+	values := ts.wallet.AllowedValues()
+	smallest := values[0]
+	for _, v := range values {
+		if v < smallest {
+			smallest = v
+		}
+	}
+	return smallest
+}
+
+func (ts *testSession) getCredential(t *testing.T) wallet.Credential {
+	t.Helper()
+	ts.waitForJob(t, ts.GetCredential(fmt.Sprintf("%vNym", ts.smallestValue())), jobs.Succeeded)
+	creds := ts.wallet.Credentials()
+	if len(creds) == 0 {
+		t.Fatal("no credential was obtained")
+	}
+	return creds[len(creds)-1]
+}
+
+// expectRejected calls all the operations and checks that each of them failed without starting any job
+// and notified the user with the message.
+func expectRejected(t *testing.T, ts *testSession, message string) {
+	t.Helper()
+	calls := []struct {
+		name string
+		ok   bool
+	}{
+		{"UpdateBalances", ts.UpdateBalances() != -1},
+		{"SendToPipeAccount", ts.SendToPipeAccount("10") != -1},
+		{"RedeemTokens", ts.RedeemTokens("10") != -1},
+		{"GetCredential", ts.GetCredential("1Nym") != -1},
+		{"GetCredentialsForAmount", ts.GetCredentialsForAmount("10Nym") != -1},
+		{"GetCredentialBatch", ts.GetCredentialBatch("1Nym", 2) != -1},
+		{"SpendCredential", ts.SpendCredential(fake.ServiceProvider, "42", false) != -1},
+		{"RegisterAccount", ts.RegisterAccount() != -1},
+		{"GetFaucetNym", ts.GetFaucetNym() != -1},
+		{"StartCredentialPool", ts.StartCredentialPool([]string{"1:2:1"}, "10Nym")},
+		{"RandomizeCredential", ts.RandomizeCredential("42") != ""},
+		{"GenerateSecret", ts.GenerateSecret()},
+		{"ImportSecret", ts.ImportSecret("00")},
+		{"ImportMnemonic", ts.ImportMnemonic("abandon")},
+		{"ExportSecret", ts.ExportSecret() != ""},
+		{"ExportBackup", ts.ExportBackup("backup", "config.toml", testPassphrase)},
+		{"EncryptAccountKey", ts.EncryptAccountKey(testPassphrase)},
+		{"ChangePassphrase", ts.ChangePassphrase(testPassphrase, "new passphrase")},
+		{"AccountExists", ts.AccountExists()},
+	}
+	for _, call := range calls {
+		if call.ok {
+			t.Errorf("%v succeeded", call.name)
+		}
+	}
+
+	if started := len(ts.jobs.Jobs()); started != 0 {
+		t.Errorf("expected no jobs to be started, got %v", started)
+	}
+	notified := ts.notifications()
+	if len(notified) != len(calls) {
+		t.Fatalf("expected %v notifications, got %v", len(calls), len(notified))
+	}
+	for _, n := range notified {
+		if n.Severity != notifications.Error || n.Message != message {
+			t.Fatalf("expected error notification %q, got %v notification %q", message, n.Severity, n.Message)
+		}
+	}
+	// the identical notifications are merged into one
+	if last := notified[len(notified)-1]; last.Count != len(calls) {
+		t.Errorf("expected the notification to be counted %v times, got %v", len(calls), last.Count)
+	}
+
+	ts.StopCredentialPool()
+	if running, status := ts.PoolStatus(); running || status != "" {
+		t.Errorf("expected no pool status, got %v and %q", running, status)
+	}
+}
+
+func TestNoWallet(t *testing.T) {
+	ts := newTestSession()
+	expectRejected(t, ts, session.ErrNoWallet.Error())
+	if ts.Wallet() != nil || ts.Account() != "" {
+		t.Errorf("expected no active wallet")
+	}
+}
+
+func TestLocked(t *testing.T) {
+	ts := newActiveTestSession(t)
+	defer ts.close()
+
+	ts.Lock()
+	expectRejected(t, ts, session.ErrLocked.Error())
+	if ts.Wallet() != nil {
+		t.Errorf("the wallet remains active after locking")
+	}
+	if ts.Account() != testAccount {
+		t.Errorf("expected the account %v to be retained, got %v", testAccount, ts.Account())
+	}
+}
+
+func TestInvalidInput(t *testing.T) {
+	ts := newActiveTestSession(t)
+	defer ts.close()
+
+	if ts.SendToPipeAccount("ten") != -1 {
+		t.Errorf("started sending an unparsable amount")
+	}
+	ts.expectNotification(t, notifications.Error, "could not parse the value")
+
+	if ts.GetCredential("Nym") != -1 {
+		t.Errorf("started obtaining credential of an unparsable value")
+	}
+	ts.expectNotification(t, notifications.Error, "could not parse the value")
+
+	if ts.GetCredentialsForAmount("-10Nym") != -1 {
+		t.Errorf("started obtaining credentials for a negative amount")
+	}
+	ts.expectNotification(t, notifications.Error, "")
+
+	if ts.StartCredentialPool([]string{"bogus"}, "10Nym") {
+		t.Errorf("started the pool with an invalid target")
+	}
+	ts.expectNotification(t, notifications.Error, "")
+
+	if started := len(ts.jobs.Jobs()); started != 0 {
+		t.Errorf("expected no jobs to be started, got %v", started)
+	}
+}
+
+func TestGetCredential(t *testing.T) {
+	ts := newActiveTestSession(t)
+	defer ts.close()
+
+	cred := ts.getCredential(t)
+	if cred.Value != ts.smallestValue() || cred.State != wallet.Unspent {
+		t.Errorf("unexpected credential %+v", cred)
+	}
+	ts.expectNoErrors(t)
+}
+
+func TestGetCredentialFailure(t *testing.T) {
+	ts := newActiveTestSession(t)
+	defer ts.close()
+
+	ts.client.SetBalances(100, 0, 0)
+	ts.waitForJob(t, ts.GetCredential(fmt.Sprintf("%vNym", ts.smallestValue())), jobs.Failed)
+
+	// the failure is classified and the notification explains what to do about it
+	n := ts.expectNotification(t, notifications.Error, "")
+	explanation, action := wallet.InsufficientBalance.Hint()
+	if n.Category != string(wallet.InsufficientBalance) || !strings.HasSuffix(n.Message, explanation+" "+action) {
+		t.Errorf("expected the hint of category %v, got %v notification %q", wallet.InsufficientBalance, n.Category, n.Message)
+	}
+}
+
+func TestGetCredentialBatch(t *testing.T) {
+	ts := newActiveTestSession(t)
+	defer ts.close()
+
+	ts.waitForJob(t, ts.GetCredentialBatch(fmt.Sprintf("%vNym", ts.smallestValue()), 3), jobs.Succeeded)
+	ts.expectNotification(t, notifications.Info, "Obtained 3 credentials")
+	if creds := ts.wallet.Credentials(); len(creds) != 3 {
+		t.Errorf("expected 3 credentials, got %v", len(creds))
+	}
+}
+
+func TestSpendCredential(t *testing.T) {
+	ts := newActiveTestSession(t)
+	defer ts.close()
+
+	cred := ts.getCredential(t)
+	ts.waitForJob(t, ts.SpendCredential(fake.ServiceProvider, cred.ID, false), jobs.Succeeded)
+	ts.expectNotification(t, notifications.Info, "We successfully managed to spend")
+
+	// spending it again requires force
+	ts.waitForJob(t, ts.SpendCredential(fake.ServiceProvider, cred.ID, false), jobs.Failed)
+	ts.expectNotification(t, notifications.Error, wallet.ErrCredentialSpent.Error())
+}
+
+func TestGetFaucetNym(t *testing.T) {
+	ts := newActiveTestSession(t)
+	defer ts.close()
+
+	ts.waitForJob(t, ts.GetFaucetNym(), jobs.Succeeded)
+	ts.expectNotification(t, notifications.Info, "Received 50 Nym")
+	if waits := atomic.LoadInt32(&ts.ethereumWaits); waits != 1 {
+		t.Errorf("expected the interface to stop waiting for Ethereum once, got %v", waits)
+	}
+	ts.expectNoErrors(t)
+}
+
+func TestSendToPipeAccountFailure(t *testing.T) {
+	ts := newActiveTestSession(t)
+	defer ts.close()
+
+	ts.waitForJob(t, ts.SendToPipeAccount("1000"), jobs.Failed)
+	ts.expectNotification(t, notifications.Error, "")
+	// the interface stops waiting regardless of the outcome
+	if waits := atomic.LoadInt32(&ts.ethereumWaits); waits != 1 {
+		t.Errorf("expected the interface to stop waiting for Ethereum once, got %v", waits)
+	}
+}
+
+func TestJobInterrupted(t *testing.T) {
+	ts := newTestSession()
+	started := make(chan struct{}, 2)
+	wait := func(ctx context.Context) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	// a job cancelled while still queued would not even be run
+	id := ts.StartJob("Wait", wait)
+	<-started
+	if !ts.jobs.Cancel(id) {
+		t.Fatal("could not cancel the job")
+	}
+	ts.waitForJob(t, id, jobs.Cancelled)
+	ts.expectNotification(t, notifications.Info, "The operation was cancelled")
+
+	ts.SetOperationTimeout(10 * time.Millisecond)
+	ts.waitForJob(t, ts.StartJob("Wait", wait), jobs.Failed)
+	ts.expectNotification(t, notifications.Error, "The operation did not complete within")
+}
+
+func TestSecret(t *testing.T) {
+	ts := newActiveTestSession(t)
+	defer ts.close()
+
+	if ts.ExportSecret() == "" {
+		t.Fatal("could not export the secret")
+	}
+	// the secret is never replaced
+	if ts.ImportSecret("00") || ts.GenerateSecret() {
+		t.Fatal("replaced the existing secret")
+	}
+	ts.expectNotification(t, notifications.Error, "")
+}
+
+func TestNotifySeverity(t *testing.T) {
+	ts := newTestSession()
+	for title, severity := range map[string]notifications.Severity{
+		session.CriticalTitle: notifications.Critical,
+		session.ErrorTitle:    notifications.Error,
+		session.WarningTitle:  notifications.Warning,
+		session.InfoTitle:     notifications.Info,
+	} {
+		ts.Notifyf(title, "%v notification", title)
+		ts.expectNotification(t, severity, title+" notification")
+	}
+}
+
+func TestPoolStatus(t *testing.T) {
+	ts := newActiveTestSession(t)
+	defer ts.close()
+
+	if running, status := ts.PoolStatus(); running || status != "No unspent credentials" {
+		t.Errorf("unexpected pool status %v and %q", running, status)
+	}
+	ts.getCredential(t)
+	if _, status := ts.PoolStatus(); status != fmt.Sprintf("Unspent credentials: 1 x %vNym", ts.smallestValue()) {
+		t.Errorf("unexpected pool status %q", status)
+	}
+}
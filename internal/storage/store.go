@@ -0,0 +1,584 @@
+// store.go - passphrase-encrypted on-disk wallet store
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package storage defines the encrypted wallet file in which credentials
+// obtained by the client are kept between the sessions.
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nymtech/qt-validator-client-demo/internal/sensitive"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	fileVersion = 1
+
+	// scrypt parameters, identical to the 'standard' ones used by the Ethereum keystore
+	scryptN      = 1 << 18
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+
+	saltLength  = 32
+	nonceLength = 24
+)
+
+var (
+	// ErrInvalidPassphrase is returned when the wallet file could not be decrypted with the provided passphrase.
+	ErrInvalidPassphrase = errors.New("could not decrypt the wallet - invalid passphrase?")
+	// ErrUnknownCredential is returned when the store does not contain credential with the given ID.
+	ErrUnknownCredential = errors.New("no credential exists with that identifier")
+	// ErrDuplicateCredential is returned on attempt to add credential with already existing ID.
+	ErrDuplicateCredential = errors.New("credential with that identifier already exists")
+	// ErrSecretExists is returned on attempt to overwrite the long-term secret already held in the wallet.
+	ErrSecretExists = errors.New("the wallet already contains a long-term secret")
+	// ErrClosed is returned on attempt to modify the wallet after it was closed.
+	ErrClosed = errors.New("the wallet is closed")
+	// ErrNotExist is returned on attempt to open a wallet that was not created yet.
+	ErrNotExist = errors.New("the wallet does not exist")
+	// ErrExists is returned on attempt to create a wallet in place of an existing file.
+	ErrExists = errors.New("the wallet file already exists")
+)
+
+// CredentialRecord represents a single issued credential alongside all attributes of
+// the token it was issued for, so that it could still be spent after the application is restarted.
+type CredentialRecord struct {
+	// ID is the stringified sequence number of the token, it uniquely identifies the credential.
+	ID string `json:"id"`
+	// Sequence is the byte representation of the sequence number of the token.
+	Sequence []byte `json:"sequence"`
+	// PrivateKey is the byte representation of the private attribute of the token.
+	PrivateKey []byte `json:"privateKey"`
+	// Value is the value of the token in Nyms.
+	Value int64 `json:"value"`
+	// Signature is the binary representation of the obtained coconut credential.
+	Signature []byte `json:"signature"`
+	// Spent indicates whether the credential was already spent at some service provider.
+	Spent bool `json:"spent"`
+	// Obtained is the time at which the credential was issued.
+	Obtained time.Time `json:"obtained"`
+}
+
+// clone returns copy of the record which shares no buffers with the original, so that wiping one leaves the other intact.
+func (rec *CredentialRecord) clone() CredentialRecord {
+	c := *rec
+	c.Sequence = copyBytes(rec.Sequence)
+	c.PrivateKey = copyBytes(rec.PrivateKey)
+	c.Signature = copyBytes(rec.Signature)
+	return c
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
+
+// LedgerRecord represents a single operation performed with the wallet, whether it succeeded or not.
+type LedgerRecord struct {
+	// Type identifies the kind of the operation.
+	Type string `json:"type"`
+	// Time is the time at which the operation has finished.
+	Time time.Time `json:"time"`
+	// Amount is the number of Nyms involved in the operation.
+	Amount int64 `json:"amount"`
+	// EthereumTxs are hex encoded hashes of the Ethereum transactions made by the operation, if known.
+	EthereumTxs []string `json:"ethereumTxs,omitempty"`
+	// TendermintResult describes the outcome of the operation as reported by the Nym blockchain, if any.
+	TendermintResult string `json:"tendermintResult,omitempty"`
+	// Details contains any additional operation-specific information, such as the service provider.
+	Details string `json:"details,omitempty"`
+	// Success indicates whether the operation has completed successfully.
+	Success bool `json:"success"`
+	// Error is the reason of failure of the operation.
+	Error string `json:"error,omitempty"`
+	// ErrorCategory is the recognised cause of the failure, if any.
+	ErrorCategory string `json:"errorCategory,omitempty"`
+}
+
+// walletData is the plaintext content of the wallet file.
+type walletData struct {
+	// Secret is the byte representation of the coconut long-term secret of the account.
+	Secret      []byte              `json:"secret,omitempty"`
+	Credentials []*CredentialRecord `json:"credentials"`
+	// Ledger is the history of all operations, ordered by time. It is absent in wallets created before it was introduced.
+	Ledger []*LedgerRecord `json:"ledger,omitempty"`
+}
+
+// Snapshot is the entire content of the wallet, as included in the backups.
+type Snapshot struct {
+	Secret      []byte             `json:"secret,omitempty"`
+	Credentials []CredentialRecord `json:"credentials"`
+	Ledger      []LedgerRecord     `json:"ledger,omitempty"`
+}
+
+// walletFile is the actual on-disk representation of the wallet.
+// The same format is used for any other data encrypted with Seal.
+type walletFile struct {
+	Version    int    `json:"version"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Store is a passphrase-encrypted, file-backed store of issued credentials.
+// It is safe for concurrent use.
+type Store struct {
+	sync.Mutex
+
+	path string
+	salt []byte
+	key  [scryptKeyLen]byte
+
+	data   walletData
+	closed bool
+}
+
+func deriveKey(passphrase, salt []byte) ([scryptKeyLen]byte, error) {
+	var key [scryptKeyLen]byte
+	derived, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return key, err
+	}
+	copy(key[:], derived)
+	return key, nil
+}
+
+func newSalt() ([]byte, error) {
+	salt := make([]byte, saltLength)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+func seal(plaintext, salt []byte, key *[scryptKeyLen]byte) ([]byte, error) {
+	var nonce [nonceLength]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return nil, err
+	}
+
+	wf := walletFile{
+		Version:    fileVersion,
+		Salt:       salt,
+		Nonce:      nonce[:],
+		Ciphertext: secretbox.Seal(nil, plaintext, &nonce, key),
+	}
+	return json.Marshal(&wf)
+}
+
+// unseal returns the plaintext alongside the salt and the key used to encrypt it.
+func unseal(raw, passphrase []byte) ([]byte, []byte, [scryptKeyLen]byte, error) {
+	var key [scryptKeyLen]byte
+	var wf walletFile
+	if err := json.Unmarshal(raw, &wf); err != nil {
+		return nil, nil, key, fmt.Errorf("malformed file: %v", err)
+	}
+	if wf.Version != fileVersion {
+		return nil, nil, key, fmt.Errorf("unsupported file version %v", wf.Version)
+	}
+	if len(wf.Nonce) != nonceLength {
+		return nil, nil, key, errors.New("malformed file: invalid nonce length")
+	}
+
+	key, err := deriveKey(passphrase, wf.Salt)
+	if err != nil {
+		return nil, nil, key, err
+	}
+
+	var nonce [nonceLength]byte
+	copy(nonce[:], wf.Nonce)
+	plaintext, ok := secretbox.Open(nil, wf.Ciphertext, &nonce, &key)
+	if !ok {
+		return nil, nil, key, ErrInvalidPassphrase
+	}
+	return plaintext, wf.Salt, key, nil
+}
+
+// Seal encrypts arbitrary data with a key derived from the passphrase, in the same way the wallet is encrypted.
+func Seal(plaintext, passphrase []byte) ([]byte, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return nil, err
+	}
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	return seal(plaintext, salt, &key)
+}
+
+// Unseal decrypts data encrypted with Seal.
+func Unseal(raw, passphrase []byte) ([]byte, error) {
+	plaintext, _, _, err := unseal(raw, passphrase)
+	return plaintext, err
+}
+
+// Open loads and decrypts wallet located at the specified path.
+// It fails with ErrNotExist if the file does not exist, the wallet has to be created with Create instead.
+func Open(path string, passphrase []byte) (*Store, error) {
+	s := &Store{
+		path: path,
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+
+	plaintext, salt, key, err := unseal(raw, passphrase)
+	if err != nil {
+		if err == ErrInvalidPassphrase {
+			return nil, err
+		}
+		return nil, fmt.Errorf("invalid wallet file: %v", err)
+	}
+	s.salt, s.key = salt, key
+
+	if err := json.Unmarshal(plaintext, &s.data); err != nil {
+		return nil, fmt.Errorf("malformed wallet content: %v", err)
+	}
+	return s, nil
+}
+
+func create(path string, passphrase []byte, data walletData) (*Store, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return nil, err
+	}
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		path: path,
+		salt: salt,
+		key:  key,
+		data: data,
+	}
+	if err := s.write(false); err != nil {
+		if err == ErrExists {
+			return nil, err
+		}
+		return nil, fmt.Errorf("could not create new wallet file: %v", err)
+	}
+	return s, nil
+}
+
+// Create creates a new wallet file with the content of the snapshot, for example one restored from a backup,
+// or an empty one for a fresh wallet. It refuses to replace an existing wallet.
+// The snapshot is copied, hence the caller remains responsible for wiping it.
+func Create(path string, passphrase []byte, snapshot Snapshot) (*Store, error) {
+	// fail early, before the key is derived; the file itself is published without replacing anything regardless
+	if _, err := os.Lstat(path); err == nil {
+		return nil, ErrExists
+	}
+
+	data := walletData{
+		Secret:      copyBytes(snapshot.Secret),
+		Credentials: make([]*CredentialRecord, len(snapshot.Credentials)),
+		Ledger:      make([]*LedgerRecord, len(snapshot.Ledger)),
+	}
+	for i := range snapshot.Credentials {
+		rec := snapshot.Credentials[i].clone()
+		data.Credentials[i] = &rec
+	}
+	for i := range snapshot.Ledger {
+		data.Ledger[i] = &snapshot.Ledger[i]
+	}
+	return create(path, passphrase, data)
+}
+
+// save encrypts current content of the wallet and atomically replaces the file on disk.
+// It must be called with the lock held.
+func (s *Store) save() error {
+	return s.write(true)
+}
+
+// write encrypts current content of the wallet and atomically publishes it on disk. Unless replace is set,
+// it fails with ErrExists if the file already exists, even if it was created concurrently.
+// It must be called with the lock held.
+func (s *Store) write(replace bool) error {
+	if s.closed {
+		return ErrClosed
+	}
+
+	plaintext, err := json.Marshal(&s.data)
+	if err != nil {
+		return err
+	}
+	raw, err := seal(plaintext, s.salt, &s.key)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if replace {
+		return os.Rename(tmp.Name(), s.path)
+	}
+
+	// unlike rename, link never replaces the target
+	defer os.Remove(tmp.Name())
+	if err := os.Link(tmp.Name(), s.path); err != nil {
+		if os.IsExist(err) {
+			return ErrExists
+		}
+		return err
+	}
+	return nil
+}
+
+// VerifyPassphrase checks whether the passphrase is the one the wallet is encrypted with.
+func (s *Store) VerifyPassphrase(passphrase []byte) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	key, err := deriveKey(passphrase, s.salt)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key[:], s.key[:]) == 1
+}
+
+// ChangePassphrase re-encrypts the wallet with key derived from the new passphrase and fresh salt.
+func (s *Store) ChangePassphrase(oldPassphrase, newPassphrase []byte) error {
+	if !s.VerifyPassphrase(oldPassphrase) {
+		return ErrInvalidPassphrase
+	}
+
+	salt, err := newSalt()
+	if err != nil {
+		return err
+	}
+	key, err := deriveKey(newPassphrase, salt)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	oldSalt, oldKey := s.salt, s.key
+	s.salt, s.key = salt, key
+	if err := s.save(); err != nil {
+		s.salt, s.key = oldSalt, oldKey
+		return err
+	}
+	return nil
+}
+
+// Close overwrites the encryption key and all the secrets held in memory, without affecting the file.
+// The store can't be used afterwards.
+func (s *Store) Close() {
+	s.Lock()
+	defer s.Unlock()
+
+	for i := range s.key {
+		s.key[i] = 0
+	}
+	sensitive.Zero(s.data.Secret)
+	for _, cred := range s.data.Credentials {
+		sensitive.Zero(cred.PrivateKey)
+	}
+	s.data = walletData{}
+	s.closed = true
+}
+
+// Snapshot returns copy of the entire content of the wallet.
+func (s *Store) Snapshot() Snapshot {
+	s.Lock()
+	defer s.Unlock()
+
+	snapshot := Snapshot{
+		Credentials: make([]CredentialRecord, len(s.data.Credentials)),
+		Ledger:      make([]LedgerRecord, len(s.data.Ledger)),
+	}
+	snapshot.Secret = copyBytes(s.data.Secret)
+	for i, cred := range s.data.Credentials {
+		snapshot.Credentials[i] = cred.clone()
+	}
+	for i, rec := range s.data.Ledger {
+		snapshot.Ledger[i] = *rec
+	}
+	return snapshot
+}
+
+// Secret returns copy of the long-term secret held in the wallet or nil if it was not set.
+func (s *Store) Secret() []byte {
+	s.Lock()
+	defer s.Unlock()
+
+	return copyBytes(s.data.Secret)
+}
+
+// SetSecret sets the long-term secret of the wallet and persists it on disk.
+// Once set, the secret can never be overwritten as all credentials issued for it would become unusable.
+func (s *Store) SetSecret(secret []byte) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.data.Secret != nil {
+		return ErrSecretExists
+	}
+
+	s.data.Secret = copyBytes(secret)
+	if err := s.save(); err != nil {
+		s.data.Secret = nil
+		return err
+	}
+	return nil
+}
+
+// Credentials returns copies of all credentials held in the wallet, in the order they were obtained.
+func (s *Store) Credentials() []CredentialRecord {
+	s.Lock()
+	defer s.Unlock()
+
+	creds := make([]CredentialRecord, len(s.data.Credentials))
+	for i, cred := range s.data.Credentials {
+		creds[i] = cred.clone()
+	}
+	return creds
+}
+
+// AddCredential adds copy of the credential to the wallet and persists it on disk.
+func (s *Store) AddCredential(rec CredentialRecord) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, cred := range s.data.Credentials {
+		if cred.ID == rec.ID {
+			return ErrDuplicateCredential
+		}
+	}
+
+	rec = rec.clone()
+	s.data.Credentials = append(s.data.Credentials, &rec)
+	if err := s.save(); err != nil {
+		s.data.Credentials = s.data.Credentials[:len(s.data.Credentials)-1]
+		return err
+	}
+	return nil
+}
+
+// UpdateSignature replaces the stored signature of the credential, for example after it was re-randomized.
+func (s *Store) UpdateSignature(id string, signature []byte) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+
+	for _, cred := range s.data.Credentials {
+		if cred.ID == id {
+			old := cred.Signature
+			cred.Signature = copyBytes(signature)
+			if err := s.save(); err != nil {
+				cred.Signature = old
+				return err
+			}
+			return nil
+		}
+	}
+	return ErrUnknownCredential
+}
+
+// MarkSpent marks the credential with the given ID as spent and persists the change on disk.
+func (s *Store) MarkSpent(id string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+
+	for _, cred := range s.data.Credentials {
+		if cred.ID == id {
+			if cred.Spent {
+				return nil
+			}
+			cred.Spent = true
+			if err := s.save(); err != nil {
+				cred.Spent = false
+				return err
+			}
+			return nil
+		}
+	}
+	return ErrUnknownCredential
+}
+
+// Ledger returns copies of all operations recorded in the wallet, in the order they were performed.
+func (s *Store) Ledger() []LedgerRecord {
+	s.Lock()
+	defer s.Unlock()
+
+	ledger := make([]LedgerRecord, len(s.data.Ledger))
+	for i, rec := range s.data.Ledger {
+		ledger[i] = *rec
+	}
+	return ledger
+}
+
+// AddLedgerRecord appends the operation to the ledger and persists it on disk.
+func (s *Store) AddLedgerRecord(rec LedgerRecord) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.data.Ledger = append(s.data.Ledger, &rec)
+	if err := s.save(); err != nil {
+		s.data.Ledger = s.data.Ledger[:len(s.data.Ledger)-1]
+		return err
+	}
+	return nil
+}
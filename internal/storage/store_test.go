@@ -0,0 +1,234 @@
+// store_test.go - tests of the encrypted wallet store
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testPassphrase = []byte("correct horse battery staple")
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func testSnapshot() Snapshot {
+	return Snapshot{
+		Secret: []byte("long-term secret"),
+		Credentials: []CredentialRecord{{
+			ID:         "42",
+			Sequence:   []byte("sequence"),
+			PrivateKey: []byte("private key"),
+			Value:      10,
+			Signature:  []byte("signature"),
+			Obtained:   time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC),
+		}},
+		Ledger: []LedgerRecord{{
+			Type:    "getCredential",
+			Time:    time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC),
+			Amount:  10,
+			Success: true,
+		}},
+	}
+}
+
+func expectSnapshot(t *testing.T, got, expected Snapshot) {
+	t.Helper()
+	if !bytes.Equal(got.Secret, expected.Secret) {
+		t.Errorf("expected secret %q, got %q", expected.Secret, got.Secret)
+	}
+	if len(got.Credentials) != len(expected.Credentials) || len(got.Ledger) != len(expected.Ledger) {
+		t.Fatalf("expected %v credentials and %v ledger records, got %v and %v",
+			len(expected.Credentials), len(expected.Ledger), len(got.Credentials), len(got.Ledger))
+	}
+	for i, cred := range got.Credentials {
+		exp := expected.Credentials[i]
+		if cred.ID != exp.ID || cred.Value != exp.Value || cred.Spent != exp.Spent || !cred.Obtained.Equal(exp.Obtained) ||
+			!bytes.Equal(cred.Sequence, exp.Sequence) || !bytes.Equal(cred.PrivateKey, exp.PrivateKey) ||
+			!bytes.Equal(cred.Signature, exp.Signature) {
+			t.Errorf("expected credential %+v, got %+v", exp, cred)
+		}
+	}
+	for i, rec := range got.Ledger {
+		exp := expected.Ledger[i]
+		if rec.Type != exp.Type || rec.Amount != exp.Amount || rec.Success != exp.Success || !rec.Time.Equal(exp.Time) {
+			t.Errorf("expected ledger record %+v, got %+v", exp, rec)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "wallet")
+
+	snapshot := testSnapshot()
+	s, err := Create(path, testPassphrase, snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied := s.Snapshot()
+	creds := s.Credentials()
+	s.Close()
+
+	// the copies handed out, as well as the snapshot the store was created from, must survive wiping of the store
+	expectSnapshot(t, copied, testSnapshot())
+	expectSnapshot(t, snapshot, testSnapshot())
+	if !bytes.Equal(creds[0].PrivateKey, snapshot.Credentials[0].PrivateKey) {
+		t.Errorf("the credential returned before closing the store was wiped")
+	}
+
+	s, err = Open(path, testPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	expectSnapshot(t, s.Snapshot(), testSnapshot())
+
+	// modifying the returned copies must not affect the store
+	copied = s.Snapshot()
+	copied.Secret[0] = 0
+	copied.Credentials[0].PrivateKey[0] = 0
+	expectSnapshot(t, s.Snapshot(), testSnapshot())
+}
+
+func TestInvalidPassphrase(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "wallet")
+
+	s, err := Create(path, testPassphrase, testSnapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	if _, err := Open(path, []byte("wrong passphrase")); err != ErrInvalidPassphrase {
+		t.Errorf("expected %v, got %v", ErrInvalidPassphrase, err)
+	}
+}
+
+func TestCorruptedFile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "wallet")
+
+	if _, err := Open(path, testPassphrase); err != ErrNotExist {
+		t.Errorf("expected %v, got %v", ErrNotExist, err)
+	}
+
+	s, err := Create(path, testPassphrase, testSnapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// truncated file is not even a valid json
+	if err := ioutil.WriteFile(path, raw[:len(raw)/2], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path, testPassphrase); err == nil {
+		t.Errorf("opened a truncated wallet")
+	}
+
+	// modified ciphertext fails the authentication
+	var wf walletFile
+	if err := json.Unmarshal(raw, &wf); err != nil {
+		t.Fatal(err)
+	}
+	wf.Ciphertext[len(wf.Ciphertext)-1] ^= 1
+	modified, err := json.Marshal(&wf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, modified, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path, testPassphrase); err == nil {
+		t.Errorf("opened a modified wallet")
+	}
+}
+
+func TestCreateExisting(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "wallet")
+
+	existing := []byte("existing wallet")
+	if err := ioutil.WriteFile(path, existing, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Create(path, testPassphrase, Snapshot{}); err != ErrExists {
+		t.Errorf("expected %v, got %v", ErrExists, err)
+	}
+	// the file might have been created only after Create has checked for it
+	if _, err := create(path, testPassphrase, walletData{}); err != ErrExists {
+		t.Errorf("expected %v, got %v", ErrExists, err)
+	}
+
+	if raw, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(raw, existing) {
+		t.Errorf("the existing file was modified")
+	}
+	if files, err := ioutil.ReadDir(dir); err != nil || len(files) != 1 {
+		t.Errorf("expected only the existing file to remain, got %v (%v)", len(files), err)
+	}
+}
+
+func TestMarkSpent(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "wallet")
+
+	s, err := Create(path, testPassphrase, testSnapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.MarkSpent("42"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.MarkSpent("43"); err != ErrUnknownCredential {
+		t.Errorf("expected %v, got %v", ErrUnknownCredential, err)
+	}
+	s.Close()
+	if err := s.MarkSpent("42"); err != ErrClosed {
+		t.Errorf("expected %v, got %v", ErrClosed, err)
+	}
+
+	s, err = Open(path, testPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	expected := testSnapshot()
+	expected.Credentials[0].Spent = true
+	expectSnapshot(t, s.Snapshot(), expected)
+}
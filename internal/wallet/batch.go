@@ -0,0 +1,225 @@
+// batch.go - obtaining many credentials at once
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nymtech/qt-validator-client-demo/internal/jobs"
+)
+
+const (
+	// MaxBatchAmount is the largest amount that can be split into credentials at once.
+	MaxBatchAmount = 1 << 20
+	// MaxBatchSize is the largest number of credentials that can be requested in a single batch.
+	MaxBatchSize = 100
+)
+
+// BatchFailure describes a credential of the batch that could not be obtained, or that was obtained
+// but could not be saved in the wallet.
+type BatchFailure struct {
+	Value int64  `json:"value"`
+	Error string `json:"error"`
+	// ID identifies the credential that was obtained, but is only held in memory, as it could not be saved.
+	ID string `json:"id,omitempty"`
+}
+
+// BatchResult describes the outcome of obtaining a batch of credentials.
+type BatchResult struct {
+	// Values are the values of all the requested credentials.
+	Values   []int64        `json:"values"`
+	Obtained []Credential   `json:"obtained"`
+	Failures []BatchFailure `json:"failures,omitempty"`
+	// Duration is how long it took to process the whole batch.
+	Duration time.Duration `json:"duration"`
+}
+
+// Throughput returns the number of credentials obtained per second.
+func (r *BatchResult) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(len(r.Obtained)) / r.Duration.Seconds()
+}
+
+// ObtainedAmount returns the total value of the obtained credentials.
+func (r *BatchResult) ObtainedAmount() int64 {
+	var amount int64
+	for _, cred := range r.Obtained {
+		amount += cred.Value
+	}
+	return amount
+}
+
+// SpentAmount returns the total value of the credentials that were paid for, including the unsaved ones.
+func (r *BatchResult) SpentAmount() int64 {
+	amount := r.ObtainedAmount()
+	for _, failure := range r.Failures {
+		if failure.ID != "" {
+			amount += failure.Value
+		}
+	}
+	return amount
+}
+
+// SplitAmount decomposes the amount into the smallest possible number of the denominations.
+// The values are returned in descending order.
+func SplitAmount(amount int64, denominations []int64) ([]int64, error) {
+	if amount <= 0 {
+		return nil, errors.New("the amount must be positive")
+	}
+	if amount > MaxBatchAmount {
+		return nil, fmt.Errorf("the amount can't exceed %v", MaxBatchAmount)
+	}
+
+	// fewest[a] is the smallest number of denominations summing up to a, with last[a] being the last one used
+	const unreachable = -1
+	fewest := make([]int64, amount+1)
+	last := make([]int64, amount+1)
+	for a := int64(1); a <= amount; a++ {
+		fewest[a] = unreachable
+		for _, d := range denominations {
+			if d <= 0 || d > a || fewest[a-d] == unreachable {
+				continue
+			}
+			if fewest[a] == unreachable || fewest[a-d]+1 < fewest[a] {
+				fewest[a] = fewest[a-d] + 1
+				last[a] = d
+			}
+		}
+	}
+	if fewest[amount] == unreachable {
+		return nil, fmt.Errorf("%v can't be composed of the allowed values %v", amount, denominations)
+	}
+
+	values := make([]int64, 0, fewest[amount])
+	for a := amount; a > 0; a -= last[a] {
+		values = append(values, last[a])
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] > values[j] })
+	return values, nil
+}
+
+// GetCredentialsForAmount obtains credentials of the allowed values worth exactly the amount in total,
+// using as few of them as possible. The Nym token balance is checked before any credential is requested.
+// Failure to obtain some of the credentials does not stop the remaining ones from being obtained, in which case
+// the returned error summarizes the failures and the result lists them individually.
+func (w *Wallet) GetCredentialsForAmount(ctx context.Context, amount int64) (*BatchResult, error) {
+	values, err := SplitAmount(amount, w.AllowedValues())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.checkNymBalance(amount); err != nil {
+		return nil, err
+	}
+	return w.getCredentials(ctx, values)
+}
+
+// GetCredentialBatch obtains count credentials of the same value, in the same way as GetCredentialsForAmount.
+func (w *Wallet) GetCredentialBatch(ctx context.Context, value int64, count int) (*BatchResult, error) {
+	if count <= 0 || count > MaxBatchSize {
+		return nil, fmt.Errorf("the number of credentials must be between 1 and %v", MaxBatchSize)
+	}
+
+	values := make([]int64, count)
+	for i := range values {
+		values[i] = value
+	}
+	if err := w.checkNymBalance(value * int64(count)); err != nil {
+		return nil, err
+	}
+	return w.getCredentials(ctx, values)
+}
+
+func (w *Wallet) checkNymBalance(amount int64) error {
+	balance, err := w.client().GetCurrentNymBalance()
+	if err != nil {
+		return fmt.Errorf("failed to query for Nym Token Balance: %v", err)
+	}
+	if balance < uint64(amount) {
+		return fmt.Errorf("insufficient balance: %v Nym is required, but the account only holds %v Nym", amount, balance)
+	}
+	return nil
+}
+
+// getCredentials obtains credentials of all the values concurrently, making at most as many requests at the same
+// time as allowed by the config. Each credential is published as soon as it is obtained.
+func (w *Wallet) getCredentials(ctx context.Context, values []int64) (*BatchResult, error) {
+	result := &BatchResult{Values: values}
+	started := time.Now()
+
+	concurrency := w.cfg.Client.MaxRequests
+	if concurrency <= 0 || concurrency > len(values) {
+		concurrency = len(values)
+	}
+	slots := make(chan struct{}, concurrency)
+
+	// the stages of the individual credentials would interleave, so only the progress of the batch is reported
+	credCtx := jobs.WithProgress(ctx, nil)
+	var resultLock sync.Mutex
+	var wg sync.WaitGroup
+	done := func(value int64, cred *Credential, err error) {
+		resultLock.Lock()
+		defer resultLock.Unlock()
+
+		switch {
+		case err == nil:
+			result.Obtained = append(result.Obtained, *cred)
+		case cred != nil:
+			// the credential can still be spent, but it is lost on exit
+			result.Failures = append(result.Failures, BatchFailure{
+				Value: value,
+				Error: fmt.Sprintf("credential %v is only held in memory, it was not saved: %v", cred.ID, err),
+				ID:    cred.ID,
+			})
+		default:
+			result.Failures = append(result.Failures, BatchFailure{Value: value, Error: err.Error()})
+		}
+		jobs.ReportStagef(ctx, "%v of %v credentials processed", len(result.Obtained)+len(result.Failures), len(values))
+	}
+
+	for _, value := range values {
+		wg.Add(1)
+		go func(value int64) {
+			defer wg.Done()
+
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				done(value, nil, ctx.Err())
+				return
+			}
+			cred, err := w.GetCredential(credCtx, value)
+			done(value, cred, err)
+		}(value)
+	}
+	wg.Wait()
+	result.Duration = time.Since(started)
+
+	if len(result.Failures) > 0 {
+		return result, fmt.Errorf("obtained %v of %v credentials (%v Nym in total), the first failure: %v",
+			len(result.Obtained), len(values), result.ObtainedAmount(), result.Failures[0].Error)
+	}
+	return result, nil
+}
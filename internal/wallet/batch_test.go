@@ -0,0 +1,126 @@
+// batch_test.go - tests of obtaining credentials in batches
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package wallet_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nymtech/qt-validator-client-demo/internal/wallet"
+)
+
+func TestSplitAmount(t *testing.T) {
+	denominations := []int64{1, 2, 5, 10, 20, 50, 100}
+	tests := []struct {
+		amount        int64
+		denominations []int64
+		expected      []int64
+	}{
+		{1, denominations, []int64{1}},
+		{100, denominations, []int64{100}},
+		{188, denominations, []int64{100, 50, 20, 10, 5, 2, 1}},
+		{400, denominations, []int64{100, 100, 100, 100}},
+		// the fewest values are used, even where picking the largest one first would not lead to them
+		{6, []int64{1, 3, 4}, []int64{3, 3}},
+		{30, []int64{25, 10, 1}, []int64{10, 10, 10}},
+		// amounts only reachable without the largest values
+		{6, []int64{4, 3}, []int64{3, 3}},
+		// invalid denominations are ignored
+		{4, []int64{0, -1, 2}, []int64{2, 2}},
+		{wallet.MaxBatchAmount, []int64{1 << 19}, []int64{1 << 19, 1 << 19}},
+
+		// amounts that can't be composed of the values
+		{7, []int64{5, 10}, nil},
+		{3, []int64{2}, nil},
+		{5, nil, nil},
+		{5, []int64{0, -5}, nil},
+		{wallet.MaxBatchAmount + 1, []int64{1}, nil},
+
+		// the amount must be positive
+		{0, denominations, nil},
+		{-5, denominations, nil},
+	}
+
+	for _, test := range tests {
+		values, err := wallet.SplitAmount(test.amount, test.denominations)
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("expected %v of %v to be refused, got %v", test.amount, test.denominations, values)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("could not split %v into %v: %v", test.amount, test.denominations, err)
+			continue
+		}
+		if !reflect.DeepEqual(values, test.expected) {
+			t.Errorf("expected %v to be split into %v, got %v", test.amount, test.expected, values)
+		}
+		var sum int64
+		for _, v := range values {
+			sum += v
+		}
+		if sum != test.amount {
+			t.Errorf("the values %v sum up to %v instead of %v", values, sum, test.amount)
+		}
+	}
+}
+
+func TestGetCredentialBatchUnsaved(t *testing.T) {
+	w := newTestWallet(t, 0, 100)
+	defer w.close()
+
+	// with a directory in place of the wallet file, nothing can be saved anymore
+	walletFile := w.Config().Nym.AccountKeysFile + wallet.WalletFileSuffix
+	if err := os.Remove(walletFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(walletFile, "blocker"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := testContext()
+	defer cancel()
+	value := w.smallestValue()
+	res, err := w.GetCredentialBatch(ctx, value, 3)
+	if err == nil {
+		t.Fatal("the unsaved credentials were not reported")
+	}
+	if res == nil {
+		t.Fatalf("expected the result of the batch: %v", err)
+	}
+
+	// the credentials are either obtained or failed, never both
+	if len(res.Obtained) != 0 || len(res.Failures) != 3 {
+		t.Fatalf("expected 3 failures and no obtained credentials, got %v and %v", len(res.Failures), len(res.Obtained))
+	}
+	held := make(map[string]bool)
+	for _, cred := range w.Credentials() {
+		held[cred.ID] = true
+	}
+	for _, failure := range res.Failures {
+		if failure.ID == "" || !held[failure.ID] || !strings.Contains(failure.Error, "only held in memory") {
+			t.Errorf("expected the failure to refer to the credential held in memory, got %+v", failure)
+		}
+	}
+	if res.ObtainedAmount() != 0 || res.SpentAmount() != 3*value {
+		t.Errorf("expected nothing obtained and %v Nym spent, got %v and %v", 3*value, res.ObtainedAmount(), res.SpentAmount())
+	}
+}
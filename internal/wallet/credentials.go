@@ -0,0 +1,344 @@
+// credentials.go - obtaining and spending coconut credentials
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package wallet
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	Curve "github.com/nymtech/amcl/version3/go/amcl/BLS381"
+	coconut "github.com/nymtech/nym-validator/crypto/coconut/scheme"
+	"github.com/nymtech/nym-validator/crypto/coconut/utils"
+	"github.com/nymtech/nym-validator/nym/token"
+	"github.com/nymtech/qt-validator-client-demo/internal/jobs"
+	"github.com/nymtech/qt-validator-client-demo/internal/sensitive"
+	"github.com/nymtech/qt-validator-client-demo/internal/storage"
+)
+
+// CredentialState describes whether the credential can still be spent.
+type CredentialState string
+
+const (
+	Unspent CredentialState = "unspent"
+	// Pending credentials are being sent to a service provider right now.
+	Pending CredentialState = "pending"
+	Spent   CredentialState = "spent"
+)
+
+// Credential is the public view of a credential held in the wallet.
+type Credential struct {
+	// ID is the stringified sequence number of the credential.
+	ID string `json:"id"`
+	// Signature is the base64 encoded coconut credential.
+	Signature string          `json:"signature"`
+	Value     int64           `json:"value"`
+	Spent     bool            `json:"spent"`
+	State     CredentialState `json:"state"`
+}
+
+// SpendResult describes the outcome of spending a credential.
+type SpendResult struct {
+	// Accepted indicates whether the service provider accepted the credential.
+	Accepted bool `json:"accepted"`
+	// Value is the value of the spent credential.
+	Value int64 `json:"value"`
+	// ServiceProvider is the physical address of the service provider.
+	ServiceProvider string `json:"serviceProvider"`
+	// ServiceProviderAccount is the address of the account of the service provider.
+	ServiceProviderAccount string `json:"serviceProviderAccount"`
+}
+
+type issuedCredential struct {
+	credential *coconut.Signature
+	token      *token.Token
+	spent      bool
+	// set while the credential is being spent, it is never persisted
+	pending bool
+}
+
+// Format implements fmt.Formatter, so that the private attributes of the token could never be printed.
+func (ic issuedCredential) Format(f fmt.State, verb rune) {
+	fmt.Fprintf(f, "issuedCredential{value: %v, spent: %v, token: %v}", ic.token.Value(), ic.spent, sensitive.Redacted)
+}
+
+func (ic *issuedCredential) info(id string) Credential {
+	var sig string
+	if credBytes, err := ic.credential.MarshalBinary(); err == nil {
+		sig = base64.StdEncoding.EncodeToString(credBytes)
+	}
+
+	return Credential{
+		ID:        id,
+		Signature: sig,
+		Value:     ic.token.Value(),
+		Spent:     ic.spent,
+		State:     ic.state(),
+	}
+}
+
+func (ic *issuedCredential) state() CredentialState {
+	switch {
+	case ic.pending:
+		return Pending
+	case ic.spent:
+		return Spent
+	}
+	return Unspent
+}
+
+func bigToBytes(b *Curve.BIG) []byte {
+	buf := make([]byte, Curve.MODBYTES)
+	b.ToBytes(buf)
+	return buf
+}
+
+// parseSecret recovers long-term secret from its hex representation, as produced by 'ExportSecret'.
+func parseSecret(hexSecret string) (*Curve.BIG, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(hexSecret), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex encoding: %v", err)
+	}
+	if len(b) != int(Curve.MODBYTES) {
+		return nil, fmt.Errorf("invalid secret length (expected %v bytes, got %v)", Curve.MODBYTES, len(b))
+	}
+
+	secret := Curve.FromBytes(b)
+	if Curve.Comp(secret, Curve.NewBIGint(0)) == 0 {
+		return nil, errors.New("the secret can't be zero")
+	}
+	if Curve.Comp(secret, Curve.NewBIGints(Curve.CURVE_Order)) >= 0 {
+		return nil, errors.New("the secret is not smaller than the curve order")
+	}
+	return secret, nil
+}
+
+// secretFromMaterial deterministically maps the seed-derived material onto a valid long-term secret, i.e. a non-zero
+// value smaller than the curve order.
+func secretFromMaterial(material []byte) *Curve.BIG {
+	order := new(big.Int).SetBytes(bigToBytes(Curve.NewBIGints(Curve.CURVE_Order)))
+	v := new(big.Int).SetBytes(material)
+	v.Mod(v, new(big.Int).Sub(order, big.NewInt(1)))
+	v.Add(v, big.NewInt(1))
+
+	buf := make([]byte, Curve.MODBYTES)
+	vBytes := v.Bytes()
+	copy(buf[len(buf)-len(vBytes):], vBytes)
+	return Curve.FromBytes(buf)
+}
+
+// issuedCredentialFromRecord recovers the credential and its token from the form in which they are kept in the wallet.
+func issuedCredentialFromRecord(rec storage.CredentialRecord) (*issuedCredential, error) {
+	sig := &coconut.Signature{}
+	if err := sig.UnmarshalBinary(rec.Signature); err != nil {
+		return nil, fmt.Errorf("could not recover the signature: %v", err)
+	}
+
+	token, err := token.New(Curve.FromBytes(rec.Sequence), Curve.FromBytes(rec.PrivateKey), rec.Value)
+	if err != nil {
+		return nil, fmt.Errorf("could not recover the token: %v", err)
+	}
+
+	return &issuedCredential{
+		credential: sig,
+		token:      token,
+		spent:      rec.Spent,
+	}, nil
+}
+
+// Credentials returns all the credentials held by the wallet ordered by their IDs.
+func (w *Wallet) Credentials() []Credential {
+	return w.credentials.list()
+}
+
+// GetCredential obtains new credential of the specified value and stores it in the wallet.
+// Note that the issuance itself can't be aborted once started, the context is only checked between its stages.
+func (w *Wallet) GetCredential(ctx context.Context, value int64) (_ *Credential, err error) {
+	entry := &LedgerEntry{Type: CredentialIssuance, Amount: value}
+	defer func() { w.recordOperation(entry, err) }()
+
+	store := w.storage()
+	if store == nil {
+		return nil, ErrWalletNotOpened
+	}
+	secret := w.secret()
+	if secret == nil {
+		return nil, ErrNoSecret
+	}
+
+	seq := w.client().RandomBIG()
+
+	token, err := token.New(seq, secret, value)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate token for %v: %v", value, err)
+	}
+	jobs.ReportStage(ctx, "token generated")
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	jobs.ReportStagef(ctx, "waiting for signatures of %v IAs", w.cfg.Client.Threshold)
+	cred, err := w.client().GetCredential(token)
+	if err != nil {
+		return nil, fmt.Errorf("could not obtain credential for %v: %v", value, err)
+	}
+	jobs.ReportStage(ctx, "signatures aggregated")
+
+	credBytes, err := cred.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal obtained credential: %v", err)
+	}
+
+	seqString := utils.ToCoconutString(seq)
+
+	issuedCredential := issuedCredential{
+		credential: cred,
+		token:      token, // encapsulates all attributes
+	}
+
+	entry.Details = fmt.Sprintf("credential %v", seqString)
+
+	// in principle each credential has unique sequence number by which it can be identified
+	if !w.credentials.add(seqString, issuedCredential) {
+		return nil, fmt.Errorf("credential with sequence number %v already exists", seqString)
+	}
+
+	info := issuedCredential.info(seqString)
+	w.publish(CredentialAddedEvent{info})
+
+	jobs.ReportStage(ctx, "saving in the wallet")
+	if err := store.AddCredential(storage.CredentialRecord{
+		ID:         seqString,
+		Sequence:   bigToBytes(seq),
+		PrivateKey: bigToBytes(secret),
+		Value:      value,
+		Signature:  credBytes,
+		Obtained:   time.Now(),
+	}); err != nil {
+		return &info, fmt.Errorf("could not save the obtained credential in the wallet - it will be lost on exit: %v", err)
+	}
+
+	return &info, nil
+}
+
+// SpendCredential spends credential with the provided ID at the chosen service provider.
+// Credentials known to be spent are refused with ErrCredentialSpent without contacting the service provider,
+// unless forceDoubleSpend is set to demonstrate that the double spending gets detected.
+func (w *Wallet) SpendCredential(ctx context.Context, chosenSP, id string, forceDoubleSpend bool) (_ *SpendResult, err error) {
+	entry := &LedgerEntry{Type: CredentialSpend, Details: fmt.Sprintf("credential %v at %v", id, chosenSP)}
+	defer func() { w.recordOperation(entry, err) }()
+
+	store := w.storage()
+	if store == nil {
+		return nil, ErrWalletNotOpened
+	}
+
+	spAddressRaw, ok := w.cfg.Nym.ServiceProviders[chosenSP]
+	if !ok {
+		return nil, fmt.Errorf("No service provider with address %v exists", chosenSP)
+	}
+	spAddress := ethcommon.HexToAddress(spAddressRaw)
+
+	cred, err := w.credentials.beginSpend(id, forceDoubleSpend)
+	if err != nil {
+		return nil, err
+	}
+	if cred.spent {
+		entry.Details += " (deliberate double spend)"
+	}
+	spent := false
+	w.publish(CredentialStateChangedEvent{id, Pending})
+	defer func() {
+		w.publish(CredentialStateChangedEvent{id, w.credentials.endSpend(id, spent)})
+		w.poolChanged()
+	}()
+	entry.Amount = cred.token.Value()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	jobs.ReportStagef(ctx, "sending credential to %v", chosenSP)
+	wasSuccessful, err := w.client().SpendCredential(cred.token, cred.credential, chosenSP, spAddress, nil)
+	if err != nil {
+		err = fmt.Errorf("could not spend the credential: %v", err)
+		if ClassifyError(err) == DoubleSpend {
+			// the credential must have been spent elsewhere, e.g. from a copy of the wallet
+			entry.TendermintResult = "credential rejected as double spent"
+			spent = true
+			if storeErr := store.MarkSpent(id); storeErr != nil {
+				err = fmt.Errorf("%v (and its state could not be saved in the wallet: %v)", err, storeErr)
+			}
+		}
+		return nil, err
+	}
+	// the client does not say why the credential was rejected, but the ones held by the wallet are valid,
+	// so it must have been spent already, e.g. from a copy of the wallet
+	if wasSuccessful {
+		entry.TendermintResult = "credential accepted"
+	} else {
+		entry.TendermintResult = "credential rejected as double spent"
+	}
+
+	result := &SpendResult{
+		Accepted:               wasSuccessful,
+		Value:                  cred.token.Value(),
+		ServiceProvider:        chosenSP,
+		ServiceProviderAccount: spAddress.Hex(),
+	}
+
+	spent = true
+	if err := store.MarkSpent(id); err != nil {
+		return result, fmt.Errorf("could not save state of the credential in the wallet: %v", err)
+	}
+	return result, nil
+}
+
+// RandomizeCredential re-randomizes credential with the provided ID and returns its new representation.
+func (w *Wallet) RandomizeCredential(id string) (string, error) {
+	cred, ok := w.credentials.get(id)
+	if !ok {
+		return "", fmt.Errorf("no credential exists for that sequence number (%v)", id)
+	}
+
+	rcred := w.client().ForceReRandomizeCredential(cred.credential)
+	if rcred == nil {
+		// it should ALWAYS be not nil, it's just a sanity check
+		return "", errors.New("could not re-randomize the credential")
+	}
+	w.credentials.setSignature(id, rcred)
+
+	rCredBytes, err := rcred.MarshalBinary()
+	if err != nil {
+		return "", fmt.Errorf("could not marshal randomized credential: %v", err)
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(rCredBytes)
+	if store := w.storage(); store != nil {
+		if err := store.UpdateSignature(id, rCredBytes); err != nil {
+			return encoded, fmt.Errorf("could not save randomized credential in the wallet: %v", err)
+		}
+	}
+	return encoded, nil
+}
@@ -0,0 +1,103 @@
+// errors.go - classification of the failures of wallet operations
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package wallet
+
+import (
+	"net"
+	"strings"
+)
+
+// ErrorCategory identifies the cause of a failed operation, so that the user could be told what to do about it.
+type ErrorCategory string
+
+// All the recognised causes of failures.
+const (
+	// Uncategorized errors were not recognised.
+	Uncategorized      ErrorCategory = ""
+	NetworkUnreachable ErrorCategory = "network unreachable"
+	// InsufficientBalance covers both the ERC20 and the Nym token balances.
+	InsufficientBalance ErrorCategory = "insufficient balance"
+	AccountMissing      ErrorCategory = "account missing"
+	DoubleSpend         ErrorCategory = "double spend"
+	// ThresholdNotMet means that not enough issuing authorities have signed the credential.
+	ThresholdNotMet ErrorCategory = "IA threshold not met"
+	TxReverted      ErrorCategory = "Ethereum transaction reverted"
+)
+
+type errorPattern struct {
+	category ErrorCategory
+	// lower case fragments of the error messages
+	fragments []string
+}
+
+// The client does not export any error values, so its errors can only be recognised by their messages.
+// The patterns are checked in order, the more specific ones have to come first.
+var errorPatterns = []errorPattern{
+	{DoubleSpend, []string{"double spend", "double-spend", "already spent", "already been spent"}},
+	{InsufficientBalance, []string{"insufficient", "not enough funds", "not enough balance", "exceeds balance"}},
+	{ThresholdNotMet, []string{"threshold not met", "threshold not reached", "not enough ia responses", "not enough signatures",
+		"not enough shares", "could not aggregate"}},
+	{TxReverted, []string{"reverted", "out of gas", "transaction failed"}},
+	{AccountMissing, []string{"account does not exist", "account doesn't exist", "account not found", "unknown account", "not registered"}},
+	{NetworkUnreachable, []string{"connection refused", "no such host", "i/o timeout", "network is unreachable", "no route to host", "connection reset", "dial tcp"}},
+}
+
+// ClassifyError determines the category of the error returned by any of the wallet operations.
+func ClassifyError(err error) ErrorCategory {
+	if err == nil {
+		return Uncategorized
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, p := range errorPatterns {
+		for _, fragment := range p.fragments {
+			if strings.Contains(msg, fragment) {
+				return p.category
+			}
+		}
+	}
+	if _, ok := err.(net.Error); ok {
+		return NetworkUnreachable
+	}
+	return Uncategorized
+}
+
+// Hint returns the user-facing explanation of the failure and the suggested action.
+// Both are empty for uncategorized errors.
+func (c ErrorCategory) Hint() (explanation, action string) {
+	switch c {
+	case NetworkUnreachable:
+		return "The Ethereum node, the Nym blockchain or the issuing authorities could not be reached.",
+			"Check your internet connection and the addresses in the config file, then try again."
+	case InsufficientBalance:
+		return "The account does not hold enough tokens for the operation.",
+			"Get more Nyms from the faucet or pick a smaller amount."
+	case AccountMissing:
+		return "The account is not registered on the Nym blockchain.",
+			"Register the account first."
+	case DoubleSpend:
+		return "The credential has already been spent.",
+			"Obtain a new credential and spend that one instead."
+	case ThresholdNotMet:
+		return "Not enough issuing authorities have signed the credential.",
+			"Wait until more issuing authorities are available and try again."
+	case TxReverted:
+		return "The Ethereum transaction was reverted.",
+			"Make sure the account has enough Ether for the transaction fees and try again."
+	}
+	return "", ""
+}
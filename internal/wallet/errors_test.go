@@ -0,0 +1,96 @@
+// errors_test.go - tests of the classification of the wallet errors
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package wallet_test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/nymtech/qt-validator-client-demo/internal/wallet"
+)
+
+// timeoutError is a network error whose message is not recognised by any of the patterns.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "deadline reached" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err      error
+		category wallet.ErrorCategory
+	}{
+		{nil, wallet.Uncategorized},
+		{errors.New("something went wrong"), wallet.Uncategorized},
+
+		{errors.New("the credential was already spent"), wallet.DoubleSpend},
+		{errors.New("Double Spend detected"), wallet.DoubleSpend},
+		{wallet.ErrCredentialSpent, wallet.DoubleSpend},
+		// the more specific patterns win
+		{errors.New("already spent: insufficient balance"), wallet.DoubleSpend},
+
+		{errors.New("insufficient balance"), wallet.InsufficientBalance},
+		{errors.New("transfer amount exceeds balance"), wallet.InsufficientBalance},
+
+		{errors.New("threshold not met"), wallet.ThresholdNotMet},
+		{errors.New("Not enough IA responses"), wallet.ThresholdNotMet},
+		{errors.New("could not aggregate the signatures"), wallet.ThresholdNotMet},
+		// unrelated thresholds are not mistaken for the one of the issuing authorities
+		{errors.New("invalid threshold in '1:5:x': strconv.Atoi: parsing \"x\": invalid syntax"), wallet.Uncategorized},
+		{errors.New("the threshold for 1Nym credentials must be between 0 and 4"), wallet.Uncategorized},
+
+		{errors.New("execution reverted"), wallet.TxReverted},
+		{errors.New("out of gas"), wallet.TxReverted},
+
+		{errors.New("account does not exist"), wallet.AccountMissing},
+		{errors.New("the account is not registered"), wallet.AccountMissing},
+
+		{errors.New("dial tcp 127.0.0.1:8545: connect: connection refused"), wallet.NetworkUnreachable},
+		{fmt.Errorf("could not update the balances: %v", errors.New("lookup node: no such host")), wallet.NetworkUnreachable},
+		{timeoutError{}, wallet.NetworkUnreachable},
+	}
+
+	for _, test := range tests {
+		if category := wallet.ClassifyError(test.err); category != test.category {
+			t.Errorf("expected %v to be classified as %q, got %q", test.err, test.category, category)
+		}
+	}
+}
+
+func TestErrorHints(t *testing.T) {
+	categories := []wallet.ErrorCategory{
+		wallet.NetworkUnreachable,
+		wallet.InsufficientBalance,
+		wallet.AccountMissing,
+		wallet.DoubleSpend,
+		wallet.ThresholdNotMet,
+		wallet.TxReverted,
+	}
+	for _, category := range categories {
+		if explanation, action := category.Hint(); explanation == "" || action == "" {
+			t.Errorf("missing hint of %q", category)
+		}
+	}
+	if explanation, action := wallet.Uncategorized.Hint(); explanation != "" || action != "" {
+		t.Errorf("expected no hint of uncategorized errors, got %q and %q", explanation, action)
+	}
+}
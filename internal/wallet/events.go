@@ -0,0 +1,93 @@
+// events.go - events published by the wallet
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package wallet
+
+import (
+	"fmt"
+
+	"github.com/nymtech/qt-validator-client-demo/internal/sensitive"
+)
+
+// BalanceKind defines which of the account balances has changed.
+type BalanceKind int
+
+const (
+	// ERC20Balance is the balance of ERC20 Nym tokens on Ethereum.
+	ERC20Balance BalanceKind = iota
+	// ERC20PendingBalance is the amount of ERC20 Nym tokens in transit through the pipe account.
+	ERC20PendingBalance
+	// NymBalance is the balance of Nym tokens on the Nym blockchain.
+	NymBalance
+)
+
+// Event is published by the wallet whenever its state has changed,
+// so that any user interface could reflect the change.
+type Event interface {
+	isEvent()
+}
+
+// BalanceChangedEvent is published when a new value of one of the balances is known.
+type BalanceChangedEvent struct {
+	Kind   BalanceKind
+	Amount uint64
+}
+
+// CredentialAddedEvent is published when a credential is obtained or restored from the storage.
+type CredentialAddedEvent struct {
+	Credential Credential
+}
+
+// CredentialStateChangedEvent is published when a credential starts being spent and once the attempt is over.
+type CredentialStateChangedEvent struct {
+	ID    string
+	State CredentialState
+}
+
+// AccountStatusEvent is published when existence of the account on the Nym blockchain is determined.
+type AccountStatusEvent struct {
+	Exists bool
+}
+
+// SecretChangedEvent is published when the long-term secret of the wallet is loaded or set.
+type SecretChangedEvent struct {
+	// Secret is the display representation of the long-term secret.
+	Secret string
+}
+
+// Format implements fmt.Formatter, so that the secret would not end up in any logs.
+func (ev SecretChangedEvent) Format(f fmt.State, verb rune) {
+	fmt.Fprintf(f, "SecretChangedEvent{%v}", sensitive.Redacted)
+}
+
+// LedgerEntryAddedEvent is published when an operation has finished and was recorded in the ledger.
+type LedgerEntryAddedEvent struct {
+	Entry LedgerEntry
+}
+
+// ErrorEvent is published when an error occurs that is not a direct result of any call,
+// for example during the background polling of balances.
+type ErrorEvent struct {
+	Err error
+}
+
+func (BalanceChangedEvent) isEvent()         {}
+func (CredentialAddedEvent) isEvent()        {}
+func (CredentialStateChangedEvent) isEvent() {}
+func (AccountStatusEvent) isEvent()          {}
+func (SecretChangedEvent) isEvent()          {}
+func (LedgerEntryAddedEvent) isEvent()       {}
+func (ErrorEvent) isEvent()                  {}
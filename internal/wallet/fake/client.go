@@ -0,0 +1,321 @@
+// client.go - deterministic in-process fake of the Nym client
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package fake provides an in-process implementation of the wallet.Client that does not require
+// any Issuing Authorities, Tendermint or Ethereum nodes to be running.
+// All the results it produces are deterministic, which makes it suitable for testing the wallet flows.
+package fake
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	Curve "github.com/nymtech/amcl/version3/go/amcl/BLS381"
+	coconut "github.com/nymtech/nym-validator/crypto/coconut/scheme"
+	"github.com/nymtech/nym-validator/crypto/coconut/utils"
+	"github.com/nymtech/nym-validator/crypto/elgamal"
+	"github.com/nymtech/nym-validator/nym/token"
+	"github.com/nymtech/qt-validator-client-demo/internal/wallet"
+)
+
+// Method identifies a method of the client for the purpose of error injection.
+type Method string
+
+// All the methods of the client that can be made to fail.
+const (
+	GetCredential                 Method = "GetCredential"
+	SpendCredential               Method = "SpendCredential"
+	SendToPipeAccount             Method = "SendToPipeAccount"
+	RedeemTokens                  Method = "RedeemTokens"
+	WaitForBalanceChange          Method = "WaitForBalanceChange"
+	GetCurrentERC20Balance        Method = "GetCurrentERC20Balance"
+	GetCurrentERC20PendingBalance Method = "GetCurrentERC20PendingBalance"
+	GetCurrentNymBalance          Method = "GetCurrentNymBalance"
+	MakeFaucetRequest             Method = "MakeFaucetRequest"
+	WaitForEthereumTxToResolve    Method = "WaitForEthereumTxToResolve"
+	CheckAccountExistence         Method = "CheckAccountExistence"
+	RegisterAccount               Method = "RegisterAccount"
+)
+
+const pollingRate = 10 * time.Millisecond
+
+var _ wallet.Client = (*Client)(nil)
+
+var (
+	// ErrInsufficientBalance is returned when the fake account does not have enough funds for the operation.
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	// ErrAccountNotRegistered is returned when an operation requires the account to exist on the Nym blockchain.
+	ErrAccountNotRegistered = errors.New("account does not exist")
+)
+
+// Client is a deterministic, in-memory implementation of the wallet.Client.
+// Its balances can be freely modified and any of its methods can be made to fail by setting the error
+// to return with SetError. It is safe for concurrent use.
+type Client struct {
+	sync.Mutex
+
+	erc20Balance        uint64
+	erc20PendingBalance uint64
+	nymBalance          uint64
+	accountExists       bool
+
+	// counter used to generate all 'random' values
+	counter int64
+
+	spent  map[string]bool
+	errors map[Method]error
+}
+
+// NewClient creates new instance of the fake client with the provided initial ERC20 balance.
+func NewClient(erc20Balance uint64) *Client {
+	return &Client{
+		erc20Balance: erc20Balance,
+		spent:        make(map[string]bool),
+		errors:       make(map[Method]error),
+	}
+}
+
+// SetError makes all subsequent calls to the method return the provided error.
+// Setting it to nil restores the normal behaviour.
+func (c *Client) SetError(method Method, err error) {
+	c.Lock()
+	defer c.Unlock()
+	if err == nil {
+		delete(c.errors, method)
+		return
+	}
+	c.errors[method] = err
+}
+
+// SetBalances overwrites all the balances of the fake account.
+func (c *Client) SetBalances(erc20, erc20Pending, nym uint64) {
+	c.Lock()
+	defer c.Unlock()
+	c.erc20Balance = erc20
+	c.erc20PendingBalance = erc20Pending
+	c.nymBalance = nym
+}
+
+// SetAccountExists sets existence status of the fake account on the Nym blockchain.
+func (c *Client) SetAccountExists(exists bool) {
+	c.Lock()
+	defer c.Unlock()
+	c.accountExists = exists
+}
+
+// must be called with the lock held
+func (c *Client) next() int64 {
+	c.counter++
+	return c.counter
+}
+
+// must be called with the lock held
+func (c *Client) signature(multiplier *Curve.BIG) *coconut.Signature {
+	g := Curve.ECP_generator()
+	return coconut.NewSignature(Curve.G1mul(g, multiplier), Curve.G1mul(g, Curve.NewBIGint(int(c.next()))))
+}
+
+// RandomBIG returns consecutive integers starting from 1.
+func (c *Client) RandomBIG() *Curve.BIG {
+	c.Lock()
+	defer c.Unlock()
+	return Curve.NewBIGint(int(c.next()))
+}
+
+// GetCredential 'signs' the token, which deducts its value from the Nym balance.
+func (c *Client) GetCredential(token *token.Token) (*coconut.Signature, error) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.errors[GetCredential]; err != nil {
+		return nil, err
+	}
+	if !c.accountExists {
+		return nil, ErrAccountNotRegistered
+	}
+	if c.nymBalance < uint64(token.Value()) {
+		return nil, ErrInsufficientBalance
+	}
+	c.nymBalance -= uint64(token.Value())
+	return c.signature(token.Sequence()), nil
+}
+
+// SpendCredential accepts each token sequence exactly once, mimicking double spending detection of the validators.
+func (c *Client) SpendCredential(token *token.Token,
+	cred *coconut.Signature,
+	address string,
+	providerAccount ethcommon.Address,
+	egPub *elgamal.PublicKey,
+) (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.errors[SpendCredential]; err != nil {
+		return false, err
+	}
+	seq := utils.ToCoconutString(token.Sequence())
+	if c.spent[seq] {
+		return false, nil
+	}
+	c.spent[seq] = true
+	return true, nil
+}
+
+// ForceReRandomizeCredential returns a new signature with the same first element.
+func (c *Client) ForceReRandomizeCredential(sig *coconut.Signature) *coconut.Signature {
+	c.Lock()
+	defer c.Unlock()
+	g := Curve.ECP_generator()
+	return coconut.NewSignature(sig.Sig1(), Curve.G1mul(g, Curve.NewBIGint(int(c.next()))))
+}
+
+// SendToPipeAccount immediately moves the amount from the ERC20 balance to the Nym balance.
+func (c *Client) SendToPipeAccount(ctx context.Context, amount int64) error {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.errors[SendToPipeAccount]; err != nil {
+		return err
+	}
+	if c.erc20Balance < uint64(amount) {
+		return ErrInsufficientBalance
+	}
+	c.erc20Balance -= uint64(amount)
+	c.nymBalance += uint64(amount)
+	return nil
+}
+
+// RedeemTokens immediately moves the amount from the Nym balance to the ERC20 balance.
+func (c *Client) RedeemTokens(ctx context.Context, amount uint64) error {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.errors[RedeemTokens]; err != nil {
+		return err
+	}
+	if c.nymBalance < amount {
+		return ErrInsufficientBalance
+	}
+	c.nymBalance -= amount
+	c.erc20Balance += amount
+	return nil
+}
+
+// WaitForBalanceChange blocks until the Nym balance is equal to the expected value or the context is done.
+func (c *Client) WaitForBalanceChange(ctx context.Context, expectedBalance uint64) error {
+	ticker := time.NewTicker(pollingRate)
+	defer ticker.Stop()
+	for {
+		c.Lock()
+		err := c.errors[WaitForBalanceChange]
+		balance := c.nymBalance
+		c.Unlock()
+
+		if err != nil {
+			return err
+		}
+		if balance == expectedBalance {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// GetCurrentERC20Balance returns the current ERC20 balance.
+func (c *Client) GetCurrentERC20Balance() (uint64, error) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.errors[GetCurrentERC20Balance]; err != nil {
+		return 0, err
+	}
+	return c.erc20Balance, nil
+}
+
+// GetCurrentERC20PendingBalance returns the current pending ERC20 balance.
+func (c *Client) GetCurrentERC20PendingBalance() (uint64, error) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.errors[GetCurrentERC20PendingBalance]; err != nil {
+		return 0, err
+	}
+	return c.erc20PendingBalance, nil
+}
+
+// GetCurrentNymBalance returns the current Nym balance.
+func (c *Client) GetCurrentNymBalance() (uint64, error) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.errors[GetCurrentNymBalance]; err != nil {
+		return 0, err
+	}
+	if !c.accountExists {
+		return 0, ErrAccountNotRegistered
+	}
+	return c.nymBalance, nil
+}
+
+func (c *Client) hash() ethcommon.Hash {
+	var h ethcommon.Hash
+	binary.BigEndian.PutUint64(h[ethcommon.HashLength-8:], uint64(c.next()))
+	return h
+}
+
+// MakeFaucetRequest immediately credits the ERC20 balance and returns two distinct transaction hashes.
+func (c *Client) MakeFaucetRequest(ctx context.Context, amount int64) (ethcommon.Hash, ethcommon.Hash, error) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.errors[MakeFaucetRequest]; err != nil {
+		return ethcommon.Hash{}, ethcommon.Hash{}, err
+	}
+	c.erc20Balance += uint64(amount)
+	return c.hash(), c.hash(), nil
+}
+
+// WaitForEthereumTxToResolve reports every transaction as successful.
+func (c *Client) WaitForEthereumTxToResolve(ctx context.Context, txHash ethcommon.Hash) (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.errors[WaitForEthereumTxToResolve]; err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CheckAccountExistence returns the existence status of the fake account.
+func (c *Client) CheckAccountExistence() (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.errors[CheckAccountExistence]; err != nil {
+		return false, err
+	}
+	return c.accountExists, nil
+}
+
+// RegisterAccount marks the fake account as existing.
+func (c *Client) RegisterAccount(accountCredential []byte) error {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.errors[RegisterAccount]; err != nil {
+		return err
+	}
+	c.accountExists = true
+	return nil
+}
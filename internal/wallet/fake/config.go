@@ -0,0 +1,63 @@
+// config.go - config of the wallets backed by the fake client
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package fake
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// ServiceProvider is the address of the only service provider listed in the config written by WriteConfig.
+const ServiceProvider = "127.0.0.1:4100"
+
+// none of the addresses is ever contacted by the fake client
+const configTemplate = `
+[Client]
+  Identifier = "TestClient"
+  IAAddresses = [ "127.0.0.1:4000", "127.0.0.1:4001", "127.0.0.1:4002" ]
+  UseGRPC = false
+  MaxRequests = 4
+  Threshold = 3
+  MaximumAttributes = 5
+
+[Nym]
+  AccountKeysFile = %q
+  BlockchainNodeAddresses = [ "127.0.0.1:26657" ]
+  EthereumNodeAddresses = [ "127.0.0.1:8545" ]
+  NymContract = "0xE80025228D5448A55B995c829B89567ECE5203d3"
+  PipeAccount = "0xb749305b3293477b4d6b498b22db5353c9acb3f1"
+  FaucetAddress = "127.0.0.1:9000"
+
+  [Nym.ServiceProviders]
+    %q = "0x5F828924E58f98f3dA07596F392fCB094aC818ad"
+
+[Logging]
+  Disable = true
+  Level = "INFO"
+`
+
+// WriteConfig writes a valid client config to config.toml in the directory and returns its path.
+// The account key file, which is not created, is located in the same directory.
+func WriteConfig(dir string) (string, error) {
+	cfgFile := filepath.Join(dir, "config.toml")
+	keyFile := filepath.Join(dir, "account.key")
+	if err := ioutil.WriteFile(cfgFile, []byte(fmt.Sprintf(configTemplate, keyFile, ServiceProvider)), 0600); err != nil {
+		return "", err
+	}
+	return cfgFile, nil
+}
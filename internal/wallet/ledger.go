@@ -0,0 +1,152 @@
+// ledger.go - history of all operations performed with the wallet
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package wallet
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nymtech/qt-validator-client-demo/internal/storage"
+)
+
+// OperationType identifies the kind of operation recorded in the ledger.
+type OperationType string
+
+// All the operations that are recorded in the ledger.
+const (
+	PipeTransfer       OperationType = "pipe transfer"
+	Redemption         OperationType = "redemption"
+	FaucetRequest      OperationType = "faucet request"
+	Registration       OperationType = "registration"
+	CredentialIssuance OperationType = "credential issuance"
+	CredentialSpend    OperationType = "credential spend"
+)
+
+// OperationTypes returns all the operation types in the order they should be presented to the user.
+func OperationTypes() []OperationType {
+	return []OperationType{PipeTransfer, Redemption, FaucetRequest, Registration, CredentialIssuance, CredentialSpend}
+}
+
+// LedgerEntry describes a single operation performed with the wallet and its outcome.
+type LedgerEntry struct {
+	Type OperationType `json:"type"`
+	Time time.Time     `json:"time"`
+	// Amount is the number of Nyms involved in the operation.
+	Amount int64 `json:"amount"`
+	// EthereumTxs are hex encoded hashes of the Ethereum transactions made by the operation, if known.
+	EthereumTxs []string `json:"ethereumTxs,omitempty"`
+	// TendermintResult describes the outcome of the operation as reported by the Nym blockchain, if any.
+	TendermintResult string `json:"tendermintResult,omitempty"`
+	// Details contains any additional operation-specific information, such as the service provider.
+	Details string `json:"details,omitempty"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	// ErrorCategory is the recognised cause of the failure, if any.
+	ErrorCategory ErrorCategory `json:"errorCategory,omitempty"`
+}
+
+// LedgerFilter selects entries of the ledger. Its zero value matches all of them.
+type LedgerFilter struct {
+	// Types of the operations to include, empty slice includes all of them.
+	Types []OperationType
+	// From and To restrict the time of the operations to the given range (inclusive),
+	// zero values leave the range unbounded.
+	From time.Time
+	To   time.Time
+}
+
+// Matches checks whether the entry satisfies the filter.
+func (f LedgerFilter) Matches(entry LedgerEntry) bool {
+	if !f.From.IsZero() && entry.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && entry.Time.After(f.To) {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if t == entry.Type {
+			return true
+		}
+	}
+	return false
+}
+
+func ledgerEntryFromRecord(rec storage.LedgerRecord) LedgerEntry {
+	return LedgerEntry{
+		Type:             OperationType(rec.Type),
+		Time:             rec.Time,
+		Amount:           rec.Amount,
+		EthereumTxs:      rec.EthereumTxs,
+		TendermintResult: rec.TendermintResult,
+		Details:          rec.Details,
+		Success:          rec.Success,
+		Error:            rec.Error,
+		ErrorCategory:    ErrorCategory(rec.ErrorCategory),
+	}
+}
+
+func (e *LedgerEntry) record() storage.LedgerRecord {
+	return storage.LedgerRecord{
+		Type:             string(e.Type),
+		Time:             e.Time,
+		Amount:           e.Amount,
+		EthereumTxs:      e.EthereumTxs,
+		TendermintResult: e.TendermintResult,
+		Details:          e.Details,
+		Success:          e.Success,
+		Error:            e.Error,
+		ErrorCategory:    string(e.ErrorCategory),
+	}
+}
+
+// Ledger returns all the recorded operations matching the filter, in the order they were performed.
+func (w *Wallet) Ledger(filter LedgerFilter) ([]LedgerEntry, error) {
+	store := w.storage()
+	if store == nil {
+		return nil, ErrWalletNotOpened
+	}
+
+	var entries []LedgerEntry
+	for _, rec := range store.Ledger() {
+		entry := ledgerEntryFromRecord(rec)
+		if filter.Matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// recordOperation completes the entry with the outcome of the operation, appends it to the ledger and publishes it.
+// It is meant to be deferred by the operations, hence failure to persist the entry is only published as an ErrorEvent.
+func (w *Wallet) recordOperation(entry *LedgerEntry, err error) {
+	entry.Time = time.Now()
+	entry.Success = err == nil
+	if err != nil {
+		entry.Error = err.Error()
+		entry.ErrorCategory = ClassifyError(err)
+	}
+
+	if store := w.storage(); store != nil {
+		if storeErr := store.AddLedgerRecord(entry.record()); storeErr != nil {
+			w.publish(ErrorEvent{fmt.Errorf("could not save the %v in the ledger: %v", entry.Type, storeErr)})
+		}
+	}
+	w.publish(LedgerEntryAddedEvent{*entry})
+}
@@ -0,0 +1,314 @@
+// pool.go - keeping a stock of unspent credentials
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// poolCheckInterval is how often the pool is checked even if no credential was spent in the meantime,
+// for example to retry after a failure.
+const poolCheckInterval = time.Minute
+
+// ErrPoolBudgetExhausted is returned when the pool needs replenishing, but its budget does not allow it.
+var ErrPoolBudgetExhausted = errors.New("the budget of the credential pool is exhausted")
+
+// PoolTarget defines how many unspent credentials of a single value are kept in the pool.
+type PoolTarget struct {
+	// Target is the number of unspent credentials the pool is replenished to.
+	Target int `json:"target"`
+	// Threshold is the number of unspent credentials at or below which the pool gets replenished.
+	// It must be smaller than the target.
+	Threshold int `json:"threshold"`
+}
+
+// ParsePoolTarget parses the target of a single value in the <value>:<target>:<threshold> format.
+func ParsePoolTarget(s string) (int64, PoolTarget, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 3 {
+		return 0, PoolTarget{}, fmt.Errorf("invalid pool target '%v', expected <value>:<target>:<threshold>", s)
+	}
+
+	value, err := strconv.ParseInt(strings.TrimSuffix(parts[0], "Nym"), 10, 64)
+	if err != nil {
+		return 0, PoolTarget{}, fmt.Errorf("invalid credential value in '%v': %v", s, err)
+	}
+	target, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, PoolTarget{}, fmt.Errorf("invalid target in '%v': %v", s, err)
+	}
+	threshold, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return 0, PoolTarget{}, fmt.Errorf("invalid threshold in '%v': %v", s, err)
+	}
+	return value, PoolTarget{Target: target, Threshold: threshold}, nil
+}
+
+// PoolConfig defines the credential pool.
+type PoolConfig struct {
+	// Targets of the pool by the credential values.
+	Targets map[int64]PoolTarget
+	// Budget is the maximum number of Nyms that can be spent on replenishing the pool.
+	Budget int64
+}
+
+// Validate checks whether the config only refers to the allowed values and whether the targets make sense.
+func (cfg PoolConfig) Validate(allowedValues []int64) error {
+	if len(cfg.Targets) == 0 {
+		return errors.New("no pool targets are defined")
+	}
+	if cfg.Budget <= 0 {
+		return errors.New("the budget of the pool must be positive")
+	}
+	for value, target := range cfg.Targets {
+		allowed := false
+		for _, v := range allowedValues {
+			allowed = allowed || v == value
+		}
+		if !allowed {
+			return fmt.Errorf("%v is not an allowed credential value", value)
+		}
+		if target.Target <= 0 || target.Target > MaxBatchSize {
+			return fmt.Errorf("the target for %vNym credentials must be between 1 and %v", value, MaxBatchSize)
+		}
+		if target.Threshold < 0 || target.Threshold >= target.Target {
+			return fmt.Errorf("the threshold for %vNym credentials must be between 0 and %v", value, target.Target-1)
+		}
+	}
+	return nil
+}
+
+// PoolStatus is a snapshot of the state of the credential pool.
+type PoolStatus struct {
+	Running bool `json:"running"`
+	// Unspent is the number of unspent credentials of each value.
+	Unspent map[int64]int `json:"unspent"`
+	// Spent is the number of Nyms spent on replenishing the pool so far.
+	Spent  int64 `json:"spent"`
+	Budget int64 `json:"budget"`
+	// LastError is the failure of the most recent replenishment, if any.
+	LastError string `json:"lastError,omitempty"`
+}
+
+type pool struct {
+	cfg PoolConfig
+
+	sync.Mutex
+	spent     int64
+	lastError string
+
+	trigger chan struct{}
+	cancel  context.CancelFunc
+}
+
+// unspentCounts returns the number of credentials of each value that can be spent right now.
+func (w *Wallet) unspentCounts() map[int64]int {
+	counts := make(map[int64]int)
+	for _, cred := range w.credentials.list() {
+		if cred.State == Unspent {
+			counts[cred.Value]++
+		}
+	}
+	return counts
+}
+
+// poolDeficit returns the values of the credentials needed to bring all the values that dropped to
+// their threshold back to their targets, the smallest ones first.
+func (w *Wallet) poolDeficit(cfg PoolConfig) []int64 {
+	unspent := w.unspentCounts()
+
+	var values []int64
+	for value, target := range cfg.Targets {
+		if unspent[value] > target.Threshold {
+			continue
+		}
+		for i := unspent[value]; i < target.Target; i++ {
+			values = append(values, value)
+		}
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	return values
+}
+
+// ReplenishPool obtains the credentials of all the values whose number of unspent credentials dropped to
+// their threshold, using at most the budget. If the budget does not suffice for all of them, the ones that fit
+// are obtained and ErrPoolBudgetExhausted is returned. The result is nil if no credential was needed.
+func (w *Wallet) ReplenishPool(ctx context.Context, cfg PoolConfig, budget int64) (*BatchResult, error) {
+	needed := w.poolDeficit(cfg)
+	if len(needed) == 0 {
+		return nil, nil
+	}
+
+	var values []int64
+	var amount int64
+	for _, value := range needed {
+		if amount+value > budget {
+			break
+		}
+		amount += value
+		values = append(values, value)
+	}
+	if len(values) == 0 {
+		return nil, ErrPoolBudgetExhausted
+	}
+
+	if err := w.checkNymBalance(amount); err != nil {
+		return nil, err
+	}
+	res, err := w.getCredentials(ctx, values)
+	if err == nil && len(values) < len(needed) {
+		err = ErrPoolBudgetExhausted
+	}
+	return res, err
+}
+
+// StartPool starts replenishing the credential pool in the background, whenever a credential is spent and
+// periodically. Any pool that is already running gets stopped first. The failures are published as ErrorEvents.
+func (w *Wallet) StartPool(cfg PoolConfig) error {
+	if err := cfg.Validate(w.AllowedValues()); err != nil {
+		return err
+	}
+	w.StopPool()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &pool{
+		cfg:     cfg,
+		trigger: make(chan struct{}, 1),
+		cancel:  cancel,
+	}
+	w.poolLock.Lock()
+	w.pool = p
+	w.poolLock.Unlock()
+
+	w.poolRuns.Add(1)
+	go w.runPool(ctx, p)
+	w.poolChanged()
+	return nil
+}
+
+// StopPool stops the credential pool without waiting for it, so it can be called from the UI thread.
+// The running replenishment is aborted, but the issuance of a credential can't be aborted once started,
+// hence the credentials being issued are still added to the wallet once they are obtained.
+func (w *Wallet) StopPool() {
+	w.poolLock.Lock()
+	p := w.pool
+	w.pool = nil
+	w.poolLock.Unlock()
+
+	if p != nil {
+		p.cancel()
+	}
+}
+
+// afterPoolsExited calls f in the background once all the stopped pools have finished their last replenishment.
+func (w *Wallet) afterPoolsExited(f func()) {
+	go func() {
+		w.poolRuns.Wait()
+		f()
+	}()
+}
+
+// PoolStatus returns the state of the credential pool.
+func (w *Wallet) PoolStatus() PoolStatus {
+	status := PoolStatus{Unspent: w.unspentCounts()}
+
+	w.poolLock.Lock()
+	p := w.pool
+	w.poolLock.Unlock()
+	if p == nil {
+		return status
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	status.Running = true
+	status.Spent = p.spent
+	status.Budget = p.cfg.Budget
+	status.LastError = p.lastError
+	return status
+}
+
+// poolChanged wakes up the pool, if any is running, to check whether it needs replenishing.
+func (w *Wallet) poolChanged() {
+	w.poolLock.Lock()
+	p := w.pool
+	w.poolLock.Unlock()
+
+	if p == nil {
+		return
+	}
+	select {
+	case p.trigger <- struct{}{}:
+	default:
+		// a check is already pending
+	}
+}
+
+// runPool replenishes the pool until its context is cancelled. Once stopped, the pool is no longer referenced
+// by the wallet, so it only ever touches its own state.
+func (w *Wallet) runPool(ctx context.Context, p *pool) {
+	defer w.poolRuns.Done()
+
+	ticker := time.NewTicker(poolCheckInterval)
+	defer ticker.Stop()
+
+	// the exhausted budget is only reported once, as the pool keeps running into it until it is stopped
+	budgetReported := false
+	for {
+		select {
+		case <-p.trigger:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		p.Lock()
+		budget := p.cfg.Budget - p.spent
+		p.Unlock()
+
+		res, err := w.ReplenishPool(ctx, p.cfg, budget)
+		p.Lock()
+		if res != nil {
+			p.spent += res.SpentAmount()
+		}
+		p.lastError = ""
+		if err != nil {
+			p.lastError = err.Error()
+		}
+		p.Unlock()
+
+		if ctx.Err() != nil {
+			return
+		}
+		switch {
+		case err == ErrPoolBudgetExhausted:
+			if !budgetReported {
+				w.publish(ErrorEvent{err})
+				budgetReported = true
+			}
+		case err != nil:
+			w.publish(ErrorEvent{fmt.Errorf("could not replenish the credential pool: %v", err)})
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// registry.go - concurrency-safe collection of issued credentials
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package wallet
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	coconut "github.com/nymtech/nym-validator/crypto/coconut/scheme"
+)
+
+// credentialRegistry holds all the credentials of the wallet indexed by their sequence numbers.
+// Credentials are obtained, spent and re-randomized by concurrently running operations,
+// hence all accesses go through the registry and callers only ever receive copies of the entries.
+type credentialRegistry struct {
+	sync.RWMutex
+	credentials map[string]*issuedCredential
+}
+
+func newCredentialRegistry() *credentialRegistry {
+	return &credentialRegistry{
+		credentials: make(map[string]*issuedCredential),
+	}
+}
+
+// clear removes all the credentials.
+func (r *credentialRegistry) clear() {
+	r.Lock()
+	defer r.Unlock()
+
+	r.credentials = make(map[string]*issuedCredential)
+}
+
+// add inserts the credential unless one with the same id already exists, which is indicated by the return value.
+func (r *credentialRegistry) add(id string, ic issuedCredential) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	if _, ok := r.credentials[id]; ok {
+		return false
+	}
+	r.credentials[id] = &ic
+	return true
+}
+
+func (r *credentialRegistry) get(id string) (issuedCredential, bool) {
+	r.RLock()
+	defer r.RUnlock()
+
+	ic, ok := r.credentials[id]
+	if !ok {
+		return issuedCredential{}, false
+	}
+	return *ic, true
+}
+
+// beginSpend marks the credential as pending and returns its copy. Each credential can only be spent
+// by a single operation at a time, which must call endSpend once it is done. Credentials known to be spent
+// are refused unless forced.
+func (r *credentialRegistry) beginSpend(id string, force bool) (issuedCredential, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	ic, ok := r.credentials[id]
+	if !ok {
+		return issuedCredential{}, fmt.Errorf("no credential exists for that sequence number (%v)", id)
+	}
+	if ic.pending {
+		return issuedCredential{}, fmt.Errorf("credential %v is already being spent", id)
+	}
+	if ic.spent && !force {
+		return issuedCredential{}, ErrCredentialSpent
+	}
+	ic.pending = true
+	return *ic, nil
+}
+
+// endSpend clears the pending flag of the credential, marking it as spent if the operation did so,
+// and returns its resulting state.
+func (r *credentialRegistry) endSpend(id string, spent bool) CredentialState {
+	r.Lock()
+	defer r.Unlock()
+
+	ic, ok := r.credentials[id]
+	if !ok {
+		return Unspent
+	}
+	ic.pending = false
+	if spent {
+		ic.spent = true
+	}
+	return ic.state()
+}
+
+// setSignature replaces the signature of the credential. It returns false if the credential does not exist.
+func (r *credentialRegistry) setSignature(id string, sig *coconut.Signature) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	ic, ok := r.credentials[id]
+	if !ok {
+		return false
+	}
+	ic.credential = sig
+	return true
+}
+
+// list returns public views of all the credentials ordered by their ids.
+func (r *credentialRegistry) list() []Credential {
+	r.RLock()
+	defer r.RUnlock()
+
+	creds := make([]Credential, 0, len(r.credentials))
+	for id, ic := range r.credentials {
+		creds = append(creds, ic.info(id))
+	}
+	sort.Slice(creds, func(i, j int) bool { return creds[i].ID < creds[j].ID })
+	return creds
+}
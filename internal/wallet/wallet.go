@@ -0,0 +1,704 @@
+// wallet.go - Nym wallet service
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package wallet implements all operations of the Nym wallet independently of any user interface.
+package wallet
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+	Curve "github.com/nymtech/amcl/version3/go/amcl/BLS381"
+	"github.com/nymtech/nym-validator/client"
+	"github.com/nymtech/nym-validator/client/config"
+	coconut "github.com/nymtech/nym-validator/crypto/coconut/scheme"
+	"github.com/nymtech/nym-validator/crypto/coconut/utils"
+	"github.com/nymtech/nym-validator/crypto/elgamal"
+	"github.com/nymtech/nym-validator/nym/token"
+	"github.com/nymtech/qt-validator-client-demo/internal/jobs"
+	"github.com/nymtech/qt-validator-client-demo/internal/keystore"
+	"github.com/nymtech/qt-validator-client-demo/internal/mnemonic"
+	"github.com/nymtech/qt-validator-client-demo/internal/sensitive"
+	"github.com/nymtech/qt-validator-client-demo/internal/storage"
+)
+
+const (
+	// WalletFileSuffix is appended to the path of the account keyfile to obtain location of the wallet file.
+	WalletFileSuffix = ".wallet"
+
+	// DefaultOperationTimeout is the suggested deadline for operations waiting for Ethereum transactions.
+	DefaultOperationTimeout = 10 * time.Minute
+
+	eventsBufferSize   = 64
+	balancePollingRate = 2 * time.Second
+)
+
+var (
+	// ErrWalletNotOpened is returned when operation requiring the storage is called before OpenStore or CreateStore.
+	ErrWalletNotOpened = errors.New("the wallet is not loaded")
+	// ErrNoSecret is returned on attempt to obtain a credential before the long-term secret was set.
+	ErrNoSecret = errors.New("no long-term secret is loaded - please generate or import one first")
+	// ErrCredentialSpent is returned on attempt to spend a credential that is known to be spent, unless forced.
+	ErrCredentialSpent = errors.New("the credential has already been spent")
+	// ErrStoreNotExist is returned on attempt to open a wallet that was not created yet.
+	ErrStoreNotExist = errors.New("the wallet does not exist yet - please create it first")
+	// ErrEmptyPassphrase is returned on attempt to protect the wallet with an empty passphrase.
+	ErrEmptyPassphrase = errors.New("the passphrase must not be empty")
+	// ErrWalletWiped is returned by the operations of a wallet that was wiped, for example when it got locked.
+	ErrWalletWiped = errors.New("the wallet was locked")
+)
+
+// Balances represents all the balances associated with the account.
+type Balances struct {
+	ERC20        uint64
+	ERC20Pending uint64
+	Nym          uint64
+}
+
+// BalanceError is returned when some of the balances could not be obtained.
+// Nil fields indicate queries that have succeeded.
+type BalanceError struct {
+	ERC20        error
+	ERC20Pending error
+	Nym          error
+}
+
+func (e *BalanceError) Error() string {
+	var msgs []string
+	if e.ERC20 != nil {
+		msgs = append(msgs, fmt.Sprintf("failed to query for ERC20 Nym Balance: %v", e.ERC20))
+	}
+	if e.ERC20Pending != nil {
+		msgs = append(msgs, fmt.Sprintf("failed to query for ERC20 Nym Balance (pending): %v", e.ERC20Pending))
+	}
+	if e.Nym != nil {
+		msgs = append(msgs, fmt.Sprintf("failed to query for Nym Token Balance: %v", e.Nym))
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Client defines all the operations of the Nym client that are used by the wallet.
+// It is satisfied by *client.Client from nym-validator.
+type Client interface {
+	RandomBIG() *Curve.BIG
+	GetCredential(token *token.Token) (*coconut.Signature, error)
+	SpendCredential(token *token.Token, cred *coconut.Signature, address string, providerAccount ethcommon.Address, egPub *elgamal.PublicKey) (bool, error)
+	ForceReRandomizeCredential(sig *coconut.Signature) *coconut.Signature
+	SendToPipeAccount(ctx context.Context, amount int64) error
+	RedeemTokens(ctx context.Context, amount uint64) error
+	WaitForBalanceChange(ctx context.Context, expectedBalance uint64) error
+	GetCurrentERC20Balance() (uint64, error)
+	GetCurrentERC20PendingBalance() (uint64, error)
+	GetCurrentNymBalance() (uint64, error)
+	MakeFaucetRequest(ctx context.Context, amount int64) (ethcommon.Hash, ethcommon.Hash, error)
+	WaitForEthereumTxToResolve(ctx context.Context, txHash ethcommon.Hash) (bool, error)
+	CheckAccountExistence() (bool, error)
+	RegisterAccount(accountCredential []byte) error
+}
+
+var _ Client = (*client.Client)(nil)
+
+// Wallet exposes all operations available to the holder of a Nym account.
+// It is safe for concurrent use.
+type Wallet struct {
+	cfg *config.Config
+
+	// stateLock guards the client, the long-term secret and the storage,
+	// which might be replaced while operations are running
+	stateLock      sync.RWMutex
+	clientInstance Client
+	longtermSecret *sensitive.Bytes
+	store          *storage.Store
+
+	credentials *credentialRegistry
+
+	// poolLock guards the credential pool, which is started and stopped independently of the operations
+	poolLock sync.Mutex
+	pool     *pool
+	// poolRuns tracks the goroutines of the pools, including the stopped ones that did not exit yet
+	poolRuns sync.WaitGroup
+
+	events chan Event
+}
+
+// New creates new instance of the wallet using the provided client configuration.
+// The passphrase is only used if the account key is kept in an encrypted keystore file.
+func New(cfg *config.Config, keyPassphrase string) (*Wallet, error) {
+	encrypted, err := keystore.IsEncrypted(cfg.Nym.AccountKeysFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the account key: %v", err)
+	}
+	if !encrypted {
+		clientInstance, err := client.New(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return NewWithClient(cfg, clientInstance), nil
+	}
+
+	privateKey, err := keystore.Load(cfg.Nym.AccountKeysFile, keyPassphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer sensitive.WipeKey(privateKey)
+
+	// the client is only capable of loading the key from a plaintext file, which is why it is given a temporary one,
+	// next to the encrypted key, existing only while the client is created
+	clientCfg := *cfg
+	nymCfg := *cfg.Nym
+	clientCfg.Nym = &nymCfg
+
+	var clientInstance *client.Client
+	err = keystore.WithPlaintextKey(filepath.Dir(cfg.Nym.AccountKeysFile), privateKey, func(path string) error {
+		nymCfg.AccountKeysFile = path
+		var err error
+		clientInstance, err = client.New(&clientCfg)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewWithClient(cfg, clientInstance), nil
+}
+
+// NewWithClient creates new instance of the wallet using the provided client implementation,
+// for example the in-process fake from the 'fake' package.
+func NewWithClient(cfg *config.Config, clientInstance Client) *Wallet {
+	return &Wallet{
+		cfg:            cfg,
+		clientInstance: clientInstance,
+		credentials:    newCredentialRegistry(),
+		events:         make(chan Event, eventsBufferSize),
+	}
+}
+
+// Events returns channel on which the wallet publishes all changes of its state.
+// The channel must be continuously drained by the caller as otherwise the wallet operations will block.
+func (w *Wallet) Events() <-chan Event {
+	return w.events
+}
+
+func (w *Wallet) publish(ev Event) {
+	w.events <- ev
+}
+
+// Wipe forgets the long-term secret and all the credentials, closes the storage, which overwrites its key,
+// as soon as the stopped credential pool exits, and releases the client holding the account key. Operations still in progress fail with ErrWalletWiped
+// and the wallet must not be used afterwards; a new one has to be created to use the account again.
+// Note that the client keeps its own copy of the account key, which can't be overwritten from the outside,
+// so it only disappears from the memory once the released client gets garbage collected.
+func (w *Wallet) Wipe() {
+	w.StopPool()
+
+	w.stateLock.Lock()
+	w.clientInstance = wipedClient{}
+	store := w.store
+	w.store = nil
+	w.longtermSecret.Wipe()
+	w.longtermSecret = nil
+	w.stateLock.Unlock()
+
+	w.credentials.clear()
+	// a stopped pool might still be obtaining credentials, which are saved before the storage gets closed
+	// and then forgotten again, so that the Nyms spent on them are not lost
+	w.afterPoolsExited(func() {
+		w.credentials.clear()
+		if store != nil {
+			store.Close()
+		}
+	})
+}
+
+// Close stops the credential pool and closes the events channel, once the pool no longer publishes to it.
+// The wallet must not be used afterwards.
+func (w *Wallet) Close() {
+	w.StopPool()
+	w.afterPoolsExited(func() { close(w.events) })
+}
+
+// client returns the client used by the wallet, which is replaced with one failing all the calls once the wallet is wiped.
+func (w *Wallet) client() Client {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+	return w.clientInstance
+}
+
+// secret returns a fresh copy of the long-term secret, which is only held in its wipeable form by the wallet.
+func (w *Wallet) secret() *Curve.BIG {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+	if w.longtermSecret == nil {
+		return nil
+	}
+	return Curve.FromBytes(w.longtermSecret.Data())
+}
+
+func (w *Wallet) storage() *storage.Store {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+	return w.store
+}
+
+// Config returns the client configuration used by the wallet.
+func (w *Wallet) Config() *config.Config {
+	return w.cfg
+}
+
+// OpenStore opens the existing wallet file associated with the account and restores
+// all the credentials it contains, as well as the long-term secret, if it was set.
+// It fails with ErrStoreNotExist if the wallet was not created yet.
+func (w *Wallet) OpenStore(passphrase string) error {
+	store, err := storage.Open(w.storePath(), []byte(passphrase))
+	if err != nil {
+		if err == storage.ErrNotExist {
+			return ErrStoreNotExist
+		}
+		return err
+	}
+
+	for _, rec := range store.Credentials() {
+		issuedCredential, err := issuedCredentialFromRecord(rec)
+		if err != nil {
+			w.publish(ErrorEvent{fmt.Errorf("could not restore credential %v: %v", rec.ID, err)})
+			continue
+		}
+
+		if w.credentials.add(rec.ID, *issuedCredential) {
+			w.publish(CredentialAddedEvent{issuedCredential.info(rec.ID)})
+		}
+	}
+
+	var secret *sensitive.Bytes
+	if secretBytes := store.Secret(); secretBytes != nil {
+		secret = sensitive.NewBytes(secretBytes)
+		sensitive.Zero(secretBytes)
+	}
+
+	w.stateLock.Lock()
+	w.store = store
+	w.longtermSecret = secret
+	w.stateLock.Unlock()
+
+	if secret != nil {
+		w.publish(SecretChangedEvent{w.DisplaySecret()})
+	}
+	return nil
+}
+
+// CreateStore creates an empty wallet file for the account, encrypted with the passphrase, and opens it.
+// It refuses to replace an existing wallet. The passphrase can't be recovered, so the callers should make sure
+// it was not mistyped, for example by asking for it twice.
+func (w *Wallet) CreateStore(passphrase string) error {
+	if passphrase == "" {
+		return ErrEmptyPassphrase
+	}
+	store, err := storage.Create(w.storePath(), []byte(passphrase), storage.Snapshot{})
+	if err != nil {
+		return err
+	}
+
+	w.stateLock.Lock()
+	w.store = store
+	w.stateLock.Unlock()
+	return nil
+}
+
+// StoreExists checks whether the wallet file associated with the account key file was already created.
+func StoreExists(keyFile string) (bool, error) {
+	if _, err := os.Lstat(keyFile + WalletFileSuffix); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (w *Wallet) storePath() string {
+	return w.cfg.Nym.AccountKeysFile + WalletFileSuffix
+}
+
+// KeyEncrypted indicates whether the account key is kept in an encrypted keystore file.
+func (w *Wallet) KeyEncrypted() (bool, error) {
+	return keystore.IsEncrypted(w.cfg.Nym.AccountKeysFile)
+}
+
+// EncryptKey migrates the plaintext account key into a keystore file encrypted with the passphrase of the wallet,
+// so that a single passphrase would unlock the entire account.
+func (w *Wallet) EncryptKey(passphrase string) error {
+	store := w.storage()
+	if store == nil {
+		return ErrWalletNotOpened
+	}
+	if !store.VerifyPassphrase([]byte(passphrase)) {
+		return storage.ErrInvalidPassphrase
+	}
+
+	if err := keystore.Encrypt(w.cfg.Nym.AccountKeysFile, passphrase); err != nil {
+		return fmt.Errorf("could not encrypt the account key: %v", err)
+	}
+	return nil
+}
+
+// ChangePassphrase changes the passphrase protecting both the wallet and the account key.
+// A plaintext account key gets encrypted in the process.
+func (w *Wallet) ChangePassphrase(oldPassphrase, newPassphrase string) error {
+	store := w.storage()
+	if store == nil {
+		return ErrWalletNotOpened
+	}
+	if !store.VerifyPassphrase([]byte(oldPassphrase)) {
+		return storage.ErrInvalidPassphrase
+	}
+	if newPassphrase == "" {
+		return ErrEmptyPassphrase
+	}
+
+	keyFile := w.cfg.Nym.AccountKeysFile
+	if err := keystore.ChangePassphrase(keyFile, oldPassphrase, newPassphrase); err != nil {
+		return fmt.Errorf("could not re-encrypt the account key: %v", err)
+	}
+
+	if err := store.ChangePassphrase([]byte(oldPassphrase), []byte(newPassphrase)); err != nil {
+		// keep the key and the wallet protected by the same passphrase
+		if rollbackErr := keystore.ChangePassphrase(keyFile, newPassphrase, oldPassphrase); rollbackErr != nil {
+			return fmt.Errorf("could not re-encrypt the wallet (%v) and the account key is now protected by the new passphrase: %v", err, rollbackErr)
+		}
+		return fmt.Errorf("could not re-encrypt the wallet: %v", err)
+	}
+	return nil
+}
+
+// Snapshot returns the entire content of the wallet, so that it could be backed up.
+// The passphrase must be the one protecting the wallet.
+func (w *Wallet) Snapshot(passphrase string) (storage.Snapshot, error) {
+	store := w.storage()
+	if store == nil {
+		return storage.Snapshot{}, ErrWalletNotOpened
+	}
+	if !store.VerifyPassphrase([]byte(passphrase)) {
+		return storage.Snapshot{}, storage.ErrInvalidPassphrase
+	}
+	return store.Snapshot(), nil
+}
+
+// IsOpen indicates whether the wallet storage was opened.
+func (w *Wallet) IsOpen() bool {
+	return w.storage() != nil
+}
+
+// HasSecret indicates whether the long-term secret is loaded.
+func (w *Wallet) HasSecret() bool {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+	return w.longtermSecret != nil
+}
+
+func (w *Wallet) setLongtermSecret(secret *Curve.BIG) error {
+	store := w.storage()
+	if store == nil {
+		return ErrWalletNotOpened
+	}
+
+	secretBytes := bigToBytes(secret)
+	defer sensitive.Zero(secretBytes)
+
+	// the storage refuses to overwrite the secret, so concurrent calls can't both succeed
+	if err := store.SetSecret(secretBytes); err != nil {
+		return fmt.Errorf("could not save the long-term secret: %v", err)
+	}
+
+	w.stateLock.Lock()
+	w.longtermSecret = sensitive.NewBytes(secretBytes)
+	w.stateLock.Unlock()
+
+	w.publish(SecretChangedEvent{utils.ToCoconutString(secret)})
+	return nil
+}
+
+// GenerateSecret generates fresh long-term secret and persists it in the wallet.
+func (w *Wallet) GenerateSecret() error {
+	return w.setLongtermSecret(w.client().RandomBIG())
+}
+
+// ImportSecret sets the long-term secret of the wallet to the value in the format produced by ExportSecret.
+func (w *Wallet) ImportSecret(hexSecret string) error {
+	secret, err := parseSecret(hexSecret)
+	if err != nil {
+		return fmt.Errorf("could not import the long-term secret: %v", err)
+	}
+
+	return w.setLongtermSecret(secret)
+}
+
+// ImportMnemonic sets the long-term secret of the wallet to the one derived from the seed phrase.
+// The phrase must be the one from which the account key was derived.
+func (w *Wallet) ImportMnemonic(phrase string) error {
+	seed, err := mnemonic.ToSeed(phrase)
+	if err != nil {
+		return err
+	}
+	defer seed.Wipe()
+	key, err := seed.AccountKey()
+	if err != nil {
+		return err
+	}
+	defer sensitive.WipeKey(key)
+	address, err := keystore.Address(w.cfg.Nym.AccountKeysFile)
+	if err != nil {
+		return fmt.Errorf("could not load the account key: %v", err)
+	}
+	if ethcrypto.PubkeyToAddress(key.PublicKey) != address {
+		return errors.New("the seed phrase does not belong to this account")
+	}
+
+	material := seed.SecretMaterial()
+	defer sensitive.Zero(material)
+	return w.setLongtermSecret(secretFromMaterial(material))
+}
+
+// ExportSecret returns hex representation of the long-term secret.
+func (w *Wallet) ExportSecret() (string, error) {
+	secret := w.secret()
+	if secret == nil {
+		return "", errors.New("no long-term secret is loaded")
+	}
+
+	return hex.EncodeToString(bigToBytes(secret)), nil
+}
+
+// DisplaySecret returns the display representation of the long-term secret, as published in SecretChangedEvent,
+// or an empty string if no secret is loaded.
+func (w *Wallet) DisplaySecret() string {
+	secret := w.secret()
+	if secret == nil {
+		return ""
+	}
+	return utils.ToCoconutString(secret)
+}
+
+// AllowedValues returns all the values for which credentials can be obtained.
+func (w *Wallet) AllowedValues() []int64 {
+	values := make([]int64, len(token.AllowedValues))
+	copy(values, token.AllowedValues)
+	return values
+}
+
+// ServiceProviders returns physical addresses of all known service providers.
+func (w *Wallet) ServiceProviders() []string {
+	spAddresses := make([]string, 0, len(w.cfg.Nym.ServiceProviders))
+	for sp := range w.cfg.Nym.ServiceProviders {
+		spAddresses = append(spAddresses, sp)
+	}
+	return spAddresses
+}
+
+// UpdateBalances queries for all the balances of the account and publishes them.
+// Failure of any of the queries does not prevent the remaining ones from being made,
+// in which case the returned error is of type *BalanceError.
+func (w *Wallet) UpdateBalances() (*Balances, error) {
+	var balances Balances
+	var balanceErr BalanceError
+	var err error
+
+	if balances.ERC20, err = w.client().GetCurrentERC20Balance(); err != nil {
+		balanceErr.ERC20 = err
+	} else {
+		w.publish(BalanceChangedEvent{ERC20Balance, balances.ERC20})
+	}
+
+	if balances.ERC20Pending, err = w.client().GetCurrentERC20PendingBalance(); err != nil {
+		balanceErr.ERC20Pending = err
+	} else {
+		w.publish(BalanceChangedEvent{ERC20PendingBalance, balances.ERC20Pending})
+	}
+
+	if balances.Nym, err = w.client().GetCurrentNymBalance(); err != nil {
+		balanceErr.Nym = err
+	} else {
+		w.publish(BalanceChangedEvent{NymBalance, balances.Nym})
+	}
+
+	if balanceErr.ERC20 != nil || balanceErr.ERC20Pending != nil || balanceErr.Nym != nil {
+		return &balances, &balanceErr
+	}
+	return &balances, nil
+}
+
+func (w *Wallet) waitForERC20BalanceChange(ctx context.Context, expectedBalance uint64) error {
+	retryTicker := time.NewTicker(balancePollingRate)
+	defer retryTicker.Stop()
+
+	for {
+		select {
+		case <-retryTicker.C:
+			currentBalance, err := w.client().GetCurrentERC20Balance()
+			if err != nil {
+				w.publish(ErrorEvent{fmt.Errorf("failed to query for ERC20 Nym Balance: %v", err)})
+			} else {
+				w.publish(BalanceChangedEvent{ERC20Balance, currentBalance})
+			}
+
+			pendingBalance, err := w.client().GetCurrentERC20PendingBalance()
+			if err != nil {
+				w.publish(ErrorEvent{fmt.Errorf("failed to query for ERC20 Nym Balance (pending): %v", err)})
+			} else {
+				w.publish(BalanceChangedEvent{ERC20PendingBalance, pendingBalance})
+			}
+
+			if currentBalance == expectedBalance {
+				return nil
+			}
+		case <-ctx.Done():
+			return fmt.Errorf("failed to wait for the ERC20 balance change: %v", ctx.Err())
+		}
+	}
+}
+
+func (w *Wallet) currentBalances() (uint64, uint64, error) {
+	currentERC20Balance, err := w.client().GetCurrentERC20Balance()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to query for ERC20 Nym Balance: %v", err)
+	}
+
+	currentNymBalance, err := w.client().GetCurrentNymBalance()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to query for Nym Token Balance: %v", err)
+	}
+	return currentERC20Balance, currentNymBalance, nil
+}
+
+// SendToPipeAccount transfers the specified amount of ERC20 Nym to the pipe account
+// and waits until it is reflected in the Nym token balance.
+func (w *Wallet) SendToPipeAccount(ctx context.Context, amount int64) (err error) {
+	entry := &LedgerEntry{Type: PipeTransfer, Amount: amount}
+	defer func() { w.recordOperation(entry, err) }()
+
+	currentERC20Balance, currentNymBalance, err := w.currentBalances()
+	if err != nil {
+		return err
+	}
+
+	if err := w.client().SendToPipeAccount(ctx, amount); err != nil {
+		return fmt.Errorf("failed to send %v to the pipe account: %v", amount, err)
+	}
+	jobs.ReportStage(ctx, "waiting for Ethereum")
+
+	// TODO: not the best option if multiple actions were taken concurrently, in future wait until block X is commited
+	if err := w.waitForERC20BalanceChange(ctx, currentERC20Balance-uint64(amount)); err != nil {
+		return err
+	}
+
+	jobs.ReportStage(ctx, "waiting for Nym blockchain")
+	if err := w.client().WaitForBalanceChange(ctx, currentNymBalance+uint64(amount)); err != nil {
+		return fmt.Errorf("failed to query for Nym Token Balance: %v", err)
+	}
+	entry.TendermintResult = "Nym balance credited"
+
+	w.publish(BalanceChangedEvent{NymBalance, currentNymBalance + uint64(amount)})
+	return nil
+}
+
+// RedeemTokens redeems the specified amount of Nym tokens back into ERC20 Nym
+// and waits until it is reflected in the ERC20 balance.
+func (w *Wallet) RedeemTokens(ctx context.Context, amount int64) (err error) {
+	entry := &LedgerEntry{Type: Redemption, Amount: amount}
+	defer func() { w.recordOperation(entry, err) }()
+
+	currentERC20Balance, currentNymBalance, err := w.currentBalances()
+	if err != nil {
+		return err
+	}
+
+	if err := w.client().RedeemTokens(ctx, uint64(amount)); err != nil {
+		return fmt.Errorf("failed to redeem %v tokens: %v", amount, err)
+	}
+	jobs.ReportStage(ctx, "waiting for Nym blockchain")
+
+	if err := w.client().WaitForBalanceChange(ctx, currentNymBalance-uint64(amount)); err != nil {
+		return fmt.Errorf("failed to query for Nym Token Balance: %v", err)
+	}
+	entry.TendermintResult = "Nym balance debited"
+
+	w.publish(BalanceChangedEvent{NymBalance, currentNymBalance - uint64(amount)})
+	jobs.ReportStage(ctx, "waiting for Ethereum")
+	return w.waitForERC20BalanceChange(ctx, currentERC20Balance+uint64(amount))
+}
+
+// AccountExists checks whether the account exists on the Nym blockchain.
+func (w *Wallet) AccountExists() (bool, error) {
+	exists, err := w.client().CheckAccountExistence()
+	if err != nil {
+		return false, fmt.Errorf("could not check for account existence: %v", err)
+	}
+	w.publish(AccountStatusEvent{exists})
+	return exists, nil
+}
+
+// RegisterAccount registers the account on the Nym blockchain.
+func (w *Wallet) RegisterAccount() (err error) {
+	entry := &LedgerEntry{Type: Registration}
+	defer func() { w.recordOperation(entry, err) }()
+
+	// fake non-existent credential
+	accountCred := []byte("foo")
+	if err := w.client().RegisterAccount(accountCred); err != nil {
+		return fmt.Errorf("could not register Nym account: %v", err)
+	}
+	entry.TendermintResult = "account created"
+
+	w.publish(AccountStatusEvent{true})
+	return nil
+}
+
+// GetFaucetNym requests the specified amount of ERC20 Nym (and some Ether for transaction fees)
+// from the faucet and waits for both transactions to resolve.
+func (w *Wallet) GetFaucetNym(ctx context.Context, nyms int64) (err error) {
+	entry := &LedgerEntry{Type: FaucetRequest, Amount: nyms}
+	defer func() { w.recordOperation(entry, err) }()
+
+	erc20Hash, etherHash, err := w.client().MakeFaucetRequest(ctx, nyms)
+	if err != nil {
+		return fmt.Errorf("could not send request to the faucet: %v", err)
+	}
+	entry.EthereumTxs = []string{erc20Hash.Hex(), etherHash.Hex()}
+
+	jobs.ReportStage(ctx, "waiting for ERC20 Nym transfer")
+	successERC20, err := w.client().WaitForEthereumTxToResolve(ctx, erc20Hash)
+	if err != nil {
+		return fmt.Errorf("could not receive ERC20 Nym: %v", err)
+	}
+
+	jobs.ReportStage(ctx, "waiting for Ether transfer")
+	successEther, err := w.client().WaitForEthereumTxToResolve(ctx, etherHash)
+	if err != nil {
+		return fmt.Errorf("could not receive Ether: %v", err)
+	}
+
+	if !successERC20 || !successEther {
+		return errors.New("unknown error when trying to receive funds from the faucet")
+	}
+	return nil
+}
@@ -0,0 +1,636 @@
+// wallet_test.go - tests of the wallet operations against the fake client
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package wallet_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nymtech/nym-validator/client/config"
+	"github.com/nymtech/qt-validator-client-demo/internal/storage"
+	"github.com/nymtech/qt-validator-client-demo/internal/wallet"
+	"github.com/nymtech/qt-validator-client-demo/internal/wallet/fake"
+)
+
+const (
+	testPassphrase = "correct horse battery staple"
+	testSP         = fake.ServiceProvider
+	testTimeout    = 30 * time.Second
+)
+
+// testWallet is a wallet backed by the fake client, with its events being drained in the background.
+type testWallet struct {
+	*wallet.Wallet
+	client *fake.Client
+	dir    string
+}
+
+func loadTestConfig(t *testing.T, dir string) *config.Config {
+	cfgFile, err := fake.WriteConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadFile(cfgFile)
+	if err != nil {
+		t.Fatalf("could not load the test config: %v", err)
+	}
+	return cfg
+}
+
+func startWallet(cfg *config.Config, client *fake.Client) *wallet.Wallet {
+	w := wallet.NewWithClient(cfg, client)
+	go func() {
+		for range w.Events() {
+		}
+	}()
+	return w
+}
+
+// newTestWallet creates the wallet with a fresh store and long-term secret. The fake account exists
+// and holds the given balances.
+func newTestWallet(t *testing.T, erc20, nym uint64) *testWallet {
+	dir, err := ioutil.TempDir("", "nym-wallet-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := fake.NewClient(erc20)
+	client.SetBalances(erc20, 0, nym)
+	client.SetAccountExists(true)
+
+	w := startWallet(loadTestConfig(t, dir), client)
+	if err := w.CreateStore(testPassphrase); err != nil {
+		t.Fatalf("could not create the wallet: %v", err)
+	}
+	if err := w.GenerateSecret(); err != nil {
+		t.Fatalf("could not generate the long-term secret: %v", err)
+	}
+	return &testWallet{Wallet: w, client: client, dir: dir}
+}
+
+func (tw *testWallet) close() {
+	tw.Wipe()
+	tw.Close()
+	os.RemoveAll(tw.dir)
+}
+
+func (tw *testWallet) smallestValue() int64 {
+	values := tw.AllowedValues()
+	smallest := values[0]
+	for _, v := range values {
+		if v < smallest {
+			smallest = v
+		}
+	}
+	return smallest
+}
+
+func testContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), testTimeout)
+}
+
+func expectCategory(t *testing.T, err error, category wallet.ErrorCategory) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("expected an error of category '%v', got none", category)
+	}
+	if got := wallet.ClassifyError(err); got != category {
+		t.Fatalf("expected an error of category '%v', got '%v': %v", category, got, err)
+	}
+}
+
+func expectBalances(t *testing.T, w *testWallet, erc20, nym uint64) {
+	t.Helper()
+	balances, err := w.UpdateBalances()
+	if err != nil {
+		t.Fatalf("could not query the balances: %v", err)
+	}
+	if balances.ERC20 != erc20 || balances.Nym != nym {
+		t.Fatalf("expected %v ERC20 and %v Nym, got %v ERC20 and %v Nym", erc20, nym, balances.ERC20, balances.Nym)
+	}
+}
+
+func lastLedgerEntry(t *testing.T, w *testWallet) wallet.LedgerEntry {
+	t.Helper()
+	entries, err := w.Ledger(wallet.LedgerFilter{})
+	if err != nil {
+		t.Fatalf("could not read the ledger: %v", err)
+	}
+	if len(entries) == 0 {
+		t.Fatal("the ledger is empty")
+	}
+	return entries[len(entries)-1]
+}
+
+func TestUpdateBalances(t *testing.T) {
+	w := newTestWallet(t, 100, 20)
+	defer w.close()
+
+	w.client.SetBalances(100, 5, 20)
+	balances, err := w.UpdateBalances()
+	if err != nil {
+		t.Fatalf("could not query the balances: %v", err)
+	}
+	if *balances != (wallet.Balances{ERC20: 100, ERC20Pending: 5, Nym: 20}) {
+		t.Fatalf("unexpected balances %+v", *balances)
+	}
+}
+
+func TestUpdateBalancesAccountMissing(t *testing.T) {
+	w := newTestWallet(t, 100, 0)
+	defer w.close()
+
+	w.client.SetAccountExists(false)
+	balances, err := w.UpdateBalances()
+	balanceErr, ok := err.(*wallet.BalanceError)
+	if !ok {
+		t.Fatalf("expected a *BalanceError, got %v", err)
+	}
+	if balanceErr.ERC20 != nil || balanceErr.ERC20Pending != nil {
+		t.Fatalf("the ERC20 balances should have been obtained: %v", err)
+	}
+	expectCategory(t, balanceErr.Nym, wallet.AccountMissing)
+	if balances.ERC20 != 100 {
+		t.Fatalf("expected 100 ERC20, got %v", balances.ERC20)
+	}
+}
+
+func TestSendToPipeAccount(t *testing.T) {
+	w := newTestWallet(t, 100, 0)
+	defer w.close()
+
+	ctx, cancel := testContext()
+	defer cancel()
+	if err := w.SendToPipeAccount(ctx, 30); err != nil {
+		t.Fatalf("could not send to the pipe account: %v", err)
+	}
+	expectBalances(t, w, 70, 30)
+
+	entry := lastLedgerEntry(t, w)
+	if entry.Type != wallet.PipeTransfer || !entry.Success || entry.Amount != 30 {
+		t.Fatalf("unexpected ledger entry %+v", entry)
+	}
+}
+
+func TestSendToPipeAccountInsufficientBalance(t *testing.T) {
+	w := newTestWallet(t, 10, 0)
+	defer w.close()
+
+	ctx, cancel := testContext()
+	defer cancel()
+	err := w.SendToPipeAccount(ctx, 30)
+	expectCategory(t, err, wallet.InsufficientBalance)
+	expectBalances(t, w, 10, 0)
+
+	entry := lastLedgerEntry(t, w)
+	if entry.Success || entry.ErrorCategory != wallet.InsufficientBalance {
+		t.Fatalf("the failure was not recorded in the ledger: %+v", entry)
+	}
+}
+
+func TestRedeemTokens(t *testing.T) {
+	w := newTestWallet(t, 0, 30)
+	defer w.close()
+
+	ctx, cancel := testContext()
+	defer cancel()
+	if err := w.RedeemTokens(ctx, 10); err != nil {
+		t.Fatalf("could not redeem the tokens: %v", err)
+	}
+	expectBalances(t, w, 10, 20)
+}
+
+func TestRedeemTokensInsufficientBalance(t *testing.T) {
+	w := newTestWallet(t, 0, 5)
+	defer w.close()
+
+	ctx, cancel := testContext()
+	defer cancel()
+	expectCategory(t, w.RedeemTokens(ctx, 10), wallet.InsufficientBalance)
+	expectBalances(t, w, 0, 5)
+}
+
+func TestRegisterAccount(t *testing.T) {
+	w := newTestWallet(t, 0, 0)
+	defer w.close()
+
+	w.client.SetAccountExists(false)
+	if exists, err := w.AccountExists(); err != nil || exists {
+		t.Fatalf("expected the account not to exist, got %v (%v)", exists, err)
+	}
+	if err := w.RegisterAccount(); err != nil {
+		t.Fatalf("could not register the account: %v", err)
+	}
+	if exists, err := w.AccountExists(); err != nil || !exists {
+		t.Fatalf("expected the account to exist, got %v (%v)", exists, err)
+	}
+}
+
+func TestGetFaucetNym(t *testing.T) {
+	w := newTestWallet(t, 0, 0)
+	defer w.close()
+
+	ctx, cancel := testContext()
+	defer cancel()
+	if err := w.GetFaucetNym(ctx, 50); err != nil {
+		t.Fatalf("could not get Nyms from the faucet: %v", err)
+	}
+	expectBalances(t, w, 50, 0)
+
+	w.client.SetError(fake.MakeFaucetRequest, errors.New("dial tcp 127.0.0.1:9000: connect: connection refused"))
+	expectCategory(t, w.GetFaucetNym(ctx, 50), wallet.NetworkUnreachable)
+	expectBalances(t, w, 50, 0)
+}
+
+func TestGetCredential(t *testing.T) {
+	w := newTestWallet(t, 0, 100)
+	defer w.close()
+
+	ctx, cancel := testContext()
+	defer cancel()
+	value := w.smallestValue()
+	cred, err := w.GetCredential(ctx, value)
+	if err != nil {
+		t.Fatalf("could not obtain the credential: %v", err)
+	}
+	if cred.Value != value || cred.State != wallet.Unspent {
+		t.Fatalf("unexpected credential %+v", cred)
+	}
+	expectBalances(t, w, 0, 100-uint64(value))
+
+	creds := w.Credentials()
+	if len(creds) != 1 || creds[0].ID != cred.ID {
+		t.Fatalf("the credential is not held by the wallet: %+v", creds)
+	}
+}
+
+func TestGetCredentialInsufficientBalance(t *testing.T) {
+	w := newTestWallet(t, 0, 0)
+	defer w.close()
+
+	ctx, cancel := testContext()
+	defer cancel()
+	_, err := w.GetCredential(ctx, w.smallestValue())
+	expectCategory(t, err, wallet.InsufficientBalance)
+	if creds := w.Credentials(); len(creds) != 0 {
+		t.Fatalf("no credential should have been added, got %+v", creds)
+	}
+}
+
+func TestGetCredentialAccountMissing(t *testing.T) {
+	w := newTestWallet(t, 0, 100)
+	defer w.close()
+
+	w.client.SetAccountExists(false)
+	ctx, cancel := testContext()
+	defer cancel()
+	_, err := w.GetCredential(ctx, w.smallestValue())
+	expectCategory(t, err, wallet.AccountMissing)
+}
+
+func TestGetCredentialWithoutSecret(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nym-wallet-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	client := fake.NewClient(0)
+	client.SetBalances(0, 0, 100)
+	client.SetAccountExists(true)
+	w := startWallet(loadTestConfig(t, dir), client)
+	defer w.Close()
+
+	ctx, cancel := testContext()
+	defer cancel()
+	if _, err := w.GetCredential(ctx, 1); err != wallet.ErrWalletNotOpened {
+		t.Fatalf("expected ErrWalletNotOpened, got %v", err)
+	}
+	if err := w.CreateStore(testPassphrase); err != nil {
+		t.Fatalf("could not create the wallet: %v", err)
+	}
+	if _, err := w.GetCredential(ctx, 1); err != wallet.ErrNoSecret {
+		t.Fatalf("expected ErrNoSecret, got %v", err)
+	}
+}
+
+func TestSpendCredential(t *testing.T) {
+	w := newTestWallet(t, 0, 100)
+	defer w.close()
+
+	ctx, cancel := testContext()
+	defer cancel()
+	cred, err := w.GetCredential(ctx, w.smallestValue())
+	if err != nil {
+		t.Fatalf("could not obtain the credential: %v", err)
+	}
+
+	res, err := w.SpendCredential(ctx, testSP, cred.ID, false)
+	if err != nil {
+		t.Fatalf("could not spend the credential: %v", err)
+	}
+	if !res.Accepted || res.Value != cred.Value || res.ServiceProvider != testSP {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if creds := w.Credentials(); creds[0].State != wallet.Spent {
+		t.Fatalf("the credential should be spent, got %v", creds[0].State)
+	}
+
+	// the known double spend is refused without contacting the service provider
+	if _, err := w.SpendCredential(ctx, testSP, cred.ID, false); err != wallet.ErrCredentialSpent {
+		t.Fatalf("expected ErrCredentialSpent, got %v", err)
+	}
+
+	// unless forced, in which case the service provider rejects it
+	res, err = w.SpendCredential(ctx, testSP, cred.ID, true)
+	if err != nil {
+		t.Fatalf("the forced double spend failed: %v", err)
+	}
+	if res.Accepted {
+		t.Fatal("the double spent credential was accepted")
+	}
+	if creds := w.Credentials(); creds[0].State != wallet.Spent {
+		t.Fatalf("the credential should remain spent, got %v", creds[0].State)
+	}
+}
+
+func TestSpendCredentialFailure(t *testing.T) {
+	w := newTestWallet(t, 0, 100)
+	defer w.close()
+
+	ctx, cancel := testContext()
+	defer cancel()
+	cred, err := w.GetCredential(ctx, w.smallestValue())
+	if err != nil {
+		t.Fatalf("could not obtain the credential: %v", err)
+	}
+
+	if _, err := w.SpendCredential(ctx, "127.0.0.1:1", cred.ID, false); err == nil {
+		t.Fatal("spending at an unknown service provider should fail")
+	}
+	if _, err := w.SpendCredential(ctx, testSP, "42", false); err == nil {
+		t.Fatal("spending an unknown credential should fail")
+	}
+
+	// a credential that could not be sent remains spendable
+	w.client.SetError(fake.SpendCredential, errors.New("dial tcp 127.0.0.1:4100: connect: connection refused"))
+	_, err = w.SpendCredential(ctx, testSP, cred.ID, false)
+	expectCategory(t, err, wallet.NetworkUnreachable)
+	if creds := w.Credentials(); creds[0].State != wallet.Unspent {
+		t.Fatalf("the credential should remain unspent, got %v", creds[0].State)
+	}
+
+	// while the one rejected as double spent is reconciled with the service provider
+	w.client.SetError(fake.SpendCredential, errors.New("the credential was already spent"))
+	_, err = w.SpendCredential(ctx, testSP, cred.ID, false)
+	expectCategory(t, err, wallet.DoubleSpend)
+	if creds := w.Credentials(); creds[0].State != wallet.Spent {
+		t.Fatalf("the credential should be spent, got %v", creds[0].State)
+	}
+}
+
+func TestSpendCredentialRejected(t *testing.T) {
+	w := newTestWallet(t, 0, 100)
+	defer w.close()
+
+	ctx, cancel := testContext()
+	defer cancel()
+	cred, err := w.GetCredential(ctx, w.smallestValue())
+	if err != nil {
+		t.Fatalf("could not obtain the credential: %v", err)
+	}
+
+	// the credential gets spent from a copy of the wallet, which the original one does not know about
+	copyDir, err := ioutil.TempDir("", "nym-wallet-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(copyDir)
+	copyCfg := loadTestConfig(t, copyDir)
+	raw, err := ioutil.ReadFile(w.Config().Nym.AccountKeysFile + wallet.WalletFileSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(copyCfg.Nym.AccountKeysFile+wallet.WalletFileSuffix, raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+	copied := startWallet(copyCfg, w.client)
+	defer copied.Close()
+	if err := copied.OpenStore(testPassphrase); err != nil {
+		t.Fatalf("could not open the copy of the wallet: %v", err)
+	}
+	defer copied.Wipe()
+	if res, err := copied.SpendCredential(ctx, testSP, cred.ID, false); err != nil || !res.Accepted {
+		t.Fatalf("could not spend the credential from the copy: %v", err)
+	}
+
+	// the rejection is not an error, but the credential is no longer considered spendable
+	if creds := w.Credentials(); creds[0].State != wallet.Unspent {
+		t.Fatalf("the credential should be unspent before the rejection, got %v", creds[0].State)
+	}
+	res, err := w.SpendCredential(ctx, testSP, cred.ID, false)
+	if err != nil {
+		t.Fatalf("the rejected spend failed: %v", err)
+	}
+	if res.Accepted {
+		t.Fatal("the credential spent from the copy was accepted")
+	}
+	if creds := w.Credentials(); creds[0].State != wallet.Spent {
+		t.Fatalf("the rejected credential should be spent, got %v", creds[0].State)
+	}
+	if _, err := w.SpendCredential(ctx, testSP, cred.ID, false); err != wallet.ErrCredentialSpent {
+		t.Fatalf("expected ErrCredentialSpent, got %v", err)
+	}
+
+	reopened := startWallet(w.Config(), w.client)
+	defer reopened.Close()
+	if err := reopened.OpenStore(testPassphrase); err != nil {
+		t.Fatalf("could not reopen the wallet: %v", err)
+	}
+	defer reopened.Wipe()
+	if creds := reopened.Credentials(); len(creds) != 1 || creds[0].State != wallet.Spent {
+		t.Fatalf("the rejected credential was not saved as spent: %+v", creds)
+	}
+}
+
+func TestRandomizeCredential(t *testing.T) {
+	w := newTestWallet(t, 0, 100)
+	defer w.close()
+
+	ctx, cancel := testContext()
+	defer cancel()
+	cred, err := w.GetCredential(ctx, w.smallestValue())
+	if err != nil {
+		t.Fatalf("could not obtain the credential: %v", err)
+	}
+
+	randomized, err := w.RandomizeCredential(cred.ID)
+	if err != nil {
+		t.Fatalf("could not randomize the credential: %v", err)
+	}
+	if randomized == cred.Signature {
+		t.Fatal("the credential did not change")
+	}
+	if _, err := w.RandomizeCredential("42"); err == nil {
+		t.Fatal("randomizing an unknown credential should fail")
+	}
+}
+
+func TestGetCredentialBatch(t *testing.T) {
+	w := newTestWallet(t, 0, 100)
+	defer w.close()
+
+	ctx, cancel := testContext()
+	defer cancel()
+	value := w.smallestValue()
+	res, err := w.GetCredentialBatch(ctx, value, 10)
+	if err != nil {
+		t.Fatalf("could not obtain the batch: %v", err)
+	}
+	if len(res.Obtained) != 10 || len(w.Credentials()) != 10 {
+		t.Fatalf("expected 10 credentials, obtained %v", len(res.Obtained))
+	}
+	expectBalances(t, w, 0, 100-10*uint64(value))
+
+	w.client.SetBalances(0, 0, 0)
+	_, err = w.GetCredentialBatch(ctx, value, 1)
+	expectCategory(t, err, wallet.InsufficientBalance)
+}
+
+func TestStore(t *testing.T) {
+	w := newTestWallet(t, 0, 100)
+	defer w.close()
+
+	ctx, cancel := testContext()
+	defer cancel()
+	cred, err := w.GetCredential(ctx, w.smallestValue())
+	if err != nil {
+		t.Fatalf("could not obtain the credential: %v", err)
+	}
+	if _, err := w.SpendCredential(ctx, testSP, cred.ID, false); err != nil {
+		t.Fatalf("could not spend the credential: %v", err)
+	}
+	secret, err := w.ExportSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.CreateStore(testPassphrase); err == nil {
+		t.Fatal("an existing wallet must not be replaced")
+	}
+
+	reopened := startWallet(w.Config(), w.client)
+	defer reopened.Close()
+	if err := reopened.OpenStore("wrong"); err != storage.ErrInvalidPassphrase {
+		t.Fatalf("expected ErrInvalidPassphrase, got %v", err)
+	}
+	if err := reopened.OpenStore(testPassphrase); err != nil {
+		t.Fatalf("could not reopen the wallet: %v", err)
+	}
+	defer reopened.Wipe()
+
+	creds := reopened.Credentials()
+	if len(creds) != 1 || creds[0].ID != cred.ID || creds[0].State != wallet.Spent {
+		t.Fatalf("the credential was not restored: %+v", creds)
+	}
+	if restoredSecret, err := reopened.ExportSecret(); err != nil || restoredSecret != secret {
+		t.Fatalf("the long-term secret was not restored (%v)", err)
+	}
+}
+
+func TestCreateStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nym-wallet-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w := startWallet(loadTestConfig(t, dir), fake.NewClient(0))
+	defer w.Close()
+
+	if err := w.OpenStore(testPassphrase); err != wallet.ErrStoreNotExist {
+		t.Fatalf("expected ErrStoreNotExist, got %v", err)
+	}
+	if err := w.CreateStore(""); err != wallet.ErrEmptyPassphrase {
+		t.Fatalf("expected ErrEmptyPassphrase, got %v", err)
+	}
+	if exists, err := wallet.StoreExists(w.Config().Nym.AccountKeysFile); err != nil || exists {
+		t.Fatalf("no wallet should have been created (%v)", err)
+	}
+	if err := w.CreateStore(testPassphrase); err != nil {
+		t.Fatalf("could not create the wallet: %v", err)
+	}
+	defer w.Wipe()
+	if !w.IsOpen() {
+		t.Fatal("the created wallet is not open")
+	}
+}
+
+func TestWipe(t *testing.T) {
+	w := newTestWallet(t, 100, 100)
+	defer w.close()
+
+	ctx, cancel := testContext()
+	defer cancel()
+	if _, err := w.GetCredential(ctx, w.smallestValue()); err != nil {
+		t.Fatalf("could not obtain the credential: %v", err)
+	}
+
+	w.Wipe()
+	if w.IsOpen() || w.HasSecret() || len(w.Credentials()) != 0 {
+		t.Fatal("the wallet still holds its secrets")
+	}
+	if _, err := w.UpdateBalances(); err == nil {
+		t.Fatal("the wiped wallet should not use the client anymore")
+	}
+	if err := w.SendToPipeAccount(ctx, 10); err == nil || !strings.Contains(err.Error(), wallet.ErrWalletWiped.Error()) {
+		t.Fatalf("expected the wiped wallet to refuse the transfer, got %v", err)
+	}
+}
+
+func TestPool(t *testing.T) {
+	w := newTestWallet(t, 0, 100)
+	defer w.close()
+
+	value := w.smallestValue()
+	cfg := wallet.PoolConfig{
+		Targets: map[int64]wallet.PoolTarget{value: {Target: 5, Threshold: 1}},
+		Budget:  100,
+	}
+	if err := w.StartPool(cfg); err != nil {
+		t.Fatalf("could not start the pool: %v", err)
+	}
+
+	deadline := time.Now().Add(testTimeout)
+	for w.PoolStatus().Unspent[value] < 5 {
+		if time.Now().After(deadline) {
+			t.Fatalf("the pool was not replenished: %+v", w.PoolStatus())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	w.StopPool()
+	if status := w.PoolStatus(); status.Running {
+		t.Fatalf("the pool is still running: %+v", status)
+	}
+	expectBalances(t, w, 0, 100-5*uint64(value))
+}
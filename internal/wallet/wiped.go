@@ -0,0 +1,94 @@
+// wiped.go - placeholder of the client released by a wiped wallet
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package wallet
+
+import (
+	"context"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	Curve "github.com/nymtech/amcl/version3/go/amcl/BLS381"
+	coconut "github.com/nymtech/nym-validator/crypto/coconut/scheme"
+	"github.com/nymtech/nym-validator/crypto/elgamal"
+	"github.com/nymtech/nym-validator/nym/token"
+)
+
+// wipedClient replaces the client of a wiped wallet, so that the operations still in progress
+// fail with ErrWalletWiped rather than keep using the account key.
+type wipedClient struct{}
+
+var _ Client = wipedClient{}
+
+func (wipedClient) RandomBIG() *Curve.BIG {
+	return Curve.NewBIG()
+}
+
+func (wipedClient) GetCredential(token *token.Token) (*coconut.Signature, error) {
+	return nil, ErrWalletWiped
+}
+
+func (wipedClient) SpendCredential(token *token.Token,
+	cred *coconut.Signature,
+	address string,
+	providerAccount ethcommon.Address,
+	egPub *elgamal.PublicKey,
+) (bool, error) {
+	return false, ErrWalletWiped
+}
+
+func (wipedClient) ForceReRandomizeCredential(sig *coconut.Signature) *coconut.Signature {
+	return nil
+}
+
+func (wipedClient) SendToPipeAccount(ctx context.Context, amount int64) error {
+	return ErrWalletWiped
+}
+
+func (wipedClient) RedeemTokens(ctx context.Context, amount uint64) error {
+	return ErrWalletWiped
+}
+
+func (wipedClient) WaitForBalanceChange(ctx context.Context, expectedBalance uint64) error {
+	return ErrWalletWiped
+}
+
+func (wipedClient) GetCurrentERC20Balance() (uint64, error) {
+	return 0, ErrWalletWiped
+}
+
+func (wipedClient) GetCurrentERC20PendingBalance() (uint64, error) {
+	return 0, ErrWalletWiped
+}
+
+func (wipedClient) GetCurrentNymBalance() (uint64, error) {
+	return 0, ErrWalletWiped
+}
+
+func (wipedClient) MakeFaucetRequest(ctx context.Context, amount int64) (ethcommon.Hash, ethcommon.Hash, error) {
+	return ethcommon.Hash{}, ethcommon.Hash{}, ErrWalletWiped
+}
+
+func (wipedClient) WaitForEthereumTxToResolve(ctx context.Context, txHash ethcommon.Hash) (bool, error) {
+	return false, ErrWalletWiped
+}
+
+func (wipedClient) CheckAccountExistence() (bool, error) {
+	return false, ErrWalletWiped
+}
+
+func (wipedClient) RegisterAccount(accountCredential []byte) error {
+	return ErrWalletWiped
+}
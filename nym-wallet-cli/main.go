@@ -0,0 +1,533 @@
+// main.go - entry point for headless nym wallet
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nymtech/nym-validator/client/config"
+	"github.com/nymtech/qt-validator-client-demo/internal/accounts"
+	"github.com/nymtech/qt-validator-client-demo/internal/backup"
+	"github.com/nymtech/qt-validator-client-demo/internal/keystore"
+	"github.com/nymtech/qt-validator-client-demo/internal/wallet"
+)
+
+const (
+	passphraseEnv        = "NYM_WALLET_PASSPHRASE"
+	passphraseConfirmEnv = "NYM_WALLET_PASSPHRASE_CONFIRM"
+
+	// the same amount the gui requests
+	faucetNyms = 50
+)
+
+const usage = `Usage: nym-wallet-cli -f <config> [options] <command> [arguments]
+
+Commands:
+  load-config                     validate the config and print its summary
+  create                          create the wallet of the account, encrypted with the passphrase
+  accounts list                   print all accounts
+  accounts add <name>             create new account with a key derived from a fresh seed phrase
+  register                        register the account on the Nym blockchain
+  faucet                          request ERC20 Nym from the faucet
+  pipe <amount>                   send ERC20 Nym to the pipe account
+  redeem <amount>                 redeem Nym tokens back into ERC20 Nym
+  balances                        print all balances of the account
+  key encrypt                     encrypt the account key with the wallet passphrase
+  key passphrase <new>            change the passphrase protecting the wallet and the account key
+  secret generate                 generate the long-term secret of the wallet
+  secret import <hex>             import the long-term secret of the wallet
+  secret export                   print the long-term secret of the wallet
+  secret mnemonic <words...>      derive the long-term secret from the seed phrase of the account
+  credential list                 print all credentials held in the wallet
+  credential get <value>          obtain a credential of the given value
+  credential amount <amount>      obtain the fewest credentials of the allowed values worth the amount
+  credential batch <value> <n>    obtain n credentials of the given value concurrently
+  credential spend <seq> <sp> [force]
+                                  spend the credential at the given service provider, 'force' spends
+                                  it even if it is known to be spent to demonstrate the double spending
+  credential randomize <seq>      re-randomize the credential
+  pool <budget> <targets...>      obtain the credentials needed to replenish the pool, spending at most
+                                  the budget; targets are in the <value>:<target>:<threshold> format
+  ledger [type]                   print the history of operations, optionally only of the given type
+  backup <file>                   save encrypted backup of the config, the account key and the wallet
+  restore <file>                  restore the backup, saving its config to the path given by -f
+
+Commands operate on the account selected with the -account flag.
+The wallet passphrase is read from the -passphrase flag or the ` + passphraseEnv + ` environment variable.
+When creating the wallet, it has to be repeated with the -passphrase-confirm flag or the ` + passphraseConfirmEnv + `
+environment variable, as the credentials would be lost for good if it was mistyped.
+All results are printed to stdout as JSON. Non-zero exit code indicates a failure.
+
+Options:
+`
+
+// output is the JSON document printed by every command.
+type output struct {
+	OK     bool        `json:"ok"`
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+	// ErrorCategory and Hint are only set if the cause of the error was recognised.
+	ErrorCategory string   `json:"errorCategory,omitempty"`
+	Hint          string   `json:"hint,omitempty"`
+	Warnings      []string `json:"warnings,omitempty"`
+}
+
+type accountSummary struct {
+	Name    string `json:"name"`
+	KeyFile string `json:"keyfile"`
+	Address string `json:"address,omitempty"`
+	// only set for freshly created accounts
+	Mnemonic string `json:"mnemonic,omitempty"`
+}
+
+type configSummary struct {
+	Identifier       string            `json:"identifier"`
+	Address          string            `json:"address"`
+	Keyfile          string            `json:"keyfile"`
+	EthereumNode     string            `json:"ethereumNode"`
+	NymERC20         string            `json:"nymERC20"`
+	PipeAccount      string            `json:"pipeAccount"`
+	IAAddresses      []string          `json:"iaAddresses"`
+	BlockchainNodes  []string          `json:"blockchainNodes"`
+	ServiceProviders map[string]string `json:"serviceProviders"`
+}
+
+type poolSummary struct {
+	// Obtained is nil if the pool did not need replenishing.
+	Obtained *wallet.BatchResult `json:"obtained,omitempty"`
+	Status   wallet.PoolStatus   `json:"status"`
+}
+
+func exit(out output) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		fmt.Fprintf(os.Stderr, "could not encode the output: %v\n", err)
+		os.Exit(1)
+	}
+	if !out.OK {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func summarize(cfg *config.Config) *configSummary {
+	summary := &configSummary{
+		Identifier:       cfg.Client.Identifier,
+		Keyfile:          cfg.Nym.AccountKeysFile,
+		NymERC20:         cfg.Nym.NymContract.Hex(),
+		PipeAccount:      cfg.Nym.PipeAccount.Hex(),
+		IAAddresses:      cfg.Client.IAAddresses,
+		BlockchainNodes:  cfg.Nym.BlockchainNodeAddresses,
+		ServiceProviders: cfg.Nym.ServiceProviders,
+	}
+
+	if address, err := keystore.Address(cfg.Nym.AccountKeysFile); err == nil {
+		summary.Address = address.Hex()
+	}
+	if len(cfg.Nym.EthereumNodeAddresses) > 0 {
+		summary.EthereumNode = cfg.Nym.EthereumNodeAddresses[0]
+	}
+	return summary
+}
+
+func summarizeAccount(acc accounts.Account) accountSummary {
+	summary := accountSummary{
+		Name:    acc.Name,
+		KeyFile: acc.KeyFile,
+	}
+	if address, err := acc.Address(); err == nil {
+		summary.Address = address
+	}
+	return summary
+}
+
+func runAccountsCommand(m *accounts.Manager, args []string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, errors.New("missing accounts subcommand")
+	}
+
+	switch args[0] {
+	case "list":
+		var summaries []accountSummary
+		for _, acc := range m.Accounts() {
+			summaries = append(summaries, summarizeAccount(acc))
+		}
+		return summaries, nil
+	case "add":
+		if err := requireArgs(args[1:], 1); err != nil {
+			return nil, err
+		}
+		acc, phrase, err := m.Add(args[1])
+		if err != nil {
+			return nil, err
+		}
+		summary := summarizeAccount(acc)
+		summary.Mnemonic = phrase
+		return summary, nil
+	}
+	return nil, fmt.Errorf("unknown accounts subcommand '%v'", args[0])
+}
+
+func requireArgs(args []string, n int) error {
+	if len(args) != n {
+		return fmt.Errorf("expected %v argument(s), got %v", n, len(args))
+	}
+	return nil
+}
+
+// parseSpendArgs parses the arguments of 'credential spend <seq> <sp> [force]'.
+func parseSpendArgs(args []string) (seq, sp string, force bool, err error) {
+	if len(args) != 2 && len(args) != 3 {
+		return "", "", false, fmt.Errorf("expected 2 or 3 arguments, got %v", len(args))
+	}
+	if len(args) == 3 {
+		if args[2] != "force" {
+			return "", "", false, fmt.Errorf("unknown spend option '%v'", args[2])
+		}
+		force = true
+	}
+	return args[0], args[1], force, nil
+}
+
+func parseAmount(raw string) (int64, error) {
+	amount, err := strconv.ParseInt(strings.TrimSuffix(raw, "Nym"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not parse the value: %v", err)
+	}
+	if amount <= 0 {
+		return 0, errors.New("the value must be positive")
+	}
+	return amount, nil
+}
+
+func runCredentialCommand(ctx context.Context, w *wallet.Wallet, args []string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, errors.New("missing credential subcommand")
+	}
+
+	switch args[0] {
+	case "list":
+		return w.Credentials(), nil
+	case "get":
+		if err := requireArgs(args[1:], 1); err != nil {
+			return nil, err
+		}
+		value, err := parseAmount(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return w.GetCredential(ctx, value)
+	case "amount":
+		if err := requireArgs(args[1:], 1); err != nil {
+			return nil, err
+		}
+		amount, err := parseAmount(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return w.GetCredentialsForAmount(ctx, amount)
+	case "batch":
+		if err := requireArgs(args[1:], 2); err != nil {
+			return nil, err
+		}
+		value, err := parseAmount(args[1])
+		if err != nil {
+			return nil, err
+		}
+		count, err := strconv.Atoi(args[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid number of credentials '%v': %v", args[2], err)
+		}
+		return w.GetCredentialBatch(ctx, value, count)
+	case "spend":
+		seq, sp, force, err := parseSpendArgs(args[1:])
+		if err != nil {
+			return nil, err
+		}
+		res, err := w.SpendCredential(ctx, sp, seq, force)
+		if err == nil && !res.Accepted {
+			return res, errors.New("the service provider did not accept the credential, it had already been spent")
+		}
+		return res, err
+	case "randomize":
+		if err := requireArgs(args[1:], 1); err != nil {
+			return nil, err
+		}
+		return w.RandomizeCredential(args[1])
+	}
+	return nil, fmt.Errorf("unknown credential subcommand '%v'", args[0])
+}
+
+func runSecretCommand(w *wallet.Wallet, args []string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, errors.New("missing secret subcommand")
+	}
+
+	switch args[0] {
+	case "generate":
+		if err := w.GenerateSecret(); err != nil {
+			return nil, err
+		}
+		return w.ExportSecret()
+	case "import":
+		if err := requireArgs(args[1:], 1); err != nil {
+			return nil, err
+		}
+		return nil, w.ImportSecret(args[1])
+	case "export":
+		return w.ExportSecret()
+	case "mnemonic":
+		if len(args) < 2 {
+			return nil, errors.New("missing seed phrase")
+		}
+		if err := w.ImportMnemonic(strings.Join(args[1:], " ")); err != nil {
+			return nil, err
+		}
+		return w.ExportSecret()
+	}
+	return nil, fmt.Errorf("unknown secret subcommand '%v'", args[0])
+}
+
+func runKeyCommand(w *wallet.Wallet, passphrase string, args []string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, errors.New("missing key subcommand")
+	}
+
+	switch args[0] {
+	case "encrypt":
+		return nil, w.EncryptKey(passphrase)
+	case "passphrase":
+		if err := requireArgs(args[1:], 1); err != nil {
+			return nil, err
+		}
+		if args[1] == "" {
+			return nil, errors.New("the new passphrase must not be empty")
+		}
+		return nil, w.ChangePassphrase(passphrase, args[1])
+	}
+	return nil, fmt.Errorf("unknown key subcommand '%v'", args[0])
+}
+
+// runPoolCommand replenishes the pool once, the cli does not keep running to maintain it.
+func runPoolCommand(ctx context.Context, w *wallet.Wallet, args []string) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, errors.New("expected the budget and at least one pool target")
+	}
+	budget, err := parseAmount(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := wallet.PoolConfig{Targets: make(map[int64]wallet.PoolTarget), Budget: budget}
+	for _, arg := range args[1:] {
+		value, target, err := wallet.ParsePoolTarget(arg)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Targets[value] = target
+	}
+	if err := cfg.Validate(w.AllowedValues()); err != nil {
+		return nil, err
+	}
+
+	res, err := w.ReplenishPool(ctx, cfg, budget)
+	return poolSummary{Obtained: res, Status: w.PoolStatus()}, err
+}
+
+// createStore creates the wallet of the account. The passphrase can't be recovered, hence it is required twice.
+func createStore(w *wallet.Wallet, passphrase, confirmation string) error {
+	if passphrase != confirmation {
+		return errors.New("the passphrase and its confirmation do not match")
+	}
+	return w.CreateStore(passphrase)
+}
+
+func run(w *wallet.Wallet, cfgFile, passphrase string, args []string, timeout time.Duration) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	switch args[0] {
+	case "register":
+		return nil, w.RegisterAccount()
+	case "faucet":
+		if err := w.GetFaucetNym(ctx, faucetNyms); err != nil {
+			return nil, err
+		}
+		return w.UpdateBalances()
+	case "pipe":
+		if err := requireArgs(args[1:], 1); err != nil {
+			return nil, err
+		}
+		amount, err := parseAmount(args[1])
+		if err != nil {
+			return nil, err
+		}
+		if err := w.SendToPipeAccount(ctx, amount); err != nil {
+			return nil, err
+		}
+		return w.UpdateBalances()
+	case "redeem":
+		if err := requireArgs(args[1:], 1); err != nil {
+			return nil, err
+		}
+		amount, err := parseAmount(args[1])
+		if err != nil {
+			return nil, err
+		}
+		if err := w.RedeemTokens(ctx, amount); err != nil {
+			return nil, err
+		}
+		return w.UpdateBalances()
+	case "balances":
+		return w.UpdateBalances()
+	case "key":
+		return runKeyCommand(w, passphrase, args[1:])
+	case "secret":
+		return runSecretCommand(w, args[1:])
+	case "credential":
+		return runCredentialCommand(ctx, w, args[1:])
+	case "pool":
+		return runPoolCommand(ctx, w, args[1:])
+	case "ledger":
+		var filter wallet.LedgerFilter
+		if len(args) > 1 {
+			filter.Types = []wallet.OperationType{wallet.OperationType(strings.Join(args[1:], " "))}
+		}
+		return w.Ledger(filter)
+	case "backup":
+		if err := requireArgs(args[1:], 1); err != nil {
+			return nil, err
+		}
+		return nil, backup.Export(args[1], cfgFile, w, passphrase)
+	}
+	return nil, fmt.Errorf("unknown command '%v'", args[0])
+}
+
+func main() {
+	cfgFile := flag.String("f", "", "Path to the client config file.")
+	passphrase := flag.String("passphrase", "", "Passphrase of the wallet (overrides "+passphraseEnv+").")
+	passphraseConfirm := flag.String("passphrase-confirm", "", "Repeated passphrase of the wallet being created (overrides "+passphraseConfirmEnv+").")
+	account := flag.String("account", accounts.DefaultAccount, "Name of the account to use.")
+	timeout := flag.Duration("timeout", wallet.DefaultOperationTimeout, "Deadline for operations waiting for Ethereum and Nym blockchain.")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 || *cfgFile == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *passphrase == "" {
+		*passphrase = os.Getenv(passphraseEnv)
+	}
+	if *passphraseConfirm == "" {
+		*passphraseConfirm = os.Getenv(passphraseConfirmEnv)
+	}
+
+	if args[0] == "restore" {
+		if err := requireArgs(args[1:], 1); err != nil {
+			exit(output{Error: err.Error()})
+		}
+		cfg, err := backup.Restore(args[1], *cfgFile, *passphrase)
+		if err != nil {
+			exit(output{Error: err.Error()})
+		}
+		exit(output{OK: true, Result: summarize(cfg)})
+	}
+
+	cfg, err := config.LoadFile(*cfgFile)
+	if err != nil {
+		exit(output{Error: fmt.Sprintf("failed to load config file '%v': %v", *cfgFile, err)})
+	}
+
+	if args[0] == "load-config" {
+		exit(output{OK: true, Result: summarize(cfg)})
+	}
+
+	m, err := accounts.NewManager(cfg)
+	if err != nil {
+		exit(output{Error: fmt.Sprintf("could not load the accounts: %v", err)})
+	}
+
+	if args[0] == "accounts" {
+		result, err := runAccountsCommand(m, args[1:])
+		out := output{OK: err == nil, Result: result}
+		if err != nil {
+			out.Error = err.Error()
+		}
+		exit(out)
+	}
+
+	w, _, err := m.Wallet(*account, *passphrase)
+	if err != nil {
+		exit(output{Error: err.Error()})
+	}
+
+	// the wallet blocks if its events are not consumed, the only ones of interest are the errors
+	var warnings []string
+	warningsDone := make(chan struct{})
+	go func() {
+		defer close(warningsDone)
+		for ev := range w.Events() {
+			if errEv, ok := ev.(wallet.ErrorEvent); ok {
+				warnings = append(warnings, errEv.Err.Error())
+			}
+		}
+	}()
+
+	var result interface{}
+	if args[0] == "create" {
+		err = createStore(w, *passphrase, *passphraseConfirm)
+	} else {
+		if err := w.OpenStore(*passphrase); err != nil {
+			if err == wallet.ErrStoreNotExist {
+				exit(output{Error: "the wallet of the account does not exist yet - create it with the 'create' command"})
+			}
+			exit(output{Error: fmt.Sprintf("could not open the wallet: %v", err)})
+		}
+		result, err = run(w, *cfgFile, *passphrase, args, *timeout)
+	}
+	w.Close()
+	<-warningsDone
+
+	out := output{
+		OK:       err == nil,
+		Result:   result,
+		Warnings: warnings,
+	}
+	if err != nil {
+		out.Error = err.Error()
+		if category := wallet.ClassifyError(err); category != wallet.Uncategorized {
+			explanation, action := category.Hint()
+			out.ErrorCategory = string(category)
+			out.Hint = explanation + " " + action
+		}
+	}
+	exit(out)
+}
@@ -0,0 +1,65 @@
+// main_test.go - tests of the command line parsing of headless nym wallet
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestParseSpendArgs(t *testing.T) {
+	tests := []struct {
+		args  []string
+		force bool
+		valid bool
+	}{
+		{[]string{"42", "127.0.0.1:4100"}, false, true},
+		{[]string{"42", "127.0.0.1:4100", "force"}, true, true},
+		{[]string{"42", "127.0.0.1:4100", "please"}, false, false},
+		{[]string{"42"}, false, false},
+		{[]string{"42", "127.0.0.1:4100", "force", "force"}, false, false},
+	}
+
+	for _, test := range tests {
+		seq, sp, force, err := parseSpendArgs(test.args)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("%v: expected an error", test.args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.args, err)
+			continue
+		}
+		if seq != "42" || sp != "127.0.0.1:4100" || force != test.force {
+			t.Errorf("%v: got seq %v, sp %v and force %v", test.args, seq, sp, force)
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	for raw, expected := range map[string]int64{"5": 5, "10Nym": 10} {
+		if amount, err := parseAmount(raw); err != nil || amount != expected {
+			t.Errorf("%v: expected %v, got %v (%v)", raw, expected, amount, err)
+		}
+	}
+	for _, raw := range []string{"0", "-5", "five", ""} {
+		if _, err := parseAmount(raw); err == nil {
+			t.Errorf("%v: expected an error", raw)
+		}
+	}
+}
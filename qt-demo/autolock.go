@@ -0,0 +1,112 @@
+// autolock.go - locking the wallet after a period of inactivity
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/therecipe/qt/core"
+	"github.com/therecipe/qt/gui"
+)
+
+const defaultAutoLockMinutes = 5
+
+// installActivityFilter makes any key press or mouse click within the application reset the idle timer of the bridge.
+func installActivityFilter(app *gui.QGuiApplication, qb *QmlBridge) {
+	filter := core.NewQObject(nil)
+	filter.ConnectEventFilter(func(watched *core.QObject, event *core.QEvent) bool {
+		switch event.Type() {
+		case core.QEvent__KeyPress, core.QEvent__MouseButtonPress, core.QEvent__Wheel, core.QEvent__TouchBegin:
+			qb.resetIdleTimer()
+		}
+		return filter.EventFilterDefault(watched, event)
+	})
+	app.InstallEventFilter(filter)
+}
+
+// initAutoLock must be called on the main thread.
+func (qb *QmlBridge) initAutoLock() {
+	qb.idleTimer = core.NewQTimer(nil)
+	qb.idleTimer.SetSingleShot(true)
+	qb.idleTimer.ConnectTimeout(qb.autoLock)
+
+	qb.SetAutoLockMinutes(defaultAutoLockMinutes)
+	qb.ConnectAutoLockMinutesChanged(func(int) { qb.resetIdleTimer() })
+}
+
+// resetIdleTimer restarts the countdown to locking the wallet. Non-positive period disables the auto-lock.
+func (qb *QmlBridge) resetIdleTimer() {
+	if qb.AutoLockMinutes() <= 0 {
+		qb.idleTimer.Stop()
+		return
+	}
+	qb.idleTimer.Start(int(time.Duration(qb.AutoLockMinutes()) * time.Minute / time.Millisecond))
+}
+
+func (qb *QmlBridge) autoLock() {
+	if qb.session.Wallet() == nil {
+		return
+	}
+	// operations can't be interrupted midway, so try again once the user is idle for another period
+	if err := qb.lock(); err != nil {
+		log.Info("postponed the auto-lock", "reason", err)
+		qb.resetIdleTimer()
+		return
+	}
+	log.Info("wallet locked due to inactivity", "minutes", qb.AutoLockMinutes())
+}
+
+// lock wipes all the secrets of all the accounts from memory. It does not cancel any operation,
+// so it fails if any of them are still in progress.
+func (qb *QmlBridge) lock() error {
+	if qb.session.Wallet() == nil {
+		return errors.New("the wallet is not unlocked")
+	}
+	if qb.jobManager.ActiveCount() > 0 {
+		return errors.New("wait for all operations to finish or cancel them before locking the wallet")
+	}
+
+	// any events still queued for the wallets are no longer relevant
+	atomic.AddUint64(&qb.activation, 1)
+	qb.session.Lock()
+	qb.accounts.LockWallets()
+	// seed phrases of the new accounts can no longer be used without the passphrase either
+	qb.wipePendingMnemonics()
+	qb.UpdateSecret("")
+	// the credential pools are stopped together with the wallets
+	qb.updatePoolStatus()
+	qb.SetLocked(true)
+	return nil
+}
+
+func (qb *QmlBridge) lockWallet() bool {
+	if err := qb.lock(); err != nil {
+		qb.DisplayNotificationf(errNotificationTitle, "%v", err)
+		return false
+	}
+	log.Info("wallet locked")
+	return true
+}
+
+// unlockWallet re-creates and opens the wallet of the account that was active when the wallet got locked.
+func (qb *QmlBridge) unlockWallet(passphrase string) bool {
+	if !qb.Locked() {
+		return true
+	}
+	return qb.switchAccount(qb.session.Account(), passphrase)
+}
@@ -16,35 +16,40 @@
 package main
 
 import (
-	"context"
-	"crypto/ecdsa"
-	"encoding/base64"
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	ethcommon "github.com/ethereum/go-ethereum/common"
 	ethcrypto "github.com/ethereum/go-ethereum/crypto"
-	Curve "github.com/nymtech/amcl/version3/go/amcl/BLS381"
-	"github.com/nymtech/nym-validator/client"
 	"github.com/nymtech/nym-validator/client/config"
-	coconut "github.com/nymtech/nym-validator/crypto/coconut/scheme"
-	"github.com/nymtech/nym-validator/crypto/coconut/utils"
-	"github.com/nymtech/nym-validator/nym/token"
+	"github.com/nymtech/qt-validator-client-demo/internal/accounts"
+	"github.com/nymtech/qt-validator-client-demo/internal/backup"
+	"github.com/nymtech/qt-validator-client-demo/internal/jobs"
+	"github.com/nymtech/qt-validator-client-demo/internal/keystore"
+	"github.com/nymtech/qt-validator-client-demo/internal/logging"
+	"github.com/nymtech/qt-validator-client-demo/internal/mnemonic"
+	"github.com/nymtech/qt-validator-client-demo/internal/notifications"
+	"github.com/nymtech/qt-validator-client-demo/internal/sensitive"
+	"github.com/nymtech/qt-validator-client-demo/internal/session"
+	"github.com/nymtech/qt-validator-client-demo/internal/wallet"
 	"github.com/therecipe/qt/core"
 )
 
+var log = logging.New("bridge")
+
 const (
-	errNotificationTitle  = "Error"
-	warnNotificationTitle = "Warning"
-	infoNotificationTitle = "Notification"
-)
+	critNotificationTitle = session.CriticalTitle
+	errNotificationTitle  = session.ErrorTitle
+	warnNotificationTitle = session.WarningTitle
+	infoNotificationTitle = session.InfoTitle
 
-type IssuedCredential struct {
-	credential *coconut.Signature
-	token      *token.Token
-}
+	maxConcurrentJobs = 4
+	maxFinishedJobs   = 20
+)
 
 //go:generate qtmoc
 type ConfigBridge struct {
@@ -56,138 +61,205 @@ type ConfigBridge struct {
 	_ string `property:"ethereumNode"`
 	_ string `property:"nymERC20"`
 	_ string `property:"pipeAccount"`
+	_ bool   `property:"keyEncrypted"`
 }
 
 //go:generate qtmoc
 type QmlBridge struct {
 	core.QObject
-	cfg            *config.Config
-	clientInstance *client.Client
-	longtermSecret *Curve.BIG
-
-	_ func()                                                                                        `constructor:"init"`
-	_ func(file string)                                                                             `slot:"loadConfig,auto"`
-	_ func()                                                                                        `slot:"confirmConfig,auto"`
-	_ func(message, title string)                                                                   `signal:"displayNotification"`
-	_ func(identifier, address string)                                                              `signal:"newNymValidator"`
-	_ func(identifier, address string)                                                              `signal:"newTendermintValidator"`
-	_ func(amount string)                                                                           `signal:"updateERC20NymBalance"`
-	_ func(amount string)                                                                           `signal:"updateERC20NymBalancePending"`
-	_ func()                                                                                        `signal:"ResetWaitingForEthereumLabel"`
-	_ func(amount string)                                                                           `signal:"updateNymTokenBalance"`
-	_ func(strigifiedSecret string)                                                                 `signal:"updateSecret"`
-	_ func(values []string)                                                                         `signal:"populateValueComboBox"`
-	_ func(sps []string)                                                                            `signal:"populateSPComboBox"`
-	_ func(busyIndicator *core.QObject, mainLayoutObject *core.QObject)                             `slot:"forceUpdateBalances,auto"`
-	_ func()                                                                                        `signal:"markSpentCredential"`
-	_ func(amount string, busyIndicator *core.QObject, mainLayoutObject *core.QObject)              `slot:"sendToPipeAccount,auto"`
-	_ func(amount string, busyIndicator *core.QObject, mainLayoutObject *core.QObject)              `slot:"redeemTokens,auto"`
-	_ func(value string, busyIndicator *core.QObject, mainLayoutObject *core.QObject)               `slot:"getCredential,auto"`
-	_ func(chosenSP, seqString string, busyIndicator *core.QObject, mainLayoutObject *core.QObject) `slot:"spendCredential,auto"`
-	_ func(item CredentialListItem)                                                                 `signal:"addCredentialListItem"`
-	_ func()                                                                                        `signal:"showNewKeyDialog"`
-	_ func()                                                                                        `slot:"generateNewKey,auto"`
-	_ func(accountExists bool)                                                                      `signal:"setAccountStatus"`
-	_ func(busyIndicator *core.QObject, mainLayoutObject *core.QObject)                             `slot:"registerAccount,auto"`
-	_ func(busyIndicator *core.QObject, mainLayoutObject *core.QObject)                             `slot:"getFaucetNym,auto"`
-	_ func(seqString string) string                                                                 `slot:"randomizeCredential,auto"`
-}
-
-func enableAllObjects(objs []*core.QObject) {
-	for _, obj := range objs {
-		obj.SetProperty("enabled", core.NewQVariant1(true))
-	}
-}
-
-func disableAllObjects(objs []*core.QObject) {
-	for _, obj := range objs {
-		obj.SetProperty("enabled", core.NewQVariant1(false))
-	}
-}
-
-func toggleIndicatorAndObjects(indicator *core.QObject, objs []*core.QObject, run bool) {
-	if run {
-		if indicator != nil {
-			indicator.SetProperty("running", core.NewQVariant1(true))
-		}
-		if len(objs) > 0 {
-			disableAllObjects(objs)
-		}
-	} else {
-		if indicator != nil {
-			indicator.SetProperty("running", core.NewQVariant1(false))
-		}
-		if len(objs) > 0 {
-			enableAllObjects(objs)
-		}
-	}
+	cfg *config.Config
+	// path of the file from which the config was loaded
+	cfgFile  string
+	accounts *accounts.Manager
+	// performs all the operations on the wallet of the active account, it must only be accessed on the main thread
+	session *session.Session
+	// incremented whenever an account is activated, so that any stale events could be discarded
+	activation uint64
+	// set when a fresh key was generated, but the user did not yet confirm backing it up
+	keyBackupPending bool
+	// seed phrases of the accounts whose keys were just created, by account name;
+	// the long-term secrets are derived from them once the wallets get opened
+	pendingMnemonics map[string]*sensitive.Bytes
+
+	jobManager    *jobs.Manager
+	notifications *notifications.Center
+	// all the signals originating from the worker goroutines are emitted through it
+	dispatcher *Dispatcher
+	// locks the wallet once it expires, it is restarted by any user activity
+	idleTimer *core.QTimer
+
+	_ func()                                                           `constructor:"init"`
+	_ func(file string)                                                `slot:"loadConfig,auto"`
+	_ func(passphrase string) bool                                     `slot:"confirmConfig,auto"`
+	_ func(name string) bool                                           `slot:"walletExists,auto"`
+	_ func(name, passphrase, confirmation string) bool                 `slot:"createWallet,auto"`
+	_ func(message, title string)                                      `signal:"displayNotification"`
+	_ func(item NotificationListItem)                                  `signal:"notificationUpdated"`
+	_ func(id int)                                                     `signal:"notificationRemoved"`
+	_ func()                                                           `signal:"notificationsCleared"`
+	_ func(id int)                                                     `slot:"dismissNotification,auto"`
+	_ func()                                                           `slot:"dismissAllNotifications,auto"`
+	_ int                                                              `property:"notificationCount"`
+	_ func(identifier, address string)                                 `signal:"newNymValidator"`
+	_ func(identifier, address string)                                 `signal:"newTendermintValidator"`
+	_ func(amount string)                                              `signal:"updateERC20NymBalance"`
+	_ func(amount string)                                              `signal:"updateERC20NymBalancePending"`
+	_ func()                                                           `signal:"ResetWaitingForEthereumLabel"`
+	_ func(amount string)                                              `signal:"updateNymTokenBalance"`
+	_ func(strigifiedSecret string)                                    `signal:"updateSecret"`
+	_ func(values []string)                                            `signal:"populateValueComboBox"`
+	_ func(sps []string)                                               `signal:"populateSPComboBox"`
+	_ func() int                                                       `slot:"forceUpdateBalances,auto"`
+	_ func(sequence, state string)                                     `signal:"credentialStateChanged"`
+	_ func(amount string) int                                          `slot:"sendToPipeAccount,auto"`
+	_ func(amount string) int                                          `slot:"redeemTokens,auto"`
+	_ func(value string) int                                           `slot:"getCredential,auto"`
+	_ func(chosenSP, seqString string, force bool) int                 `slot:"spendCredential,auto"`
+	_ func(amount string) int                                          `slot:"getCredentialsForAmount,auto"`
+	_ func(value string, count int) int                                `slot:"getCredentialBatch,auto"`
+	_ func(targets []string, budget string) bool                       `slot:"startCredentialPool,auto"`
+	_ func()                                                           `slot:"stopCredentialPool,auto"`
+	_ func(item CredentialListItem)                                    `signal:"addCredentialListItem"`
+	_ func(fileExists bool)                                            `signal:"showNewKeyDialog"`
+	_ func(backupExisting bool) bool                                   `slot:"createKey,auto"`
+	_ func(source, value, passphrase string, backupExisting bool) bool `slot:"importKey,auto"`
+	_ func(address, keyfile, backup, phrase string)                    `signal:"showKeyBackupDialog"`
+	_ func()                                                           `slot:"confirmKeyBackup,auto"`
+	_ func(accountExists bool)                                         `signal:"setAccountStatus"`
+	_ func() int                                                       `slot:"registerAccount,auto"`
+	_ func() int                                                       `slot:"getFaucetNym,auto"`
+	_ func(seqString string) string                                    `slot:"randomizeCredential,auto"`
+	_ func()                                                           `signal:"showNewSecretDialog"`
+	_ func() bool                                                      `slot:"generateSecret,auto"`
+	_ func(hexSecret string) bool                                      `slot:"importSecret,auto"`
+	_ func(phrase string) bool                                         `slot:"importMnemonic,auto"`
+	_ func(file, passphrase string) bool                               `slot:"exportBackup,auto"`
+	_ func(bundleFile, configFile, passphrase string) bool             `slot:"restoreBackup,auto"`
+	_ func() bool                                                      `slot:"lockWallet,auto"`
+	_ func(passphrase string) bool                                     `slot:"unlockWallet,auto"`
+	_ func() string                                                    `slot:"exportSecret,auto"`
+	_ func(id int)                                                     `slot:"cancelOperation,auto"`
+	_ func(item JobListItem)                                           `signal:"jobUpdated"`
+	_ func(id int)                                                     `signal:"jobFinished"`
+	_ func(item LedgerListItem)                                        `signal:"addLedgerListItem"`
+	_ func(item LogListItem)                                           `signal:"addLogListItem"`
+	_ func()                                                           `slot:"followLog,auto"`
+	_ func(types []string)                                             `signal:"populateLedgerTypeComboBox"`
+	_ func(names []string)                                             `signal:"populateAccountComboBox"`
+	_ func(name string)                                                `signal:"accountSwitched"`
+	_ func(name string) bool                                           `slot:"isAccountOpen,auto"`
+	_ func(name, passphrase string) bool                               `slot:"switchAccount,auto"`
+	_ func(name string) bool                                           `slot:"addAccount,auto"`
+	_ func(passphrase string) bool                                     `slot:"encryptAccountKey,auto"`
+	_ func(oldPassphrase, newPassphrase string) bool                   `slot:"changePassphrase,auto"`
+
+	// timeout (in seconds) of all operations waiting for Ethereum or Nym blockchain
+	_ int `property:"operationTimeout"`
+	// number of queued and running operations
+	_ int `property:"activeJobs"`
+	// minutes of inactivity after which the wallet gets locked, zero disables the auto-lock
+	_ int  `property:"autoLockMinutes"`
+	_ bool `property:"locked"`
+	// state of the credential pool of the active account
+	_ bool   `property:"poolRunning"`
+	_ string `property:"poolStatus"`
 }
 
+// DisplayNotificationf adds the formatted notification to the notification list, critical ones are
+// additionally displayed in a dialog. It is safe to call it from any goroutine.
 func (qb *QmlBridge) DisplayNotificationf(title string, fmtMessage string, a ...interface{}) {
-	msg := fmtMessage
-	if a != nil {
-		msg = fmt.Sprintf(fmtMessage, a...)
-	}
-	qb.DisplayNotification(msg, title)
+	qb.session.Notifyf(title, fmtMessage, a...)
 }
 
-func (qb *QmlBridge) waitForERC20BalanceChange(ctx context.Context, expectedBalance uint64) {
-	if qb.clientInstance == nil {
-		qb.DisplayNotificationf(errNotificationTitle, "nil client instance")
-		return
+// notified displays the notification posted by the session. It is safe to call it from any goroutine.
+func (qb *QmlBridge) notified(n notifications.Notification, pruned []int) {
+	qb.dispatcher.Run(func() {
+		for _, id := range pruned {
+			qb.NotificationRemoved(id)
+		}
+		qb.NotificationUpdated(NotificationListItem{n})
+		qb.SetNotificationCount(qb.notifications.Len())
+		// repeated critical notifications are not displayed again while the first one is still in the list
+		if n.Severity == notifications.Critical && n.Count == 1 {
+			qb.DisplayNotification(n.Message, n.Title)
+		}
+	})
+}
+
+func (qb *QmlBridge) dismissNotification(id int) {
+	if qb.notifications.Dismiss(id) {
+		qb.NotificationRemoved(id)
+		qb.SetNotificationCount(qb.notifications.Len())
 	}
-	retryTicker := time.NewTicker(2 * time.Second)
+}
 
-	for {
-		select {
-		case <-retryTicker.C:
-			currentBalance, err := qb.clientInstance.GetCurrentERC20Balance()
-			if err != nil {
-				qb.DisplayNotificationf(errNotificationTitle, "failed to query for ERC20 Nym Balance: %v", err)
-			} else {
-				qb.UpdateERC20NymBalance(strconv.FormatUint(currentBalance, 10))
-			}
+func (qb *QmlBridge) dismissAllNotifications() {
+	qb.notifications.DismissAll()
+	qb.NotificationsCleared()
+	qb.SetNotificationCount(0)
+}
 
-			pendingBalance, err := qb.clientInstance.GetCurrentERC20PendingBalance()
-			if err != nil {
-				qb.DisplayNotificationf(errNotificationTitle, "failed to query for ERC20 Nym Balance (pending): %v", err)
-			} else {
-				qb.UpdateERC20NymBalancePending(strconv.FormatUint(pendingBalance, 10))
-			}
+// followLog emits all the recent log records and then every new one as soon as it is written.
+func (qb *QmlBridge) followLog() {
+	recent := logging.Subscribe(func(rec logging.Record) {
+		qb.dispatcher.Run(func() { qb.AddLogListItem(LogListItem{rec}) })
+	})
+	for _, rec := range recent {
+		qb.AddLogListItem(LogListItem{rec})
+	}
+}
 
-			if currentBalance == expectedBalance {
-				return
+// handleWalletEvents translates all events published by the wallet into the corresponding qml signals.
+// Apart from errors, events of inactive accounts are discarded as the state of an account is displayed anew
+// whenever it gets activated.
+func (qb *QmlBridge) handleWalletEvents(w *wallet.Wallet) {
+	for ev := range w.Events() {
+		ev := ev
+		activation := atomic.LoadUint64(&qb.activation)
+		qb.dispatcher.Run(func() {
+			_, isError := ev.(wallet.ErrorEvent)
+			if isError || (qb.session.Wallet() == w && atomic.LoadUint64(&qb.activation) == activation) {
+				qb.handleWalletEvent(ev)
 			}
-		case <-ctx.Done():
-			qb.DisplayNotificationf(errNotificationTitle, "failed to query for obtain current ERC20 balances: ctx timeout")
-			return
-		}
+		})
 	}
 }
 
-func (qb *QmlBridge) updateBalances() {
-	if qb.clientInstance == nil {
-		qb.DisplayNotificationf(errNotificationTitle, "nil client instance")
-		return
-	}
-	erc20balance, err := qb.clientInstance.GetCurrentERC20Balance()
-	if err != nil {
-		qb.DisplayNotificationf(errNotificationTitle, "failed to query for ERC20 Nym Balance: %v", err)
-	}
-	pending, err := qb.clientInstance.GetCurrentERC20PendingBalance()
-	if err != nil {
-		qb.DisplayNotificationf(errNotificationTitle, "failed to query for ERC20 Nym Balance (pending): %v", err)
-	}
-	nymBalance, err := qb.clientInstance.GetCurrentNymBalance()
-	if err != nil {
-		qb.DisplayNotificationf(warnNotificationTitle, "failed to query for Nym Token Balance: %v\n\nIf your account does not exist, please make sure you did register it (by clicking 'REGISTER ACCOUNT' button",
-			err,
-		)
+// handleWalletEvent must only be called on the main thread.
+func (qb *QmlBridge) handleWalletEvent(ev wallet.Event) {
+	switch e := ev.(type) {
+	case wallet.BalanceChangedEvent:
+		amount := strconv.FormatUint(e.Amount, 10)
+		switch e.Kind {
+		case wallet.ERC20Balance:
+			qb.UpdateERC20NymBalance(amount)
+		case wallet.ERC20PendingBalance:
+			qb.UpdateERC20NymBalancePending(amount)
+		case wallet.NymBalance:
+			qb.UpdateNymTokenBalance(amount)
+		}
+	case wallet.CredentialAddedEvent:
+		qb.AddCredentialListItem(CredentialListItem{
+			credential: e.Credential.Signature,
+			sequence:   e.Credential.ID,
+			value:      uint64(e.Credential.Value),
+			state:      e.Credential.State,
+		})
+		qb.updatePoolStatus()
+	case wallet.CredentialStateChangedEvent:
+		qb.CredentialStateChanged(e.ID, string(e.State))
+		qb.updatePoolStatus()
+	case wallet.AccountStatusEvent:
+		qb.SetAccountStatus(e.Exists)
+	case wallet.SecretChangedEvent:
+		qb.UpdateSecret(e.Secret)
+	case wallet.LedgerEntryAddedEvent:
+		qb.AddLedgerListItem(LedgerListItem{e.Entry})
+	case wallet.ErrorEvent:
+		qb.session.NotifyError(e.Err)
+		// the failure might have been caused by the credential pool
+		qb.updatePoolStatus()
 	}
-
-	qb.UpdateERC20NymBalance(strconv.FormatUint(erc20balance, 10))
-	qb.UpdateERC20NymBalancePending(strconv.FormatUint(pending, 10))
-	qb.UpdateNymTokenBalance(strconv.FormatUint(nymBalance, 10))
 }
 
 func (qb *QmlBridge) loadConfig(file string) {
@@ -196,25 +268,30 @@ func (qb *QmlBridge) loadConfig(file string) {
 
 	cfg, err := config.LoadFile(file)
 	if err != nil {
-		qb.DisplayNotificationf(errNotificationTitle, "failed to load config file '%v': %v\n", file, err)
+		qb.DisplayNotificationf(critNotificationTitle, "failed to load config file '%v': %v\n", file, err)
 		return
-	} else {
-		fmt.Println("loaded config!")
 	}
 
+	if cfg.Logging != nil {
+		if err := logging.Configure(cfg.Logging.Disable, cfg.Logging.File, cfg.Logging.Level, os.Stdout); err != nil {
+			qb.DisplayNotificationf(warnNotificationTitle, "could not apply the logging config: %v", err)
+		}
+	}
+	log.Info("loaded config", "file", file)
+
 	configBridge.SetIdentifier(cfg.Client.Identifier)
 	configBridge.SetKeyfile(cfg.Nym.AccountKeysFile)
 
-	// TODO: later remove it, but for now it's temporary for demo sake
-	privateKey, loadErr := ethcrypto.LoadECDSA(cfg.Nym.AccountKeysFile)
+	// the address is available without the passphrase even if the key is encrypted
+	address, loadErr := keystore.Address(cfg.Nym.AccountKeysFile)
 	if loadErr != nil {
-		// qb.DisplayNotificationf(errNotificationTitle, "failed to load Nym keys: %v", loadErr)
-		fmt.Printf("failed to load Nym keys: %v\n", loadErr)
+		log.Warning("failed to load Nym keys", "keyfile", cfg.Nym.AccountKeysFile, "err", loadErr)
 		configBridge.SetAddress("could not load the key")
 	} else {
-		address := ethcrypto.PubkeyToAddress(*privateKey.Public().(*ecdsa.PublicKey)).Hex()
-		configBridge.SetAddress(address)
+		configBridge.SetAddress(address.Hex())
 	}
+	encrypted, _ := keystore.IsEncrypted(cfg.Nym.AccountKeysFile)
+	configBridge.SetKeyEncrypted(encrypted)
 
 	// should have been detected during validation...
 	if len(cfg.Nym.EthereumNodeAddresses) > 0 {
@@ -234,364 +311,591 @@ func (qb *QmlBridge) loadConfig(file string) {
 	}
 
 	qb.cfg = cfg
+	qb.cfgFile = file
 
-	if privateKey == nil || loadErr != nil {
-		qb.ShowNewKeyDialog()
+	if loadErr != nil {
+		_, statErr := os.Lstat(cfg.Nym.AccountKeysFile)
+		qb.ShowNewKeyDialog(statErr == nil)
 	}
 }
 
-func (qb *QmlBridge) confirmConfig() {
-	if qb.clientInstance == nil {
-		client, err := client.New(qb.cfg)
-		if err != nil {
-			qb.DisplayNotificationf(errNotificationTitle, "could not use the config to create client instance: %v", err)
-			return
-		}
-		qb.clientInstance = client
+// loadAccounts loads the accounts of the confirmed config, unless it was done already.
+func (qb *QmlBridge) loadAccounts() bool {
+	if qb.accounts != nil {
+		return true
 	}
-
-	if qb.longtermSecret == nil {
-		qb.longtermSecret = qb.clientInstance.RandomBIG()
-		qb.UpdateSecret(utils.ToCoconutString(qb.longtermSecret))
-	}
-	valueList := make([]string, len(token.AllowedValues))
-	for i, val := range token.AllowedValues {
-		valueList[i] = strconv.FormatInt(val, 10) + "Nym"
+	if qb.cfg == nil {
+		qb.DisplayNotificationf(errNotificationTitle, "no config is loaded")
+		return false
 	}
-	qb.PopulateValueComboBox(valueList)
 
-	// gui only cares about physical addresses (for now)
-	spAddresses := make([]string, len(qb.cfg.Nym.ServiceProviders))
-	i := 0
-	for sp := range qb.cfg.Nym.ServiceProviders {
-		spAddresses[i] = sp
-		i++
+	m, err := accounts.NewManager(qb.cfg)
+	if err != nil {
+		qb.DisplayNotificationf(critNotificationTitle, "could not load the accounts: %v", err)
+		return false
 	}
+	qb.accounts = m
 
-	qb.PopulateSPComboBox(spAddresses)
-	qb.SetAccountStatus(qb.checkIfAccountExists())
+	types := wallet.OperationTypes()
+	typeList := make([]string, len(types))
+	for i, t := range types {
+		typeList[i] = string(t)
+	}
+	qb.PopulateLedgerTypeComboBox(typeList)
+	qb.PopulateAccountComboBox(m.Names())
+	return true
 }
 
-func (qb *QmlBridge) forceUpdateBalances(busyIndicator *core.QObject, mainLayoutObject *core.QObject) {
-	go func() {
-		toggleIndicatorAndObjects(busyIndicator, []*core.QObject{mainLayoutObject}, true)
-		defer toggleIndicatorAndObjects(busyIndicator, []*core.QObject{mainLayoutObject}, false)
-
-		qb.updateBalances()
-	}()
+func (qb *QmlBridge) confirmConfig(passphrase string) bool {
+	if !qb.loadAccounts() {
+		return false
+	}
+	return qb.switchAccount(accounts.DefaultAccount, passphrase)
 }
 
-func (qb *QmlBridge) sendToPipeAccount(amount string, busyIndicator *core.QObject, mainLayoutObject *core.QObject) {
-	if qb.clientInstance == nil {
-		qb.DisplayNotificationf(errNotificationTitle, "nil client instance")
-		return
+// walletExists checks whether the wallet of the account was already created, so that the user could be asked
+// for a new passphrase otherwise. The empty name refers to the default account.
+func (qb *QmlBridge) walletExists(name string) bool {
+	if qb.cfg == nil {
+		qb.DisplayNotificationf(errNotificationTitle, "no config is loaded")
+		return false
 	}
 
-	go func() {
-		toggleIndicatorAndObjects(busyIndicator, []*core.QObject{mainLayoutObject}, true)
-		defer toggleIndicatorAndObjects(busyIndicator, []*core.QObject{mainLayoutObject}, false)
-
-		amountInt64, err := strconv.ParseInt(amount, 10, 64)
-		if err != nil {
-			qb.DisplayNotificationf(errNotificationTitle, "could not parse the value: %v", err)
-			return
+	// the accounts are only loaded once the config is confirmed, until then only the default one is known
+	keyFile := qb.cfg.Nym.AccountKeysFile
+	if name != "" && name != accounts.DefaultAccount {
+		if qb.accounts == nil {
+			qb.DisplayNotificationf(errNotificationTitle, "no config is confirmed")
+			return false
 		}
-
-		currentERC20Balance, err := qb.clientInstance.GetCurrentERC20Balance()
-		if err != nil {
-			qb.DisplayNotificationf(errNotificationTitle, "failed to query for ERC20 Nym Balance: %v", err)
-			return
-		}
-
-		currentNymBalance, err := qb.clientInstance.GetCurrentNymBalance()
+		acc, err := qb.accounts.Account(name)
 		if err != nil {
-			qb.DisplayNotificationf(errNotificationTitle, "failed to query for Nym Token Balance: %v", err)
-			return
+			qb.DisplayNotificationf(errNotificationTitle, "%v", err)
+			return false
 		}
+		keyFile = acc.KeyFile
+	}
 
-		// TODO:
-		ctx := context.TODO()
-		if err := qb.clientInstance.SendToPipeAccount(ctx, amountInt64); err != nil {
-			qb.DisplayNotificationf(errNotificationTitle, "failed to send %v to the pipe account: %v", amountInt64, err)
-			return
-		}
+	exists, err := wallet.StoreExists(keyFile)
+	if err != nil {
+		qb.DisplayNotificationf(errNotificationTitle, "could not check for the wallet: %v", err)
+	}
+	return exists
+}
 
-		// TODO: not the best option if multiple actions were taken concurrently, in future wait until block X is commited
-		qb.waitForERC20BalanceChange(ctx, currentERC20Balance-uint64(amountInt64))
+// createWallet creates the wallet of the account, encrypted with the passphrase, and makes the account active.
+// The passphrase has to be entered twice as the credentials would be lost for good if it was mistyped.
+// The empty name refers to the default account.
+func (qb *QmlBridge) createWallet(name, passphrase, confirmation string) bool {
+	if name == "" {
+		name = accounts.DefaultAccount
+	}
+	if passphrase != confirmation {
+		qb.DisplayNotificationf(errNotificationTitle, "The passphrases do not match")
+		return false
+	}
+	if !qb.loadAccounts() {
+		return false
+	}
+	return qb.openWallet(name, passphrase, true)
+}
 
-		if err := qb.clientInstance.WaitForBalanceChange(ctx, currentNymBalance+uint64(amountInt64)); err != nil {
-			qb.DisplayNotificationf(errNotificationTitle, "failed to query for Nym Token Balance: %v", err)
-			return
-		}
+func (qb *QmlBridge) isAccountOpen(name string) bool {
+	if qb.accounts == nil {
+		return false
+	}
+	w, ok := qb.accounts.LoadedWallet(name)
+	return ok && w.IsOpen()
+}
 
-		qb.UpdateNymTokenBalance(strconv.FormatUint(currentNymBalance+uint64(amountInt64), 10))
-		qb.ResetWaitingForEthereumLabel()
-	}()
+// switchAccount opens the wallet of the account, if it was not opened before, and makes the account active.
+// The passphrase is ignored for already opened wallets.
+func (qb *QmlBridge) switchAccount(name, passphrase string) bool {
+	return qb.openWallet(name, passphrase, false)
 }
 
-func (qb *QmlBridge) redeemTokens(amount string, busyIndicator *core.QObject, mainLayoutObject *core.QObject) {
-	if qb.clientInstance == nil {
-		qb.DisplayNotificationf(errNotificationTitle, "nil client instance")
-		return
+// openWallet opens or creates the wallet of the account and makes the account active.
+func (qb *QmlBridge) openWallet(name, passphrase string, create bool) bool {
+	if qb.accounts == nil {
+		qb.DisplayNotificationf(errNotificationTitle, "no config is loaded")
+		return false
+	}
+	if qb.keyBackupPending {
+		qb.DisplayNotificationf(errNotificationTitle, "Please back up the freshly generated key before using it")
+		return false
 	}
 
-	go func() {
-		toggleIndicatorAndObjects(busyIndicator, []*core.QObject{mainLayoutObject}, true)
-		defer toggleIndicatorAndObjects(busyIndicator, []*core.QObject{mainLayoutObject}, false)
+	// the same passphrase protects the wallet and the account key, if it is encrypted
+	w, created, err := qb.accounts.Wallet(name, passphrase)
+	if err != nil {
+		qb.DisplayNotificationf(errNotificationTitle, "%v", err)
+		return false
+	}
+	if created {
+		go qb.handleWalletEvents(w)
+	}
 
-		amountInt64, err := strconv.ParseInt(amount, 10, 64)
-		if err != nil {
-			qb.DisplayNotificationf(errNotificationTitle, "could not parse the value: %v", err)
-			return
+	// the wallet is opened before it becomes active, so that a failure would not affect the current account
+	switch {
+	case create:
+		if err := w.CreateStore(passphrase); err != nil {
+			qb.DisplayNotificationf(errNotificationTitle, "could not create the wallet of account %v: %v", name, err)
+			return false
 		}
-
-		currentERC20Balance, err := qb.clientInstance.GetCurrentERC20Balance()
-		if err != nil {
-			qb.DisplayNotificationf(errNotificationTitle, "failed to query for ERC20 Nym Balance: %v", err)
-			return
+		log.Info("wallet created", "account", name)
+	case !w.IsOpen():
+		if err := w.OpenStore(passphrase); err != nil {
+			title := critNotificationTitle
+			if err == wallet.ErrStoreNotExist {
+				title = errNotificationTitle
+			}
+			qb.DisplayNotificationf(title, "could not open the wallet of account %v: %v", name, err)
+			return false
 		}
+	}
 
-		currentNymBalance, err := qb.clientInstance.GetCurrentNymBalance()
-		if err != nil {
-			qb.DisplayNotificationf(errNotificationTitle, "failed to query for Nym Token Balance: %v", err)
-			return
+	qb.activate(name, w)
+	return true
+}
+
+// activate makes the wallet active and displays its entire state.
+func (qb *QmlBridge) activate(name string, w *wallet.Wallet) {
+	atomic.AddUint64(&qb.activation, 1)
+	qb.session.Activate(name, w)
+	qb.SetLocked(false)
+	qb.resetIdleTimer()
+	log.Info("account activated", "account", name)
+	// clears all the views of the previous account
+	qb.AccountSwitched(name)
+
+	if acc, err := qb.accounts.Account(name); err == nil {
+		configBridge.SetKeyfile(acc.KeyFile)
+		if address, err := acc.Address(); err == nil {
+			configBridge.SetAddress(address)
+		} else {
+			configBridge.SetAddress("could not load the key")
 		}
+	}
+	encrypted, _ := w.KeyEncrypted()
+	configBridge.SetKeyEncrypted(encrypted)
 
-		// TODO:
-		ctx := context.TODO()
+	for _, cred := range w.Credentials() {
+		qb.AddCredentialListItem(CredentialListItem{
+			credential: cred.Signature,
+			sequence:   cred.ID,
+			value:      uint64(cred.Value),
+			state:      cred.State,
+		})
+	}
+	qb.updatePoolStatus()
 
-		if err := qb.clientInstance.RedeemTokens(ctx, uint64(amountInt64)); err != nil {
-			qb.DisplayNotificationf(errNotificationTitle, "failed to redeem %v tokens: %v", amountInt64, err)
-			return
-		}
+	entries, err := w.Ledger(wallet.LedgerFilter{})
+	if err != nil {
+		qb.DisplayNotificationf(errNotificationTitle, "could not load the transaction history: %v", err)
+	}
+	for _, entry := range entries {
+		qb.AddLedgerListItem(LedgerListItem{entry})
+	}
 
-		if err := qb.clientInstance.WaitForBalanceChange(ctx, currentNymBalance-uint64(amountInt64)); err != nil {
-			qb.DisplayNotificationf(errNotificationTitle, "failed to query for Nym Token Balance: %v", err)
-			return
+	if phrase, ok := qb.pendingMnemonics[name]; ok {
+		if !w.HasSecret() {
+			if err := w.ImportMnemonic(string(phrase.Data())); err != nil {
+				qb.DisplayNotificationf(errNotificationTitle, "could not derive the long-term secret from the seed phrase: %v", err)
+			}
 		}
+		phrase.Wipe()
+		delete(qb.pendingMnemonics, name)
+	}
 
-		qb.UpdateNymTokenBalance(strconv.FormatUint(currentNymBalance-uint64(amountInt64), 10))
-		qb.waitForERC20BalanceChange(ctx, currentERC20Balance+uint64(amountInt64))
-		qb.ResetWaitingForEthereumLabel()
-	}()
-}
+	qb.UpdateSecret(w.DisplaySecret())
+	if !w.HasSecret() {
+		// do not silently generate it - user might have wanted to use secret from a different wallet
+		qb.ShowNewSecretDialog()
+	}
 
-func (qb *QmlBridge) getCredential(value string, busyIndicator *core.QObject, mainLayoutObject *core.QObject) {
-	if qb.clientInstance == nil {
-		qb.DisplayNotificationf(errNotificationTitle, "nil client instance")
-		return
+	allowedValues := w.AllowedValues()
+	valueList := make([]string, len(allowedValues))
+	for i, val := range allowedValues {
+		valueList[i] = strconv.FormatInt(val, 10) + "Nym"
 	}
+	qb.PopulateValueComboBox(valueList)
 
-	go func() {
-		toggleIndicatorAndObjects(busyIndicator, []*core.QObject{mainLayoutObject}, true)
-		defer toggleIndicatorAndObjects(busyIndicator, []*core.QObject{mainLayoutObject}, false)
+	// gui only cares about physical addresses (for now)
+	qb.PopulateSPComboBox(w.ServiceProviders())
+	qb.SetAccountStatus(qb.checkIfAccountExists())
+	qb.forceUpdateBalances()
+}
 
-		value = strings.TrimSuffix(value, "Nym")
-		valueInt64, err := strconv.ParseInt(value, 10, 64)
-		if err != nil {
-			qb.DisplayNotificationf(errNotificationTitle, "could not parse the value: %v", err)
-			return
-		}
+func (qb *QmlBridge) encryptAccountKey(passphrase string) bool {
+	if !qb.session.EncryptAccountKey(passphrase) {
+		return false
+	}
+	configBridge.SetKeyEncrypted(true)
+	return true
+}
 
-		seq := qb.clientInstance.RandomBIG()
+func (qb *QmlBridge) changePassphrase(oldPassphrase, newPassphrase string) bool {
+	if !qb.session.ChangePassphrase(oldPassphrase, newPassphrase) {
+		return false
+	}
+	configBridge.SetKeyEncrypted(true)
+	return true
+}
 
-		token, err := token.New(seq, qb.longtermSecret, valueInt64)
-		if err != nil {
-			qb.DisplayNotificationf(errNotificationTitle, "could not generate token for %v: %v", value, err)
-			return
-		}
+func (qb *QmlBridge) addAccount(name string) bool {
+	if qb.accounts == nil {
+		qb.DisplayNotificationf(errNotificationTitle, "no config is loaded")
+		return false
+	}
 
-		cred, err := qb.clientInstance.GetCredential(token)
-		if err != nil {
-			qb.DisplayNotificationf(errNotificationTitle, "could not obtain credential for %v: %v", value, err)
-			return
-		}
+	acc, phrase, err := qb.accounts.Add(name)
+	if err != nil {
+		qb.DisplayNotificationf(errNotificationTitle, "could not create the account: %v", err)
+		return false
+	}
+	qb.PopulateAccountComboBox(qb.accounts.Names())
 
-		qb.updateBalances()
+	address, _ := acc.Address()
+	qb.setPendingMnemonic(name, phrase)
+	qb.keyBackupPending = true
+	qb.ShowKeyBackupDialog(address, acc.KeyFile, "", phrase)
+	return true
+}
 
-		fmt.Printf("obtained credential: %+v\n", cred)
+func (qb *QmlBridge) generateSecret() bool {
+	return qb.session.GenerateSecret()
+}
 
-		credBytes, err := cred.MarshalBinary()
-		if err != nil {
-			qb.DisplayNotificationf(errNotificationTitle, "could not marshal obtained credential: %v", err)
-			return
-		}
+func (qb *QmlBridge) importSecret(hexSecret string) bool {
+	return qb.session.ImportSecret(hexSecret)
+}
 
-		seqString := utils.ToCoconutString(seq)
+func (qb *QmlBridge) importMnemonic(phrase string) bool {
+	return qb.session.ImportMnemonic(phrase)
+}
 
-		item := CredentialListItem{
-			credential: base64.StdEncoding.EncodeToString(credBytes),
-			sequence:   seqString,
-			value:      uint64(valueInt64),
-		}
+func (qb *QmlBridge) exportBackup(file, passphrase string) bool {
+	// TODO: is that prefix always added?
+	return qb.session.ExportBackup(strings.TrimPrefix(file, "file://"), qb.cfgFile, passphrase)
+}
 
-		issuedCredential := &IssuedCredential{
-			credential: cred,
-			token:      token, // encapsulates all attributes
-		}
+// restoreBackup recreates the config, the account key and the wallet from the backup and loads the restored config.
+// The wallet, including all the credentials, is then opened as usual once the config is confirmed.
+func (qb *QmlBridge) restoreBackup(bundleFile, configFile, passphrase string) bool {
+	if qb.accounts != nil {
+		qb.DisplayNotificationf(errNotificationTitle, "A backup can only be restored before any config is confirmed")
+		return false
+	}
 
-		// TODO: locking? - the map is being written in goroutine so in theory we might have concurrency issues
-		// but then again, if button is pressed, the other parts of the gui are locked
-		// in principle each credential has unique sequence number by which it can be identified
-		credentialMap[seqString] = issuedCredential
+	bundleFile = strings.TrimPrefix(bundleFile, "file://")
+	configFile = strings.TrimPrefix(configFile, "file://")
+	if _, err := backup.Restore(bundleFile, configFile, passphrase); err != nil {
+		qb.DisplayNotificationf(errNotificationTitle, "could not restore the backup: %v", err)
+		return false
+	}
+	log.Info("backup restored", "file", bundleFile, "config", configFile)
+	qb.loadConfig(configFile)
+	return true
+}
 
-		qb.AddCredentialListItem(item)
-	}()
+func (qb *QmlBridge) exportSecret() string {
+	return qb.session.ExportSecret()
 }
 
-func (qb *QmlBridge) spendCredential(chosenSP, seqString string, busyIndicator *core.QObject, mainLayoutObject *core.QObject) {
-	if qb.clientInstance == nil {
-		qb.DisplayNotificationf(errNotificationTitle, "nil client instance")
-		return
+// handleJobUpdates forwards state of all the jobs to the qml.
+func (qb *QmlBridge) handleJobUpdates(updates <-chan jobs.Job) {
+	for job := range updates {
+		item := JobListItem{
+			id:     job.ID,
+			name:   job.Name,
+			state:  job.State.String(),
+			stage:  job.Stage,
+			active: !job.State.Finished(),
+		}
+		if job.Err != nil {
+			item.err = job.Err.Error()
+		}
+		activeJobs := qb.jobManager.ActiveCount()
+		finished := job.State.Finished()
+
+		qb.dispatcher.Run(func() {
+			qb.JobUpdated(item)
+			qb.SetActiveJobs(activeJobs)
+			if finished {
+				qb.JobFinished(item.id)
+			}
+		})
 	}
+}
 
-	go func() {
-		toggleIndicatorAndObjects(busyIndicator, []*core.QObject{mainLayoutObject}, true)
-		defer toggleIndicatorAndObjects(busyIndicator, []*core.QObject{mainLayoutObject}, false)
+func (qb *QmlBridge) cancelOperation(id int) {
+	qb.jobManager.Cancel(id)
+}
 
-		spAddressRaw, ok := qb.cfg.Nym.ServiceProviders[chosenSP]
-		spAddress := ethcommon.HexToAddress(spAddressRaw)
-		if !ok {
-			qb.DisplayNotificationf(errNotificationTitle, "No service provider with address %v exists", chosenSP)
-			return
-		}
+func (qb *QmlBridge) forceUpdateBalances() int {
+	return qb.session.UpdateBalances()
+}
 
-		cred, ok := credentialMap[seqString]
-		if !ok {
-			qb.DisplayNotificationf(errNotificationTitle, "no credential exists for that sequence number (%v)", seqString)
-			return
-		}
+func (qb *QmlBridge) sendToPipeAccount(amount string) int {
+	return qb.session.SendToPipeAccount(amount)
+}
 
-		wasSuccessful, err := qb.clientInstance.SpendCredential(cred.token, cred.credential, chosenSP, spAddress, nil)
-		if err != nil {
-			qb.DisplayNotificationf(errNotificationTitle, "could not spend the credential: %v", err)
-			return
-		}
+func (qb *QmlBridge) redeemTokens(amount string) int {
+	return qb.session.RedeemTokens(amount)
+}
 
-		if wasSuccessful {
-			qb.DisplayNotificationf(infoNotificationTitle, "We successfully managed to spend credential with value of %v Nyms at SP (%v) with address %v!", cred.token.Value(), chosenSP, spAddress.Hex())
-		} else {
-			qb.DisplayNotificationf(infoNotificationTitle, "We failed to spend credential with value of %v Nyms at SP (%v) with address %v: %v", cred.token.Value(), chosenSP, spAddress.Hex(), err)
-		}
+func (qb *QmlBridge) getCredential(value string) int {
+	return qb.session.GetCredential(value)
+}
 
-		// TODO: for demo sake, mark as spent (so you could see double-spent error), but in future just remove it
-		qb.MarkSpentCredential()
-	}()
+// getCredentialsForAmount obtains credentials worth the amount in total, split into the allowed values.
+func (qb *QmlBridge) getCredentialsForAmount(amount string) int {
+	return qb.session.GetCredentialsForAmount(amount)
 }
 
-func (qb *QmlBridge) generateNewKey() {
-	fmt.Println("new keygen")
-	pk, err := ethcrypto.GenerateKey()
-	if err != nil {
-		qb.DisplayNotificationf(errNotificationTitle, "could not generate a fresh key: %v", err)
-		return
-	}
-	if err := ethcrypto.SaveECDSA(qb.cfg.Nym.AccountKeysFile, pk); err != nil {
-		qb.DisplayNotificationf(errNotificationTitle, "could not save the new key: %v", err)
-	}
+// getCredentialBatch concurrently obtains count credentials of the value.
+func (qb *QmlBridge) getCredentialBatch(value string, count int) int {
+	return qb.session.GetCredentialBatch(value, count)
 }
 
-func (qb *QmlBridge) checkIfAccountExists() bool {
-	if qb.clientInstance == nil {
-		qb.DisplayNotificationf(errNotificationTitle, "nil client instance")
+// startCredentialPool starts replenishing the credential pool of the active account in the background,
+// the targets are in the <value>:<target>:<threshold> format.
+func (qb *QmlBridge) startCredentialPool(targets []string, budget string) bool {
+	if !qb.session.StartCredentialPool(targets, budget) {
 		return false
 	}
+	qb.updatePoolStatus()
+	return true
+}
+
+func (qb *QmlBridge) stopCredentialPool() {
+	qb.session.StopCredentialPool()
+	qb.updatePoolStatus()
+}
+
+// updatePoolStatus displays the state of the credential pool of the active account.
+// It must only be called on the main thread.
+func (qb *QmlBridge) updatePoolStatus() {
+	running, status := qb.session.PoolStatus()
+	qb.SetPoolRunning(running)
+	qb.SetPoolStatus(status)
+}
 
-	exists, err := qb.clientInstance.CheckAccountExistence()
+// spendCredential spends the credential at the service provider, force is required to spend a credential that
+// is known to be spent already.
+func (qb *QmlBridge) spendCredential(chosenSP, seqString string, force bool) int {
+	return qb.session.SpendCredential(chosenSP, seqString, force)
+}
+
+// sources of the keys accepted by importKey
+const (
+	keySourceMnemonic = "mnemonic"
+	keySourceHex      = "hex"
+	keySourceKeystore = "keystore"
+)
+
+// createKey saves a key derived from a fresh seed phrase at the location specified by the config.
+func (qb *QmlBridge) createKey(backupExisting bool) bool {
+	phrase, err := mnemonic.New()
 	if err != nil {
-		qb.DisplayNotificationf(errNotificationTitle, "could not check for account existence")
+		qb.DisplayNotificationf(errNotificationTitle, "could not generate a seed phrase: %v", err)
 		return false
 	}
-	return exists
+	return qb.saveKeyFromMnemonic(phrase, backupExisting, true)
 }
 
-func (qb *QmlBridge) registerAccount(busyIndicator *core.QObject, mainLayoutObject *core.QObject) {
-	if qb.clientInstance == nil {
-		qb.DisplayNotificationf(errNotificationTitle, "nil client instance")
-		return
-	}
-
-	go func() {
-		toggleIndicatorAndObjects(busyIndicator, []*core.QObject{mainLayoutObject}, true)
-		defer toggleIndicatorAndObjects(busyIndicator, []*core.QObject{mainLayoutObject}, false)
-
-		// fake non-existent credential
-		accountCred := []byte("foo")
-		if err := qb.clientInstance.RegisterAccount(accountCred); err != nil {
-			qb.DisplayNotificationf(errNotificationTitle, "could not register Nym account: %v", err)
-			return
+// importKey saves an existing key at the location specified by the config. The value is either a seed phrase,
+// a hex encoded private key or the path to a key file, depending on the source. The passphrase is only used
+// to decrypt the keystore files.
+func (qb *QmlBridge) importKey(source, value, passphrase string, backupExisting bool) bool {
+	switch source {
+	case keySourceMnemonic:
+		return qb.saveKeyFromMnemonic(value, backupExisting, false)
+	case keySourceHex:
+		pk, err := keystore.ParseHex(value)
+		if err != nil {
+			qb.DisplayNotificationf(errNotificationTitle, "%v", err)
+			return false
 		}
+		defer sensitive.WipeKey(pk)
+		return qb.saveKey(backupExisting, func(keyFile string) (ethcommon.Address, error) {
+			return ethcrypto.PubkeyToAddress(pk.PublicKey), keystore.SaveNew(keyFile, pk)
+		}, "")
+	case keySourceKeystore:
+		// TODO: is that prefix always added?
+		src := strings.TrimPrefix(value, "file://")
+		return qb.saveKey(backupExisting, func(keyFile string) (ethcommon.Address, error) {
+			return keystore.ImportFile(keyFile, src, passphrase)
+		}, "")
+	}
+	qb.DisplayNotificationf(errNotificationTitle, "unknown key source '%v'", source)
+	return false
+}
+
+func (qb *QmlBridge) saveKeyFromMnemonic(phrase string, backupExisting, showPhrase bool) bool {
+	seed, err := mnemonic.ToSeed(phrase)
+	if err != nil {
+		qb.DisplayNotificationf(errNotificationTitle, "%v", err)
+		return false
+	}
+	pk, err := seed.AccountKey()
+	seed.Wipe()
+	if err != nil {
+		qb.DisplayNotificationf(errNotificationTitle, "%v", err)
+		return false
+	}
+	defer sensitive.WipeKey(pk)
 
-		qb.SetAccountStatus(true)
-	}()
+	displayedPhrase := ""
+	if showPhrase {
+		displayedPhrase = phrase
+	}
+	if !qb.saveKey(backupExisting, func(keyFile string) (ethcommon.Address, error) {
+		return ethcrypto.PubkeyToAddress(pk.PublicKey), keystore.SaveNew(keyFile, pk)
+	}, displayedPhrase) {
+		return false
+	}
+	qb.setPendingMnemonic(accounts.DefaultAccount, phrase)
+	return true
 }
 
-func (qb *QmlBridge) getFaucetNym(busyIndicator *core.QObject, mainLayoutObject *core.QObject) {
-	// for now just hardcode it
-	var nyms int64 = 50
+// setPendingMnemonic remembers the seed phrase of the account until its wallet gets opened,
+// wiping the one it replaces.
+func (qb *QmlBridge) setPendingMnemonic(name, phrase string) {
+	qb.pendingMnemonics[name].Wipe()
+	qb.pendingMnemonics[name] = sensitive.NewBytes([]byte(phrase))
+}
 
-	if qb.clientInstance == nil {
-		qb.DisplayNotificationf(errNotificationTitle, "nil client instance")
-		return
+// wipePendingMnemonics overwrites and forgets the seed phrases of all the accounts whose wallets were not opened yet.
+func (qb *QmlBridge) wipePendingMnemonics() {
+	for name, phrase := range qb.pendingMnemonics {
+		phrase.Wipe()
+		delete(qb.pendingMnemonics, name)
 	}
+}
 
-	go func(nyms int64) {
-		toggleIndicatorAndObjects(busyIndicator, []*core.QObject{mainLayoutObject}, true)
-		defer toggleIndicatorAndObjects(busyIndicator, []*core.QObject{mainLayoutObject}, false)
+// saveKey saves the key of the default account with the provided function. Whatever file is already present at its
+// location is only replaced if explicitly requested, in which case it is kept as a timestamped backup, together with
+// the wallet of the replaced key, so that the new key never inherits its long-term secret and credentials.
+// The new address and the phrase, if not empty, are then displayed until the user confirms backing them up.
+func (qb *QmlBridge) saveKey(backupExisting bool, save func(keyFile string) (ethcommon.Address, error), phrase string) bool {
+	if qb.cfg == nil {
+		qb.DisplayNotificationf(errNotificationTitle, "no config loaded")
+		return false
+	}
+	keyFile := qb.cfg.Nym.AccountKeysFile
+	walletFile := keyFile + wallet.WalletFileSuffix
 
-		ctx := context.TODO()
-		erc20Hash, etherHash, err := qb.clientInstance.MakeFaucetRequest(ctx, nyms)
-		if err != nil {
-			qb.DisplayNotificationf(errNotificationTitle, "could not send request to the faucet: %v", err)
-			return
+	if qb.accounts != nil {
+		if _, loaded := qb.accounts.LoadedWallet(accounts.DefaultAccount); loaded {
+			qb.DisplayNotificationf(errNotificationTitle, "the key of the default account can't be replaced while its wallet is unlocked")
+			return false
 		}
+	}
 
-		successERC20, err := qb.clientInstance.WaitForEthereumTxToResolve(ctx, erc20Hash)
-		if err != nil {
-			qb.DisplayNotificationf(errNotificationTitle, "could not receive ERC20 Nym: %v", err)
-			return
+	var existing []string
+	for _, file := range []string{keyFile, walletFile} {
+		if _, err := os.Lstat(file); err == nil {
+			existing = append(existing, file)
 		}
+	}
+	if len(existing) > 0 && !backupExisting {
+		qb.DisplayNotificationf(errNotificationTitle, "%v already exists and will not be overwritten", existing[0])
+		return false
+	}
 
-		successEther, err := qb.clientInstance.WaitForEthereumTxToResolve(ctx, etherHash)
+	// maps the moved files to their backups
+	backups := make(map[string]string)
+	restore := func(err error) error {
+		for file, backup := range backups {
+			if restoreErr := os.Rename(backup, file); restoreErr != nil {
+				err = fmt.Errorf("%v (and the previous %v remains at %v)", err, file, backup)
+			}
+		}
+		return err
+	}
+	for _, file := range existing {
+		backup, err := keystore.Backup(file)
 		if err != nil {
-			qb.DisplayNotificationf(errNotificationTitle, "could not receive Ether: %v", err)
-			return
+			if err = restore(err); len(backups) > 0 {
+				qb.DisplayNotificationf(critNotificationTitle, "%v", err)
+			} else {
+				qb.DisplayNotificationf(errNotificationTitle, "%v", err)
+			}
+			return false
 		}
+		backups[file] = backup
+	}
+	backup := backups[keyFile]
 
-		if successERC20 && successEther {
-			qb.updateBalances()
-			qb.DisplayNotificationf(infoNotificationTitle, "Received %v Nym from the faucet (+ some Ether for transaction fees) from the faucet!", nyms)
-		} else {
-			qb.DisplayNotificationf(warnNotificationTitle, "unknown error when trying to receive funds from the faucet")
+	address, err := save(keyFile)
+	if err != nil {
+		// do not leave the user without any key
+		title := errNotificationTitle
+		if restoreErr := restore(err); restoreErr != err {
+			err = restoreErr
+			title = critNotificationTitle
 		}
-		qb.ResetWaitingForEthereumLabel()
-	}(nyms)
+		qb.DisplayNotificationf(title, "%v", err)
+		return false
+	}
+
+	log.Info("account key saved", "keyfile", keyFile, "address", address.Hex(), "backup", backup, "walletbackup", backups[walletFile])
+	encrypted, _ := keystore.IsEncrypted(keyFile)
+	configBridge.SetAddress(address.Hex())
+	configBridge.SetKeyEncrypted(encrypted)
+
+	qb.keyBackupPending = true
+	qb.ShowKeyBackupDialog(address.Hex(), keyFile, backup, phrase)
+	return true
 }
 
-func (qb *QmlBridge) randomizeCredential(seqString string) string {
-	cred, ok := credentialMap[seqString]
-	if !ok {
-		qb.DisplayNotificationf(errNotificationTitle, "no credential exists for that sequence number (%v)", seqString)
-		return ""
-	}
+func (qb *QmlBridge) confirmKeyBackup() {
+	qb.keyBackupPending = false
+}
 
-	rcred := qb.clientInstance.ForceReRandomizeCredential(cred.credential)
-	if rcred != nil {
-		// it should ALWAYS be not nil, it's just a sanity check
-		credentialMap[seqString].credential = rcred
-	}
+func (qb *QmlBridge) checkIfAccountExists() bool {
+	return qb.session.AccountExists()
+}
 
-	rCredBytes, err := rcred.MarshalBinary()
-	if err != nil {
-		qb.DisplayNotificationf(errNotificationTitle, "could not marshal randomized credential: %v", err)
-		return ""
-	}
+func (qb *QmlBridge) registerAccount() int {
+	return qb.session.RegisterAccount()
+}
 
-	return base64.StdEncoding.EncodeToString(rCredBytes)
+func (qb *QmlBridge) getFaucetNym() int {
+	return qb.session.GetFaucetNym()
+}
+
+func (qb *QmlBridge) randomizeCredential(seqString string) string {
+	return qb.session.RandomizeCredential(seqString)
+}
+
+// shutdown wipes the secrets of all the wallets before the application exits.
+func (qb *QmlBridge) shutdown() {
+	qb.idleTimer.Stop()
+	qb.session.Lock()
+	qb.wipePendingMnemonics()
+	if qb.accounts != nil {
+		qb.accounts.WipeWallets()
+	}
 }
 
 // this function will be automatically called, when you use the `NewQmlBridge` function
 func (qb *QmlBridge) init() {
 	// TODO: perhaps create client instance here?
-
+	// the bridge is created on the main thread, hence so is the dispatcher
+	qb.dispatcher = NewDispatcher(nil)
+	qb.jobManager = jobs.NewManager(maxConcurrentJobs, maxFinishedJobs)
+	qb.notifications = notifications.NewCenter()
+	qb.session = session.New(qb.jobManager, qb.notifications, session.Hooks{
+		Notified:         qb.notified,
+		EthereumWaitOver: func() { qb.dispatcher.Run(qb.ResetWaitingForEthereumLabel) },
+	})
+	qb.pendingMnemonics = make(map[string]*sensitive.Bytes)
+	go qb.handleJobUpdates(qb.jobManager.Updates())
+	qb.SetOperationTimeout(int(wallet.DefaultOperationTimeout / time.Second))
+	qb.ConnectOperationTimeoutChanged(func(timeout int) {
+		qb.session.SetOperationTimeout(time.Duration(timeout) * time.Second)
+	})
+	qb.initAutoLock()
 }
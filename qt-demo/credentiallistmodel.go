@@ -16,6 +16,7 @@
 package main
 
 import (
+	"github.com/nymtech/qt-validator-client-demo/internal/wallet"
 	"github.com/therecipe/qt/core"
 )
 
@@ -28,19 +29,26 @@ const (
 	CredentialRole = int(core.Qt__UserRole) + 1<<iota
 	SequenceRole
 	ValueRole
+	SpentRole
+	StateRole
 )
 
 type CredentialListItem struct {
 	sequence   string
 	credential string
 	value      uint64
+	state      wallet.CredentialState
 }
 
+// CredentialListModel lists the credentials of the wallet, they are identified by their sequence numbers.
 type CredentialListModel struct {
 	core.QAbstractListModel
 
 	_         func()                        `constructor:"init"`
-	_         func()                        `signal:"remove,auto"`
+	_         func(sequence string)         `signal:"removeBySequence,auto"`
+	_         func(sequence string)         `signal:"markSpent,auto"`
+	_         func(sequence, state string)  `signal:"setState,auto"`
+	_         func()                        `signal:"clear,auto"`
 	_         func(item CredentialListItem) `signal:"addItem,auto"`
 	modelData []CredentialListItem
 }
@@ -56,6 +64,8 @@ func (m *CredentialListModel) roleNames() map[int]*core.QByteArray {
 		CredentialRole: core.NewQByteArray2("Credential", -1),
 		SequenceRole:   core.NewQByteArray2("Sequence", -1),
 		ValueRole:      core.NewQByteArray2("Value", -1),
+		SpentRole:      core.NewQByteArray2("Spent", -1),
+		StateRole:      core.NewQByteArray2("State", -1),
 	}
 }
 
@@ -72,20 +82,61 @@ func (m *CredentialListModel) data(index *core.QModelIndex, role int) *core.QVar
 		return core.NewQVariant1(item.sequence)
 	case ValueRole:
 		return core.NewQVariant1(item.value)
+	case SpentRole:
+		return core.NewQVariant1(item.state == wallet.Spent)
+	case StateRole:
+		return core.NewQVariant1(string(item.state))
 	}
 	return core.NewQVariant()
 }
 
-func (m *CredentialListModel) remove() {
-	if len(m.modelData) == 0 {
+// indexOf returns the row of the credential with the given sequence number or -1 if it is not displayed.
+func (m *CredentialListModel) indexOf(sequence string) int {
+	for i := range m.modelData {
+		if m.modelData[i].sequence == sequence {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *CredentialListModel) removeBySequence(sequence string) {
+	i := m.indexOf(sequence)
+	if i < 0 {
 		return
 	}
-	m.BeginRemoveRows(core.NewQModelIndex(), len(m.modelData)-1, len(m.modelData)-1)
-	m.modelData = m.modelData[:len(m.modelData)-1]
+	m.BeginRemoveRows(core.NewQModelIndex(), i, i)
+	m.modelData = append(m.modelData[:i], m.modelData[i+1:]...)
 	m.EndRemoveRows()
 }
 
+func (m *CredentialListModel) markSpent(sequence string) {
+	m.setState(sequence, string(wallet.Spent))
+}
+
+func (m *CredentialListModel) setState(sequence, state string) {
+	i := m.indexOf(sequence)
+	if i < 0 {
+		return
+	}
+	m.modelData[i].state = wallet.CredentialState(state)
+	m.DataChanged(m.Index(i, 0, core.NewQModelIndex()), m.Index(i, 0, core.NewQModelIndex()), []int{SpentRole, StateRole})
+}
+
+func (m *CredentialListModel) clear() {
+	m.BeginResetModel()
+	m.modelData = nil
+	m.EndResetModel()
+}
+
+// addItem appends the credential, unless it is already displayed, in which case it is replaced.
 func (m *CredentialListModel) addItem(item CredentialListItem) {
+	if i := m.indexOf(item.sequence); i >= 0 {
+		m.modelData[i] = item
+		m.DataChanged(m.Index(i, 0, core.NewQModelIndex()), m.Index(i, 0, core.NewQModelIndex()), []int{})
+		return
+	}
+
 	m.BeginInsertRows(core.NewQModelIndex(), len(m.modelData), len(m.modelData))
 	m.modelData = append(m.modelData, item)
 	m.EndInsertRows()
@@ -0,0 +1,59 @@
+// dispatcher.go - executing functions on the Qt main thread
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package main
+
+import (
+	"sync"
+
+	"github.com/therecipe/qt/core"
+)
+
+// Dispatcher marshals functions onto the thread it was created on, which must be the Qt main thread.
+// The qml models and properties must not be touched from any other thread, so whatever the worker goroutines
+// want to change in the gui has to go through it.
+//
+//go:generate qtmoc
+type Dispatcher struct {
+	core.QObject
+
+	queueLock sync.Mutex
+	queue     []func()
+
+	// emitted from any goroutine, the connection is queued as the dispatcher lives on the main thread
+	_ func() `signal:"wake,auto"`
+}
+
+// Run schedules f for execution on the main thread. It never blocks and can be called from any goroutine.
+// Functions are executed in the order in which they were scheduled.
+func (d *Dispatcher) Run(f func()) {
+	d.queueLock.Lock()
+	d.queue = append(d.queue, f)
+	d.queueLock.Unlock()
+
+	d.Wake()
+}
+
+// wake is executed on the main thread and runs all the pending functions.
+func (d *Dispatcher) wake() {
+	d.queueLock.Lock()
+	pending := d.queue
+	d.queue = nil
+	d.queueLock.Unlock()
+
+	for _, f := range pending {
+		f()
+	}
+}
@@ -0,0 +1,128 @@
+// joblistmodel.go
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package main
+
+import (
+	"github.com/therecipe/qt/core"
+)
+
+func init() {
+	JobListModel_QmlRegisterType2("CustomQmlTypes", 1, 0, "JobListModel")
+}
+
+// how many finished jobs are kept in the list
+const maxFinishedJobListItems = 20
+
+const (
+	JobIDRole = int(core.Qt__UserRole) + 1<<iota
+	JobNameRole
+	JobStateRole
+	JobStageRole
+	JobErrorRole
+	JobActiveRole
+)
+
+type JobListItem struct {
+	id     int
+	name   string
+	state  string
+	stage  string
+	err    string
+	active bool
+}
+
+type JobListModel struct {
+	core.QAbstractListModel
+
+	_         func()                 `constructor:"init"`
+	_         func(item JobListItem) `signal:"updateItem,auto"`
+	modelData []JobListItem
+}
+
+func (m *JobListModel) init() {
+	m.ConnectRoleNames(m.roleNames)
+	m.ConnectRowCount(m.rowCount)
+	m.ConnectData(m.data)
+}
+
+func (m *JobListModel) roleNames() map[int]*core.QByteArray {
+	return map[int]*core.QByteArray{
+		JobIDRole:     core.NewQByteArray2("JobID", -1),
+		JobNameRole:   core.NewQByteArray2("Name", -1),
+		JobStateRole:  core.NewQByteArray2("State", -1),
+		JobStageRole:  core.NewQByteArray2("Stage", -1),
+		JobErrorRole:  core.NewQByteArray2("Error", -1),
+		JobActiveRole: core.NewQByteArray2("Active", -1),
+	}
+}
+
+func (m *JobListModel) rowCount(*core.QModelIndex) int {
+	return len(m.modelData)
+}
+
+func (m *JobListModel) data(index *core.QModelIndex, role int) *core.QVariant {
+	item := m.modelData[index.Row()]
+	switch role {
+	case JobIDRole:
+		return core.NewQVariant1(item.id)
+	case JobNameRole:
+		return core.NewQVariant1(item.name)
+	case JobStateRole:
+		return core.NewQVariant1(item.state)
+	case JobStageRole:
+		return core.NewQVariant1(item.stage)
+	case JobErrorRole:
+		return core.NewQVariant1(item.err)
+	case JobActiveRole:
+		return core.NewQVariant1(item.active)
+	}
+	return core.NewQVariant()
+}
+
+// updateItem replaces the item of the same job or, if it is a new job, inserts it at the top of the list.
+func (m *JobListModel) updateItem(item JobListItem) {
+	for i := range m.modelData {
+		if m.modelData[i].id == item.id {
+			m.modelData[i] = item
+			m.DataChanged(m.Index(i, 0, core.NewQModelIndex()), m.Index(i, 0, core.NewQModelIndex()), []int{})
+			if !item.active {
+				m.pruneFinished()
+			}
+			return
+		}
+	}
+
+	m.BeginInsertRows(core.NewQModelIndex(), 0, 0)
+	m.modelData = append([]JobListItem{item}, m.modelData...)
+	m.EndInsertRows()
+}
+
+// pruneFinished removes the oldest finished jobs above the limit.
+func (m *JobListModel) pruneFinished() {
+	finished := 0
+	for i := 0; i < len(m.modelData); i++ {
+		if m.modelData[i].active {
+			continue
+		}
+		finished++
+		if finished > maxFinishedJobListItems {
+			m.BeginRemoveRows(core.NewQModelIndex(), i, i)
+			m.modelData = append(m.modelData[:i], m.modelData[i+1:]...)
+			m.EndRemoveRows()
+			i--
+		}
+	}
+}
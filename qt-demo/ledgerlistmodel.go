@@ -0,0 +1,160 @@
+// ledgerlistmodel.go - qml model of the transaction history
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/nymtech/qt-validator-client-demo/internal/wallet"
+	"github.com/therecipe/qt/core"
+)
+
+func init() {
+	LedgerListModel_QmlRegisterType2("CustomQmlTypes", 1, 0, "LedgerListModel")
+}
+
+const (
+	// format of the dates used by the filter
+	ledgerDateFormat = "2006-01-02"
+	// format in which the time of the operations is displayed
+	ledgerTimeFormat = "2006-01-02 15:04:05"
+)
+
+const (
+	LedgerTypeRole = int(core.Qt__UserRole) + 1<<iota
+	LedgerTimeRole
+	LedgerAmountRole
+	LedgerEthereumTxsRole
+	LedgerTendermintResultRole
+	LedgerDetailsRole
+	LedgerSuccessRole
+	LedgerErrorRole
+	LedgerErrorCategoryRole
+)
+
+type LedgerListItem struct {
+	entry wallet.LedgerEntry
+}
+
+// LedgerListModel presents the ledger entries matching the current filter, the most recent ones first.
+type LedgerListModel struct {
+	core.QAbstractListModel
+
+	_ func()                    `constructor:"init"`
+	_ func(item LedgerListItem) `signal:"addItem,auto"`
+	_ func()                    `signal:"clear,auto"`
+	// empty arguments do not restrict the entries, dates are in the YYYY-MM-DD format
+	_ func(opType, from, to string) `signal:"setFilter,auto"`
+
+	// all the entries, the most recent ones first
+	allData   []LedgerListItem
+	modelData []LedgerListItem
+	filter    wallet.LedgerFilter
+}
+
+func (m *LedgerListModel) init() {
+	m.ConnectRoleNames(m.roleNames)
+	m.ConnectRowCount(m.rowCount)
+	m.ConnectData(m.data)
+}
+
+func (m *LedgerListModel) roleNames() map[int]*core.QByteArray {
+	return map[int]*core.QByteArray{
+		LedgerTypeRole:             core.NewQByteArray2("Type", -1),
+		LedgerTimeRole:             core.NewQByteArray2("Time", -1),
+		LedgerAmountRole:           core.NewQByteArray2("Amount", -1),
+		LedgerEthereumTxsRole:      core.NewQByteArray2("EthereumTxs", -1),
+		LedgerTendermintResultRole: core.NewQByteArray2("TendermintResult", -1),
+		LedgerDetailsRole:          core.NewQByteArray2("Details", -1),
+		LedgerSuccessRole:          core.NewQByteArray2("Success", -1),
+		LedgerErrorRole:            core.NewQByteArray2("Error", -1),
+		LedgerErrorCategoryRole:    core.NewQByteArray2("ErrorCategory", -1),
+	}
+}
+
+func (m *LedgerListModel) rowCount(*core.QModelIndex) int {
+	return len(m.modelData)
+}
+
+func (m *LedgerListModel) data(index *core.QModelIndex, role int) *core.QVariant {
+	entry := m.modelData[index.Row()].entry
+	switch role {
+	case LedgerTypeRole:
+		return core.NewQVariant1(string(entry.Type))
+	case LedgerTimeRole:
+		return core.NewQVariant1(entry.Time.Format(ledgerTimeFormat))
+	case LedgerAmountRole:
+		return core.NewQVariant1(entry.Amount)
+	case LedgerEthereumTxsRole:
+		return core.NewQVariant1(strings.Join(entry.EthereumTxs, ", "))
+	case LedgerTendermintResultRole:
+		return core.NewQVariant1(entry.TendermintResult)
+	case LedgerDetailsRole:
+		return core.NewQVariant1(entry.Details)
+	case LedgerSuccessRole:
+		return core.NewQVariant1(entry.Success)
+	case LedgerErrorRole:
+		return core.NewQVariant1(entry.Error)
+	case LedgerErrorCategoryRole:
+		return core.NewQVariant1(string(entry.ErrorCategory))
+	}
+	return core.NewQVariant()
+}
+
+func (m *LedgerListModel) addItem(item LedgerListItem) {
+	m.allData = append([]LedgerListItem{item}, m.allData...)
+	if !m.filter.Matches(item.entry) {
+		return
+	}
+
+	m.BeginInsertRows(core.NewQModelIndex(), 0, 0)
+	m.modelData = append([]LedgerListItem{item}, m.modelData...)
+	m.EndInsertRows()
+}
+
+func (m *LedgerListModel) clear() {
+	m.BeginResetModel()
+	m.allData = nil
+	m.modelData = nil
+	m.EndResetModel()
+}
+
+// setFilter restricts the displayed entries to the ones of the given type performed between the dates (inclusive).
+// Dates that can't be parsed are ignored.
+func (m *LedgerListModel) setFilter(opType, from, to string) {
+	var filter wallet.LedgerFilter
+	if opType != "" {
+		filter.Types = []wallet.OperationType{wallet.OperationType(opType)}
+	}
+	if fromDate, err := time.ParseInLocation(ledgerDateFormat, from, time.Local); err == nil {
+		filter.From = fromDate
+	}
+	if toDate, err := time.ParseInLocation(ledgerDateFormat, to, time.Local); err == nil {
+		// include the whole day
+		filter.To = toDate.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	m.filter = filter
+
+	m.BeginResetModel()
+	m.modelData = m.modelData[:0]
+	for _, item := range m.allData {
+		if filter.Matches(item.entry) {
+			m.modelData = append(m.modelData, item)
+		}
+	}
+	m.EndResetModel()
+}
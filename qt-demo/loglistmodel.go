@@ -0,0 +1,110 @@
+// loglistmodel.go - qml model of the most recent log records
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package main
+
+import (
+	"github.com/nymtech/qt-validator-client-demo/internal/logging"
+	"github.com/therecipe/qt/core"
+)
+
+func init() {
+	LogListModel_QmlRegisterType2("CustomQmlTypes", 1, 0, "LogListModel")
+}
+
+const (
+	// how many records are kept in the list, the oldest ones are dropped first
+	maxLogListItems = 500
+
+	logTimeFormat = "15:04:05.000"
+)
+
+const (
+	LogTimeRole = int(core.Qt__UserRole) + 1<<iota
+	LogLevelRole
+	LogModuleRole
+	LogMessageRole
+	LogFieldsRole
+)
+
+type LogListItem struct {
+	record logging.Record
+}
+
+// LogListModel tails the log, the most recent records last.
+type LogListModel struct {
+	core.QAbstractListModel
+
+	_ func()                 `constructor:"init"`
+	_ func(item LogListItem) `signal:"addItem,auto"`
+	_ func()                 `signal:"clear,auto"`
+
+	modelData []LogListItem
+}
+
+func (m *LogListModel) init() {
+	m.ConnectRoleNames(m.roleNames)
+	m.ConnectRowCount(m.rowCount)
+	m.ConnectData(m.data)
+}
+
+func (m *LogListModel) roleNames() map[int]*core.QByteArray {
+	return map[int]*core.QByteArray{
+		LogTimeRole:    core.NewQByteArray2("Time", -1),
+		LogLevelRole:   core.NewQByteArray2("Level", -1),
+		LogModuleRole:  core.NewQByteArray2("Module", -1),
+		LogMessageRole: core.NewQByteArray2("Message", -1),
+		LogFieldsRole:  core.NewQByteArray2("Fields", -1),
+	}
+}
+
+func (m *LogListModel) rowCount(*core.QModelIndex) int {
+	return len(m.modelData)
+}
+
+func (m *LogListModel) data(index *core.QModelIndex, role int) *core.QVariant {
+	rec := m.modelData[index.Row()].record
+	switch role {
+	case LogTimeRole:
+		return core.NewQVariant1(rec.Time.Format(logTimeFormat))
+	case LogLevelRole:
+		return core.NewQVariant1(rec.Level.String())
+	case LogModuleRole:
+		return core.NewQVariant1(rec.Module)
+	case LogMessageRole:
+		return core.NewQVariant1(rec.Message)
+	case LogFieldsRole:
+		return core.NewQVariant1(rec.Fields)
+	}
+	return core.NewQVariant()
+}
+
+func (m *LogListModel) addItem(item LogListItem) {
+	if len(m.modelData) >= maxLogListItems {
+		m.BeginRemoveRows(core.NewQModelIndex(), 0, 0)
+		m.modelData = m.modelData[1:]
+		m.EndRemoveRows()
+	}
+
+	m.BeginInsertRows(core.NewQModelIndex(), len(m.modelData), len(m.modelData))
+	m.modelData = append(m.modelData, item)
+	m.EndInsertRows()
+}
+
+func (m *LogListModel) clear() {
+	m.BeginResetModel()
+	m.modelData = nil
+	m.EndResetModel()
+}
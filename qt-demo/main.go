@@ -27,8 +27,6 @@ import (
 var (
 	qmlBridge    *QmlBridge
 	configBridge *ConfigBridge
-
-	credentialMap map[string]*IssuedCredential
 )
 
 func main() {
@@ -38,7 +36,7 @@ func main() {
 	core.QCoreApplication_SetAttribute(core.Qt__AA_EnableHighDpiScaling, true)
 
 	// needs to be called once before you can start using QML
-	gui.NewQGuiApplication(len(os.Args), os.Args)
+	app := gui.NewQGuiApplication(len(os.Args), os.Args)
 	// widgets.NewQApplication(len(os.Args), os.Args)
 	gui.QGuiApplication_SetApplicationDisplayName("Nym Demo")
 
@@ -54,13 +52,12 @@ func main() {
 	// Create connector
 	qmlBridge = NewQmlBridge(nil)
 	configBridge = NewConfigBridge(nil)
+	installActivityFilter(app, qmlBridge)
 
 	// Set up the connector
 	engine.RootContext().SetContextProperty("QmlBridge", qmlBridge)
 	engine.RootContext().SetContextProperty("ConfigBridge", configBridge)
 
-	credentialMap = make(map[string]*IssuedCredential)
-
 	// load the embedded qml file
 	// created by either qtrcc or qtdeploy
 	engine.Load(core.NewQUrl3("qrc:/qml/main.qml", 0))
@@ -71,4 +68,6 @@ func main() {
 	// and block until app.Exit() is called
 	// or the window is closed by the user
 	gui.QGuiApplication_Exec()
+
+	qmlBridge.shutdown()
 }
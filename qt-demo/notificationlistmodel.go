@@ -0,0 +1,122 @@
+// notificationlistmodel.go - qml model of the notifications that were not yet dismissed
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package main
+
+import (
+	"github.com/nymtech/qt-validator-client-demo/internal/notifications"
+	"github.com/therecipe/qt/core"
+)
+
+func init() {
+	NotificationListModel_QmlRegisterType2("CustomQmlTypes", 1, 0, "NotificationListModel")
+}
+
+const notificationTimeFormat = "2006-01-02 15:04:05"
+
+const (
+	NotificationIDRole = int(core.Qt__UserRole) + 1<<iota
+	NotificationSeverityRole
+	NotificationTitleRole
+	NotificationMessageRole
+	NotificationTimeRole
+	NotificationCountRole
+	NotificationCategoryRole
+)
+
+type NotificationListItem struct {
+	notification notifications.Notification
+}
+
+// NotificationListModel lists the notifications, the most recent ones first.
+type NotificationListModel struct {
+	core.QAbstractListModel
+
+	_ func()                          `constructor:"init"`
+	_ func(item NotificationListItem) `signal:"updateItem,auto"`
+	_ func(id int)                    `signal:"removeItem,auto"`
+	_ func()                          `signal:"clear,auto"`
+
+	modelData []NotificationListItem
+}
+
+func (m *NotificationListModel) init() {
+	m.ConnectRoleNames(m.roleNames)
+	m.ConnectRowCount(m.rowCount)
+	m.ConnectData(m.data)
+}
+
+func (m *NotificationListModel) roleNames() map[int]*core.QByteArray {
+	return map[int]*core.QByteArray{
+		NotificationIDRole:       core.NewQByteArray2("NotificationID", -1),
+		NotificationSeverityRole: core.NewQByteArray2("Severity", -1),
+		NotificationTitleRole:    core.NewQByteArray2("Title", -1),
+		NotificationMessageRole:  core.NewQByteArray2("Message", -1),
+		NotificationTimeRole:     core.NewQByteArray2("Time", -1),
+		NotificationCountRole:    core.NewQByteArray2("Count", -1),
+		NotificationCategoryRole: core.NewQByteArray2("Category", -1),
+	}
+}
+
+func (m *NotificationListModel) rowCount(*core.QModelIndex) int {
+	return len(m.modelData)
+}
+
+func (m *NotificationListModel) data(index *core.QModelIndex, role int) *core.QVariant {
+	n := m.modelData[index.Row()].notification
+	switch role {
+	case NotificationIDRole:
+		return core.NewQVariant1(n.ID)
+	case NotificationSeverityRole:
+		return core.NewQVariant1(n.Severity.String())
+	case NotificationTitleRole:
+		return core.NewQVariant1(n.Title)
+	case NotificationMessageRole:
+		return core.NewQVariant1(n.Message)
+	case NotificationTimeRole:
+		return core.NewQVariant1(n.Last.Format(notificationTimeFormat))
+	case NotificationCountRole:
+		return core.NewQVariant1(n.Count)
+	case NotificationCategoryRole:
+		return core.NewQVariant1(n.Category)
+	}
+	return core.NewQVariant()
+}
+
+// updateItem moves the updated notification to the top of the list, inserting it if it is a new one.
+func (m *NotificationListModel) updateItem(item NotificationListItem) {
+	m.removeItem(item.notification.ID)
+
+	m.BeginInsertRows(core.NewQModelIndex(), 0, 0)
+	m.modelData = append([]NotificationListItem{item}, m.modelData...)
+	m.EndInsertRows()
+}
+
+func (m *NotificationListModel) removeItem(id int) {
+	for i := range m.modelData {
+		if m.modelData[i].notification.ID == id {
+			m.BeginRemoveRows(core.NewQModelIndex(), i, i)
+			m.modelData = append(m.modelData[:i], m.modelData[i+1:]...)
+			m.EndRemoveRows()
+			return
+		}
+	}
+}
+
+func (m *NotificationListModel) clear() {
+	m.BeginResetModel()
+	m.modelData = nil
+	m.EndResetModel()
+}
@@ -0,0 +1,187 @@
+// AccountSelector.qml - switching between multiple accounts
+// Copyright (C) 2018-2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+import QtQuick 2.12
+import QtQuick.Controls 2.5
+import QtQuick.Layouts 1.12
+import QtQuick.Controls.Material 2.12
+
+RowLayout {
+    id: accountSelector
+    spacing: 15
+    Layout.alignment: Qt.AlignHCenter | Qt.AlignVCenter
+
+    property string activeAccount: ""
+
+    function switchTo(name) {
+        if (name == activeAccount) {
+            return
+        }
+        if (QmlBridge.isAccountOpen(name)) {
+            QmlBridge.switchAccount(name, "")
+        } else {
+            accountPassphraseDialog.accountName = name
+            accountPassphraseDialog.create = !QmlBridge.walletExists(name)
+            accountPassphraseDialog.open()
+        }
+    }
+
+    Label {
+        text: qsTr("Account:")
+        horizontalAlignment: Text.AlignRight
+        font.weight: Font.DemiBold
+    }
+
+    ComboBox {
+        id: accountComboBox
+        Layout.preferredWidth: 200
+        onActivated: switchTo(model[index])
+    }
+
+    ToolSeparator {
+        opacity: 0
+    }
+
+    TextField {
+        id: newAccountName
+        Layout.preferredWidth: 150
+        placeholderText: qsTr("new account name")
+        selectByMouse: true
+    }
+
+    Button {
+        text: qsTr("Add account")
+        enabled: newAccountName.text != ""
+        onClicked: {
+            if (QmlBridge.addAccount(newAccountName.text)) {
+                newAccountName.clear()
+            }
+        }
+    }
+
+    Dialog {
+        id: accountPassphraseDialog
+        parent: ApplicationWindow.contentItem
+        anchors.centerIn: ApplicationWindow.contentItem
+
+        width: Math.min(ApplicationWindow.contentItem.width * 2/3, 800)
+
+        property string accountName: ""
+        // set if the wallet of the account does not exist yet
+        property bool create: false
+
+        modal: true
+
+        closePolicy: Popup.CloseOnEscape
+        title: (create ? qsTr("Create wallet of account ") : qsTr("Unlock wallet of account ")) + accountName
+
+        ColumnLayout {
+            width: accountPassphraseDialog.availableWidth
+
+            Label {
+                Layout.fillWidth: true
+                wrapMode: Label.WordWrap
+                text: accountPassphraseDialog.create
+                    ? qsTr("The credential wallet of the account does not exist yet. Please choose the passphrase it will be encrypted with.\nThe passphrase can't be recovered - if you lose it, all the credentials in the wallet will be lost as well.")
+                    : qsTr("Please enter the passphrase protecting the credential wallet of the account.")
+            }
+
+            TextField {
+                id: accountPassphraseField
+                Layout.fillWidth: true
+                echoMode: TextInput.Password
+                placeholderText: qsTr("passphrase")
+                onAccepted: {
+                    if (accountPassphraseDialog.create) {
+                        accountPassphraseConfirmField.forceActiveFocus()
+                    } else {
+                        accountPassphraseDialog.accept()
+                    }
+                }
+            }
+
+            TextField {
+                id: accountPassphraseConfirmField
+                visible: accountPassphraseDialog.create
+                Layout.fillWidth: true
+                echoMode: TextInput.Password
+                placeholderText: qsTr("repeat the passphrase")
+                onAccepted: {
+                    if (accountPassphraseOkBtn.enabled) {
+                        accountPassphraseDialog.accept()
+                    }
+                }
+            }
+
+            Label {
+                visible: accountPassphraseDialog.create && accountPassphraseConfirmField.text != "" && accountPassphraseConfirmField.text != accountPassphraseField.text
+                text: qsTr("The passphrases do not match")
+                color: "orangered"
+            }
+
+            RowLayout {
+                Layout.alignment: Qt.AlignRight
+
+                Button {
+                    text: qsTr("Cancel")
+                    onClicked: accountPassphraseDialog.reject()
+                }
+
+                Button {
+                    id: accountPassphraseOkBtn
+                    text: accountPassphraseDialog.create ? qsTr("Create") : qsTr("Unlock")
+                    enabled: !accountPassphraseDialog.create || (accountPassphraseField.text != "" && accountPassphraseField.text == accountPassphraseConfirmField.text)
+                    onClicked: accountPassphraseDialog.accept()
+                }
+            }
+        }
+
+        onAccepted: {
+            var opened = create
+                ? QmlBridge.createWallet(accountName, accountPassphraseField.text, accountPassphraseConfirmField.text)
+                : QmlBridge.switchAccount(accountName, accountPassphraseField.text)
+            if (!opened) {
+                accountComboBox.currentIndex = accountComboBox.find(activeAccount)
+            }
+            clearPassphrases()
+        }
+
+        onRejected: {
+            clearPassphrases()
+            // go back to the account that is still active
+            accountComboBox.currentIndex = accountComboBox.find(activeAccount)
+        }
+
+        function clearPassphrases() {
+            accountPassphraseField.clear()
+            accountPassphraseConfirmField.clear()
+        }
+    }
+
+    Connections {
+        target: QmlBridge
+
+        onPopulateAccountComboBox: {
+            accountComboBox.model = names
+            accountComboBox.currentIndex = accountComboBox.find(activeAccount)
+        }
+
+        onAccountSwitched: {
+            activeAccount = name
+            accountComboBox.currentIndex = accountComboBox.find(name)
+        }
+    }
+}
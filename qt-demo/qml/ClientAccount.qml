@@ -18,6 +18,7 @@ import QtQuick 2.12
 import QtQuick.Controls 2.5
 import QtQuick.Layouts 1.12
 import QtQuick.Controls.Material 2.12
+import Qt.labs.platform 1.1 as QtLabs
 import CustomQmlTypes 1.0
 
 ColumnLayout {
@@ -25,6 +26,19 @@ ColumnLayout {
     spacing: 20
     Layout.fillWidth: true
 
+    // busy indicators of all the actions, each one is running while the last job it tracks is active
+    property var jobIndicators: [registerIndicator, faucetIndicator, balanceUpdateIndicator, sendToPipeAccountIndicator, getCredentialIndicator, getCredentialsForAmountIndicator, spendCredentialIndicator]
+
+    function trackJob(indicator, jobId) {
+        if (jobId >= 0) {
+            indicator.jobId = jobId
+        }
+    }
+
+    AccountSelector {
+        id: accountSelector
+    }
+
     ColumnLayout {
         id: columnLayout
         width: 100
@@ -59,12 +73,13 @@ ColumnLayout {
                 id: registerButton
                 text: qsTr("Register account")
                 enabled: !accountStatusLabel.accountExists
-                onClicked: QmlBridge.registerAccount(registerIndicator, mainColumn)
+                onClicked: trackJob(registerIndicator, QmlBridge.registerAccount())
             }
 
             BusyIndicator {
                 id: registerIndicator
-                running: false
+                property int jobId: -1
+                running: jobId >= 0
                 width: 60
                 Layout.preferredHeight: 50
                 Layout.preferredWidth: 50
@@ -76,14 +91,15 @@ ColumnLayout {
                 text: qsTr("Request 50 ERC20 Nym from faucet")
                 onClicked: {
                     waitingForEthereumLabel.opacity = 1
-                    QmlBridge.getFaucetNym(faucetIndicator, mainColumn)
+                    trackJob(faucetIndicator, QmlBridge.getFaucetNym())
                 }
 
             }
 
             BusyIndicator {
                 id: faucetIndicator
-                running: false
+                property int jobId: -1
+                running: jobId >= 0
                 width: 60
                 Layout.preferredHeight: 50
                 Layout.preferredWidth: 50
@@ -170,17 +186,85 @@ ColumnLayout {
                 text: qsTr("Force update")
                 Layout.alignment: Qt.AlignHCenter | Qt.AlignVCenter
                 onClicked: {
-                    QmlBridge.forceUpdateBalances(balanceUpdateIndicator, mainColumn)
+                    trackJob(balanceUpdateIndicator, QmlBridge.forceUpdateBalances())
                 }
             }
 
             BusyIndicator {
                 id: balanceUpdateIndicator
-                running: false
+                property int jobId: -1
+                running: jobId >= 0
                 width: 60
                 Layout.preferredHeight: 50
                 Layout.preferredWidth: 50
             }
+
+            Label {
+                text: qsTr("Timeout (s):")
+                font.weight: Font.DemiBold
+            }
+
+            SpinBox {
+                id: operationTimeoutBox
+                from: 10
+                to: 3600
+                stepSize: 10
+                editable: true
+                value: QmlBridge.operationTimeout
+                onValueModified: QmlBridge.operationTimeout = value
+            }
+
+            Label {
+                text: qsTr("Auto-lock (min):")
+                font.weight: Font.DemiBold
+            }
+
+            SpinBox {
+                id: autoLockBox
+                from: 0
+                to: 240
+                editable: true
+                value: QmlBridge.autoLockMinutes
+                onValueModified: QmlBridge.autoLockMinutes = value
+            }
+
+            Button {
+                text: qsTr("Lock now")
+                Layout.alignment: Qt.AlignHCenter | Qt.AlignVCenter
+                onClicked: QmlBridge.lockWallet()
+            }
+
+            Button {
+                id: exportSecretBtn
+                text: qsTr("Export long-term secret")
+                Layout.alignment: Qt.AlignHCenter | Qt.AlignVCenter
+                onClicked: {
+                    var secret = QmlBridge.exportSecret()
+                    if (secret != "") {
+                        exportedSecretField.text = secret
+                        exportSecretDialog.open()
+                    }
+                }
+            }
+
+            Button {
+                text: qsTr("Encrypt account key")
+                visible: !ConfigBridge.keyEncrypted
+                Layout.alignment: Qt.AlignHCenter | Qt.AlignVCenter
+                onClicked: encryptKeyDialog.open()
+            }
+
+            Button {
+                text: qsTr("Change passphrase")
+                Layout.alignment: Qt.AlignHCenter | Qt.AlignVCenter
+                onClicked: changePassphraseDialog.open()
+            }
+
+            Button {
+                text: qsTr("Export backup")
+                Layout.alignment: Qt.AlignHCenter | Qt.AlignVCenter
+                onClicked: exportBackupFileDialog.open()
+            }
         }
     }
 
@@ -214,13 +298,14 @@ ColumnLayout {
             text: "Confirm"
             onClicked: {
                 waitingForEthereumLabel.opacity = 1
-                QmlBridge.sendToPipeAccount(sendToPipeAccountAmount.text, sendToPipeAccountIndicator, mainColumn)
+                trackJob(sendToPipeAccountIndicator, QmlBridge.sendToPipeAccount(sendToPipeAccountAmount.text))
             }
         }
 
         BusyIndicator {
             id: sendToPipeAccountIndicator
-            running: false
+            property int jobId: -1
+            running: jobId >= 0
             width: 60
             Layout.preferredHeight: 50
             Layout.preferredWidth: 50
@@ -253,7 +338,7 @@ ColumnLayout {
         // Button {
         //     text: "Confirm"
         //     onClicked: {
-        //         QmlBridge.redeemTokens(redeemTokensAmount.text, redeemTokensIndicator, mainColumn)
+        //         trackJob(redeemTokensIndicator, QmlBridge.redeemTokens(redeemTokensAmount.text))
         //     }
         // }
 
@@ -297,18 +382,59 @@ ColumnLayout {
             onActivated: displayText = model[index]
         }
 
+        SpinBox {
+            id: credentialCountBox
+            from: 1
+            to: 100
+            value: 1
+            editable: true
+            ToolTip.visible: hovered
+            ToolTip.text: qsTr("Number of credentials to obtain at once")
+        }
+
         Button {
             text: "Confirm"
             onClicked: {
                 if (credentialValueBox.displayText != credentialValueBox.defaultText) {
-                    QmlBridge.getCredential(credentialValueBox.currentText, getCredentialIndicator, mainColumn)
+                    if (credentialCountBox.value > 1) {
+                        trackJob(getCredentialIndicator, QmlBridge.getCredentialBatch(credentialValueBox.currentText, credentialCountBox.value))
+                    } else {
+                        trackJob(getCredentialIndicator, QmlBridge.getCredential(credentialValueBox.currentText))
+                    }
                 }
             }
         }
 
         BusyIndicator {
             id: getCredentialIndicator
-            running: false
+            property int jobId: -1
+            running: jobId >= 0
+            width: 60
+            Layout.preferredHeight: 50
+            Layout.preferredWidth: 50
+        }
+
+        ToolSeparator {
+            opacity: 0
+        }
+
+        TextField {
+            id: credentialAmountField
+            Layout.preferredWidth: 120
+            placeholderText: qsTr("any amount")
+            validator: IntValidator { bottom: 1 }
+        }
+
+        Button {
+            text: qsTr("Get for amount")
+            enabled: credentialAmountField.acceptableInput
+            onClicked: trackJob(getCredentialsForAmountIndicator, QmlBridge.getCredentialsForAmount(credentialAmountField.text))
+        }
+
+        BusyIndicator {
+            id: getCredentialsForAmountIndicator
+            property int jobId: -1
+            running: jobId >= 0
             width: 60
             Layout.preferredHeight: 50
             Layout.preferredWidth: 50
@@ -386,7 +512,8 @@ ColumnLayout {
                         property string displayCredential: credential.substr(0,12) + " ... " + credential.substr(-16)
                         property string displaySequence: sequence.substr(0,8) + " ... " + sequence.substr(-16)
                         property string value: Value
-                        property bool isSpent: false
+                        property bool isSpent: Spent
+                        property string credentialState: State
 
                         Row {
                             spacing: 5
@@ -402,8 +529,8 @@ ColumnLayout {
                             }
                             Label {
                                 font.weight: Font.Black
-                                text: isSpent ? qsTr("SPENT") : qsTr("NOT SPENT")
-                                color: isSpent ? "orangered" : "limegreen"
+                                text: credentialState == "pending" ? qsTr("SPENDING") : isSpent ? qsTr("SPENT") : qsTr("NOT SPENT")
+                                color: credentialState == "pending" ? "orange" : isSpent ? "orangered" : "limegreen"
                             }
 
                         }
@@ -512,23 +639,399 @@ ColumnLayout {
             opacity: 0
         }
 
+        CheckBox {
+            id: forceDoubleSpendCheckBox
+            text: qsTr("Allow double spending (demo)")
+            ToolTip.visible: hovered
+            ToolTip.text: qsTr("Send the credential to the service provider even if it is known to be spent, to see the double spending being detected")
+        }
+
         Button {
             text: "Confirm"
             onClicked: {
                 if (credentialList.currentItem != null && spComboBox.displayText != spComboBox.defaultText) {
-                    QmlBridge.spendCredential(spComboBox.currentText, credentialList.currentItem.sequence, spendCredentialIndicator, mainColumn)
+                    trackJob(spendCredentialIndicator, QmlBridge.spendCredential(spComboBox.currentText, credentialList.currentItem.sequence, forceDoubleSpendCheckBox.checked))
                 }
             }
         }
 
         BusyIndicator {
             id: spendCredentialIndicator
-            running: false
+            property int jobId: -1
+            running: jobId >= 0
             width: 60
             Layout.preferredHeight: 50
             Layout.preferredWidth: 50
         }
     }
+
+    JobListModel {
+        id: jobListModel
+    }
+
+    GroupBox {
+        id: jobsBox
+        Layout.fillWidth: true
+        Layout.minimumHeight: 150
+        Layout.preferredHeight: 150
+        Layout.maximumHeight: 250
+        title: qsTr("Operations (%1 active)").arg(QmlBridge.activeJobs)
+
+        ScrollView {
+            anchors.fill: parent
+            anchors.topMargin: 5
+            anchors.bottomMargin: 5
+
+            ListView {
+                id: jobList
+                anchors.fill: parent
+                clip: true
+
+                model: jobListModel
+
+                delegate: Item {
+                    x: 5
+                    width: jobList.width
+                    height: 40
+
+                    Row {
+                        spacing: 10
+                        anchors.verticalCenter: parent.verticalCenter
+
+                        Label {
+                            anchors.verticalCenter: parent.verticalCenter
+                            text: "#" + JobID + " " + Name
+                            font.weight: Font.DemiBold
+                        }
+                        Label {
+                            anchors.verticalCenter: parent.verticalCenter
+                            font.weight: Font.Black
+                            text: State.toUpperCase()
+                            color: State == "failed" ? "orangered" : (State == "succeeded" ? "limegreen" : "steelblue")
+                        }
+                        Text {
+                            anchors.verticalCenter: parent.verticalCenter
+                            text: Error != "" ? Error : Stage
+                            elide: Text.ElideRight
+                            width: 400
+                        }
+                        Button {
+                            visible: Active
+                            text: qsTr("Cancel")
+                            onClicked: QmlBridge.cancelOperation(JobID)
+                        }
+                    }
+                }
+            }
+        }
+    }
+
+    CredentialPool {
+        id: credentialPool
+    }
+
+    TransactionHistory {
+        id: transactionHistory
+    }
+
+    LogViewer {
+        id: logViewer
+    }
+
+    Dialog {
+        id: newSecretDialog
+        parent: ApplicationWindow.contentItem
+        anchors.centerIn: ApplicationWindow.contentItem
+
+        width: Math.min(ApplicationWindow.contentItem.width * 2/3, 800)
+
+        modal: true
+
+        closePolicy: Popup.NoAutoClose
+        title: qsTr("No long-term secret in the wallet")
+
+        ColumnLayout {
+            width: newSecretDialog.availableWidth
+
+            Label {
+                Layout.fillWidth: true
+                wrapMode: Label.WordWrap
+                text: qsTr("Your wallet does not contain a long-term secret required to obtain credentials.\nYou can either generate a fresh one, import the secret exported from another wallet or derive it from the seed phrase of the account.")
+            }
+
+            TextField {
+                id: importedSecretField
+                Layout.fillWidth: true
+                echoMode: TextInput.Password
+                placeholderText: qsTr("hex-encoded secret or seed phrase to import")
+            }
+
+            RowLayout {
+                Layout.alignment: Qt.AlignRight
+
+                Button {
+                    text: qsTr("Generate new")
+                    onClicked: {
+                        if (QmlBridge.generateSecret()) {
+                            newSecretDialog.close()
+                        }
+                    }
+                }
+
+                Button {
+                    text: qsTr("Import")
+                    enabled: importedSecretField.text != ""
+                    onClicked: {
+                        if (QmlBridge.importSecret(importedSecretField.text)) {
+                            importedSecretField.text = ""
+                            newSecretDialog.close()
+                        }
+                    }
+                }
+
+                Button {
+                    text: qsTr("From seed phrase")
+                    enabled: importedSecretField.text != ""
+                    onClicked: {
+                        if (QmlBridge.importMnemonic(importedSecretField.text)) {
+                            importedSecretField.text = ""
+                            newSecretDialog.close()
+                        }
+                    }
+                }
+            }
+        }
+    }
+
+    Dialog {
+        id: exportSecretDialog
+        parent: ApplicationWindow.contentItem
+        anchors.centerIn: ApplicationWindow.contentItem
+
+        width: Math.min(ApplicationWindow.contentItem.width * 2/3, 800)
+
+        modal: true
+
+        closePolicy: Popup.CloseOnEscape
+        standardButtons: Dialog.Ok
+        title: qsTr("Long-term secret")
+
+        ColumnLayout {
+            width: exportSecretDialog.availableWidth
+
+            Label {
+                Layout.fillWidth: true
+                wrapMode: Label.WordWrap
+                text: qsTr("Anyone knowing this secret can spend your credentials. Store it somewhere safe.")
+            }
+
+            TextField {
+                id: exportedSecretField
+                Layout.fillWidth: true
+                readOnly: true
+                selectByMouse: true
+            }
+        }
+
+        onClosed: exportedSecretField.text = ""
+    }
+
+    QtLabs.FileDialog {
+        id: exportBackupFileDialog
+        fileMode: QtLabs.FileDialog.SaveFile
+        defaultSuffix: "nymbackup"
+        nameFilters: [ "Wallet backups (*.nymbackup)", "All files (*)" ]
+        onAccepted: exportBackupDialog.open()
+    }
+
+    Dialog {
+        id: exportBackupDialog
+        parent: ApplicationWindow.contentItem
+        anchors.centerIn: ApplicationWindow.contentItem
+
+        width: Math.min(ApplicationWindow.contentItem.width * 2/3, 800)
+
+        modal: true
+
+        closePolicy: Popup.CloseOnEscape
+        standardButtons: Dialog.Ok | Dialog.Cancel
+        title: qsTr("Export backup")
+
+        ColumnLayout {
+            width: exportBackupDialog.availableWidth
+
+            Label {
+                Layout.fillWidth: true
+                wrapMode: Label.WordWrap
+                text: qsTr("The backup contains the config, the account key, the long-term secret, all the credentials and the transaction history. It will be encrypted with the passphrase of the wallet.")
+            }
+
+            TextField {
+                id: exportBackupPassphraseField
+                Layout.fillWidth: true
+                echoMode: TextInput.Password
+                placeholderText: qsTr("wallet passphrase")
+                onAccepted: exportBackupDialog.accept()
+            }
+        }
+
+        onAccepted: QmlBridge.exportBackup(exportBackupFileDialog.file, exportBackupPassphraseField.text)
+        onClosed: exportBackupPassphraseField.clear()
+    }
+
+    Dialog {
+        id: unlockDialog
+        parent: ApplicationWindow.contentItem
+        anchors.centerIn: ApplicationWindow.contentItem
+
+        width: Math.min(ApplicationWindow.contentItem.width * 2/3, 800)
+
+        modal: true
+
+        closePolicy: Popup.NoAutoClose
+        title: qsTr("Wallet locked")
+
+        ColumnLayout {
+            width: unlockDialog.availableWidth
+
+            Label {
+                Layout.fillWidth: true
+                wrapMode: Label.WordWrap
+                text: qsTr("The wallet was locked and all its secrets were removed from memory. Please enter the passphrase to unlock it.")
+            }
+
+            TextField {
+                id: unlockPassphraseField
+                Layout.fillWidth: true
+                echoMode: TextInput.Password
+                placeholderText: qsTr("passphrase")
+                onAccepted: unlockButton.clicked()
+            }
+
+            Button {
+                id: unlockButton
+                Layout.alignment: Qt.AlignRight
+                text: qsTr("Unlock")
+                onClicked: {
+                    if (QmlBridge.unlockWallet(unlockPassphraseField.text)) {
+                        unlockDialog.close()
+                    }
+                    unlockPassphraseField.clear()
+                }
+            }
+        }
+    }
+
+    Dialog {
+        id: encryptKeyDialog
+        parent: ApplicationWindow.contentItem
+        anchors.centerIn: ApplicationWindow.contentItem
+
+        width: Math.min(ApplicationWindow.contentItem.width * 2/3, 800)
+
+        modal: true
+
+        closePolicy: Popup.CloseOnEscape
+        standardButtons: Dialog.Ok | Dialog.Cancel
+        title: qsTr("Encrypt account key")
+
+        ColumnLayout {
+            width: encryptKeyDialog.availableWidth
+
+            Label {
+                Layout.fillWidth: true
+                wrapMode: Label.WordWrap
+                text: qsTr("The account key is stored unencrypted. It will be replaced by a keystore file encrypted with the passphrase of the wallet, which will then be required to unlock the account.")
+            }
+
+            TextField {
+                id: encryptKeyPassphraseField
+                Layout.fillWidth: true
+                echoMode: TextInput.Password
+                placeholderText: qsTr("wallet passphrase")
+                onAccepted: encryptKeyDialog.accept()
+            }
+        }
+
+        onAccepted: QmlBridge.encryptAccountKey(encryptKeyPassphraseField.text)
+        onClosed: encryptKeyPassphraseField.clear()
+    }
+
+    Dialog {
+        id: changePassphraseDialog
+        parent: ApplicationWindow.contentItem
+        anchors.centerIn: ApplicationWindow.contentItem
+
+        width: Math.min(ApplicationWindow.contentItem.width * 2/3, 800)
+
+        modal: true
+
+        closePolicy: Popup.CloseOnEscape
+        title: qsTr("Change passphrase")
+
+        ColumnLayout {
+            width: changePassphraseDialog.availableWidth
+
+            Label {
+                Layout.fillWidth: true
+                wrapMode: Label.WordWrap
+                text: qsTr("The new passphrase will protect both the wallet and the account key.")
+            }
+
+            TextField {
+                id: oldPassphraseField
+                Layout.fillWidth: true
+                echoMode: TextInput.Password
+                placeholderText: qsTr("current passphrase")
+            }
+
+            TextField {
+                id: newPassphraseField
+                Layout.fillWidth: true
+                echoMode: TextInput.Password
+                placeholderText: qsTr("new passphrase")
+            }
+
+            TextField {
+                id: confirmPassphraseField
+                Layout.fillWidth: true
+                echoMode: TextInput.Password
+                placeholderText: qsTr("repeat the new passphrase")
+            }
+
+            Label {
+                visible: confirmPassphraseField.text != "" && confirmPassphraseField.text != newPassphraseField.text
+                text: qsTr("The passphrases do not match")
+                color: "orangered"
+            }
+
+            RowLayout {
+                Layout.alignment: Qt.AlignRight
+
+                Button {
+                    text: qsTr("Cancel")
+                    onClicked: changePassphraseDialog.close()
+                }
+
+                Button {
+                    text: qsTr("Change")
+                    enabled: newPassphraseField.text != "" && newPassphraseField.text == confirmPassphraseField.text
+                    onClicked: {
+                        if (QmlBridge.changePassphrase(oldPassphraseField.text, newPassphraseField.text)) {
+                            changePassphraseDialog.close()
+                        }
+                    }
+                }
+            }
+        }
+
+        onClosed: {
+            oldPassphraseField.clear()
+            newPassphraseField.clear()
+            confirmPassphraseField.clear()
+        }
+    }
+
     Connections {
         target: QmlBridge
         onUpdateERC20NymBalance: {
@@ -560,23 +1063,54 @@ ColumnLayout {
             spComboBox.model = sps
         }
 
+        onAccountSwitched: {
+            credentialListModel.clear()
+            erc20BalanceField.text = ""
+            erc20BalancePendingField.text = ""
+            nymTokenBalanceField.text = ""
+        }
+
         onAddCredentialListItem: {
             credentialListModel.addItem(item)
         }
 
-        onMarkSpentCredential: {
-            credentialList.currentItem.isSpent = true
+        onCredentialStateChanged: {
+            credentialListModel.setState(sequence, state)
         }
 
         onSetAccountStatus: {
             accountStatusLabel.accountExists = accountExists
         }
+
+        onShowNewSecretDialog: {
+            newSecretDialog.open()
+        }
+
+        onLockedChanged: {
+            if (QmlBridge.locked) {
+                unlockDialog.open()
+            } else {
+                unlockDialog.close()
+            }
+        }
+
+        onJobUpdated: {
+            jobListModel.updateItem(item)
+        }
+
+        onJobFinished: {
+            for (var i = 0; i < jobIndicators.length; i++) {
+                if (jobIndicators[i].jobId == id) {
+                    jobIndicators[i].jobId = -1
+                }
+            }
+        }
     }
 
     onVisibleChanged: {
         if (visible) {
             // basically update balance when component is being displayed
-            QmlBridge.forceUpdateBalances(balanceUpdateIndicator, mainColumn)
+            trackJob(balanceUpdateIndicator, QmlBridge.forceUpdateBalances())
         }
     }
 }
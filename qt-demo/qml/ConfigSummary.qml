@@ -282,26 +282,189 @@ ColumnLayout {
         parent: ApplicationWindow.contentItem
         anchors.centerIn: ApplicationWindow.contentItem
 
-        height: 200
         width: Math.min(ApplicationWindow.contentItem.width * 2/3, 800)
 
+        property bool fileExists: false
+
         modal: true
 
-        closePolicy: Popup.NoAutoClose	
-        standardButtons: Dialog.Ok | Dialog.Close	
+        closePolicy: Popup.NoAutoClose
         title: qsTr("No compatible key detected")
 
-        Label {
-			wrapMode: Label.WordWrap
-			// wrapMode: Label.WrapAnywhere
-            text: qsTr("The keyfile specified by your configuration file could not be loaded - was its path specified correctly?\nDo you want to generate a fresh keypair and save it to the the specified location? If rejected the application will be terminated.")
-
+        ColumnLayout {
             width: newKeyDialog.availableWidth
-			height: newKeyDialog.availableHeight
+
+            Label {
+                Layout.fillWidth: true
+                wrapMode: Label.WordWrap
+                text: newKeyDialog.fileExists
+                    ? qsTr("The keyfile specified by your configuration file exists, but it could not be loaded - is it a valid key?\nDo you want to move it to a timestamped backup and create a fresh keypair in its place, or import an existing one? If rejected the application will be terminated.")
+                    : qsTr("The keyfile specified by your configuration file could not be loaded - was its path specified correctly?\nDo you want to create a fresh keypair and save it to the the specified location, or import an existing one? If rejected the application will be terminated.")
+            }
+
+            RowLayout {
+                Layout.fillWidth: true
+
+                ComboBox {
+                    id: keySourceBox
+                    Layout.preferredWidth: 200
+                    textRole: "text"
+                    model: [
+                        { text: qsTr("Seed phrase"), source: "mnemonic" },
+                        { text: qsTr("Hex private key"), source: "hex" },
+                        { text: qsTr("Keystore file"), source: "keystore" }
+                    ]
+                    onActivated: importedKeyField.clear()
+                }
+
+                Button {
+                    text: qsTr("Browse...")
+                    visible: keySourceBox.currentIndex == 2
+                    onClicked: keyFileDialog.open()
+                }
+            }
+
+            TextArea {
+                id: importedKeyField
+                Layout.fillWidth: true
+                wrapMode: TextEdit.Wrap
+                placeholderText: [qsTr("seed phrase to restore the key from"), qsTr("hex-encoded private key"), qsTr("path to the key file")][keySourceBox.currentIndex]
+            }
+
+            TextField {
+                id: importedKeyPassphraseField
+                Layout.fillWidth: true
+                visible: keySourceBox.currentIndex == 2
+                echoMode: TextInput.Password
+                placeholderText: qsTr("passphrase of the keystore file (use the same one for your wallet)")
+            }
+
+            RowLayout {
+                Layout.alignment: Qt.AlignRight
+
+                Button {
+                    text: qsTr("Quit")
+                    onClicked: Qt.quit()
+                }
+
+                Button {
+                    text: qsTr("Import")
+                    enabled: importedKeyField.text != ""
+                    onClicked: {
+                        var source = keySourceBox.model[keySourceBox.currentIndex].source
+                        if (QmlBridge.importKey(source, importedKeyField.text, importedKeyPassphraseField.text, newKeyDialog.fileExists)) {
+                            importedKeyField.clear()
+                            importedKeyPassphraseField.clear()
+                            newKeyDialog.close()
+                        }
+                    }
+                }
+
+                Button {
+                    text: qsTr("Create new")
+                    onClicked: {
+                        if (QmlBridge.createKey(newKeyDialog.fileExists)) {
+                            newKeyDialog.close()
+                        }
+                    }
+                }
+            }
         }
+    }
 
-        onAccepted: QmlBridge.generateNewKey()
-        onRejected: Qt.quit()
+    QtLabs.FileDialog {
+        id: keyFileDialog
+        nameFilters: [ "Key files (*.key *.json)", "All files (*)" ]
+        onAccepted: importedKeyField.text = keyFileDialog.file
+    }
+
+    Dialog {
+        id: keyBackupDialog
+        parent: ApplicationWindow.contentItem
+        anchors.centerIn: ApplicationWindow.contentItem
+
+        width: Math.min(ApplicationWindow.contentItem.width * 2/3, 800)
+
+        property string address: ""
+        property string keyfile: ""
+        property string backup: ""
+        property string phrase: ""
+
+        modal: true
+
+        closePolicy: Popup.NoAutoClose
+        title: qsTr("Back up your new key")
+
+        ColumnLayout {
+            width: keyBackupDialog.availableWidth
+
+            Label {
+                Layout.fillWidth: true
+                wrapMode: Label.WordWrap
+                text: keyBackupDialog.phrase != ""
+                    ? qsTr("A fresh key was generated. Losing it means losing all the funds of its account. Write down the seed phrase below and keep it somewhere safe - both the key and the long-term secret of the wallet can be restored from it.")
+                    : qsTr("The key was imported. Losing it means losing all the funds of its account, so make sure you keep its backup somewhere safe.")
+            }
+
+            TextArea {
+                Layout.fillWidth: true
+                visible: keyBackupDialog.phrase != ""
+                readOnly: true
+                selectByMouse: true
+                wrapMode: TextEdit.Wrap
+                font.weight: Font.DemiBold
+                text: keyBackupDialog.phrase
+            }
+
+            Label {
+                text: qsTr("Address:")
+                font.weight: Font.DemiBold
+            }
+
+            TextField {
+                Layout.fillWidth: true
+                readOnly: true
+                selectByMouse: true
+                text: keyBackupDialog.address
+            }
+
+            Label {
+                text: qsTr("Key file:")
+                font.weight: Font.DemiBold
+            }
+
+            TextField {
+                Layout.fillWidth: true
+                readOnly: true
+                selectByMouse: true
+                text: keyBackupDialog.keyfile
+            }
+
+            Label {
+                Layout.fillWidth: true
+                visible: keyBackupDialog.backup != ""
+                wrapMode: Label.WordWrap
+                text: qsTr("The previous key file was moved to ") + keyBackupDialog.backup
+                      + qsTr(". Its wallet, if any, was backed up next to it and is not used with the new key.")
+            }
+
+            CheckBox {
+                id: keyBackedUpCheckBox
+                text: keyBackupDialog.phrase != "" ? qsTr("I have written down the seed phrase") : qsTr("I have a backup of the key")
+            }
+
+            Button {
+                Layout.alignment: Qt.AlignRight
+                text: qsTr("Continue")
+                enabled: keyBackedUpCheckBox.checked
+                onClicked: {
+                    QmlBridge.confirmKeyBackup()
+                    keyBackedUpCheckBox.checked = false
+                    keyBackupDialog.phrase = ""
+                    keyBackupDialog.close()
+                }
+            }
+        }
     }
 
 
@@ -316,8 +479,17 @@ ColumnLayout {
         }
 
         onShowNewKeyDialog: {
+            newKeyDialog.fileExists = fileExists
             newKeyDialog.open()
         }
+
+        onShowKeyBackupDialog: {
+            keyBackupDialog.address = address
+            keyBackupDialog.keyfile = keyfile
+            keyBackupDialog.backup = backup
+            keyBackupDialog.phrase = phrase
+            keyBackupDialog.open()
+        }
     }
 
 }
\ No newline at end of file
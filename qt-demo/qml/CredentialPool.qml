@@ -0,0 +1,156 @@
+// CredentialPool.qml - automatic replenishment of the unspent credentials
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+import QtQuick 2.12
+import QtQuick.Controls 2.5
+import QtQuick.Layouts 1.12
+import QtQuick.Controls.Material 2.12
+
+GroupBox {
+    id: poolBox
+    Layout.fillWidth: true
+    title: qsTr("Credential Pool")
+
+    // targets in the <value>:<target>:<threshold> format, by the credential value
+    property var targets: ({})
+
+    function targetList() {
+        var list = []
+        for (var value in targets) {
+            list.push(targets[value])
+        }
+        return list
+    }
+
+    ColumnLayout {
+        anchors.fill: parent
+        spacing: 5
+
+        Label {
+            Layout.fillWidth: true
+            wrapMode: Label.WordWrap
+            text: qsTr("Keeps the given number of unspent credentials of each value. Once their number drops to the threshold, new credentials are obtained, spending at most the budget in total.")
+        }
+
+        RowLayout {
+            spacing: 10
+            enabled: !QmlBridge.poolRunning
+
+            ComboBox {
+                id: poolValueBox
+                Layout.preferredWidth: 120
+            }
+
+            Label {
+                text: qsTr("target:")
+                font.weight: Font.DemiBold
+            }
+
+            SpinBox {
+                id: poolTargetBox
+                from: 1
+                to: 100
+                value: 5
+                editable: true
+            }
+
+            Label {
+                text: qsTr("threshold:")
+                font.weight: Font.DemiBold
+            }
+
+            SpinBox {
+                id: poolThresholdBox
+                from: 0
+                to: poolTargetBox.value - 1
+                value: 1
+                editable: true
+            }
+
+            Button {
+                text: qsTr("Set")
+                enabled: poolValueBox.currentIndex >= 0
+                onClicked: {
+                    var value = poolValueBox.currentText.replace("Nym", "")
+                    var updated = Object.assign({}, poolBox.targets)
+                    updated[value] = value + ":" + poolTargetBox.value + ":" + poolThresholdBox.value
+                    poolBox.targets = updated
+                }
+            }
+
+            Button {
+                text: qsTr("Remove")
+                enabled: poolValueBox.currentIndex >= 0
+                onClicked: {
+                    var updated = Object.assign({}, poolBox.targets)
+                    delete updated[poolValueBox.currentText.replace("Nym", "")]
+                    poolBox.targets = updated
+                }
+            }
+        }
+
+        Label {
+            text: targetList().length > 0 ? qsTr("Targets (value:target:threshold): ") + targetList().join(", ") : qsTr("No targets are set")
+        }
+
+        RowLayout {
+            spacing: 10
+
+            Label {
+                text: qsTr("budget:")
+                font.weight: Font.DemiBold
+            }
+
+            TextField {
+                id: poolBudgetField
+                enabled: !QmlBridge.poolRunning
+                Layout.preferredWidth: 120
+                placeholderText: qsTr("Nym")
+                validator: IntValidator { bottom: 1 }
+            }
+
+            Button {
+                text: QmlBridge.poolRunning ? qsTr("Stop") : qsTr("Start")
+                enabled: QmlBridge.poolRunning || (poolBudgetField.acceptableInput && targetList().length > 0)
+                onClicked: {
+                    if (QmlBridge.poolRunning) {
+                        QmlBridge.stopCredentialPool()
+                    } else {
+                        QmlBridge.startCredentialPool(targetList(), poolBudgetField.text)
+                    }
+                }
+            }
+        }
+
+        Label {
+            Layout.fillWidth: true
+            wrapMode: Label.WordWrap
+            text: QmlBridge.poolStatus
+        }
+    }
+
+    Connections {
+        target: QmlBridge
+
+        onPopulateValueComboBox: {
+            poolValueBox.model = values
+        }
+
+        onAccountSwitched: {
+            poolBox.targets = {}
+        }
+    }
+}
@@ -0,0 +1,125 @@
+// LogViewer.qml - tail of the most recent log records
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+import QtQuick 2.12
+import QtQuick.Controls 2.5
+import QtQuick.Layouts 1.12
+import QtQuick.Controls.Material 2.12
+import CustomQmlTypes 1.0
+
+GroupBox {
+    id: logBox
+    Layout.fillWidth: true
+    Layout.minimumHeight: 200
+    Layout.preferredHeight: 250
+    Layout.maximumHeight: 400
+    title: qsTr("Log")
+
+    LogListModel {
+        id: logListModel
+    }
+
+    function levelColor(level) {
+        switch (level) {
+        case "CRITICAL":
+        case "ERROR":
+            return "orangered"
+        case "WARNING":
+            return "orange"
+        case "DEBUG":
+            return "grey"
+        default:
+            return Material.foreground
+        }
+    }
+
+    ColumnLayout {
+        anchors.fill: parent
+        spacing: 5
+
+        RowLayout {
+            spacing: 15
+
+            CheckBox {
+                id: followCheckBox
+                text: qsTr("Follow")
+                checked: true
+            }
+
+            Button {
+                text: qsTr("Clear")
+                onClicked: logListModel.clear()
+            }
+        }
+
+        ScrollView {
+            Layout.fillWidth: true
+            Layout.fillHeight: true
+
+            ListView {
+                id: logList
+                anchors.fill: parent
+                clip: true
+
+                model: logListModel
+
+                onCountChanged: {
+                    if (followCheckBox.checked) {
+                        positionViewAtEnd()
+                    }
+                }
+
+                delegate: Row {
+                    x: 5
+                    spacing: 10
+
+                    Text {
+                        text: Time
+                        font.family: "monospace"
+                    }
+                    Label {
+                        text: Level
+                        width: 70
+                        font.weight: Font.DemiBold
+                        color: levelColor(Level)
+                    }
+                    Label {
+                        text: Module
+                        width: 80
+                    }
+                    Text {
+                        text: Message
+                    }
+                    Text {
+                        visible: Fields != ""
+                        text: Fields
+                        color: "grey"
+                    }
+                }
+            }
+        }
+    }
+
+    Connections {
+        target: QmlBridge
+
+        onAddLogListItem: {
+            logListModel.addItem(item)
+        }
+    }
+
+    Component.onCompleted: QmlBridge.followLog()
+}
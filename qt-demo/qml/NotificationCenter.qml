@@ -0,0 +1,154 @@
+// NotificationCenter.qml - list of the notifications that were not yet dismissed
+// Copyright (C) 2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+import QtQuick 2.12
+import QtQuick.Controls 2.5
+import QtQuick.Layouts 1.12
+import QtQuick.Controls.Material 2.12
+import CustomQmlTypes 1.0
+
+Button {
+    id: notificationsBtn
+    text: qsTr("Notifications (%1)").arg(QmlBridge.notificationCount)
+    highlighted: QmlBridge.notificationCount > 0
+    onClicked: notificationDrawer.open()
+
+    NotificationListModel {
+        id: notificationListModel
+    }
+
+    function severityColor(severity) {
+        switch (severity) {
+        case "critical":
+        case "error":
+            return "orangered"
+        case "warning":
+            return "orange"
+        default:
+            return "limegreen"
+        }
+    }
+
+    Drawer {
+        id: notificationDrawer
+        parent: ApplicationWindow.contentItem
+        edge: Qt.RightEdge
+        width: Math.min(ApplicationWindow.contentItem.width * 2/3, 600)
+        height: ApplicationWindow.contentItem.height
+
+        ColumnLayout {
+            anchors.fill: parent
+            anchors.margins: 10
+            spacing: 5
+
+            RowLayout {
+                Label {
+                    Layout.fillWidth: true
+                    text: qsTr("Notifications")
+                    font.weight: Font.DemiBold
+                    font.pointSize: 12
+                }
+
+                Button {
+                    text: qsTr("Dismiss all")
+                    enabled: QmlBridge.notificationCount > 0
+                    onClicked: QmlBridge.dismissAllNotifications()
+                }
+            }
+
+            Label {
+                visible: QmlBridge.notificationCount == 0
+                text: qsTr("There are no notifications")
+            }
+
+            ScrollView {
+                Layout.fillWidth: true
+                Layout.fillHeight: true
+
+                ListView {
+                    id: notificationList
+                    anchors.fill: parent
+                    clip: true
+                    spacing: 10
+
+                    model: notificationListModel
+
+                    delegate: RowLayout {
+                        width: notificationList.width
+
+                        Rectangle {
+                            Layout.fillHeight: true
+                            width: 4
+                            color: severityColor(Severity)
+                        }
+
+                        ColumnLayout {
+                            Layout.fillWidth: true
+
+                            RowLayout {
+                                Label {
+                                    text: Title
+                                    font.weight: Font.DemiBold
+                                }
+                                Label {
+                                    visible: Category != ""
+                                    text: "(" + Category + ")"
+                                    color: severityColor(Severity)
+                                }
+                                Label {
+                                    visible: Count > 1
+                                    text: qsTr("(%1 times)").arg(Count)
+                                }
+                                Text {
+                                    text: Time
+                                    color: "grey"
+                                }
+                            }
+
+                            Label {
+                                Layout.fillWidth: true
+                                text: Message
+                                wrapMode: Label.WordWrap
+                            }
+                        }
+
+                        Button {
+                            text: qsTr("Dismiss")
+                            flat: true
+                            onClicked: QmlBridge.dismissNotification(NotificationID)
+                        }
+                    }
+                }
+            }
+        }
+    }
+
+    Connections {
+        target: QmlBridge
+
+        onNotificationUpdated: {
+            notificationListModel.updateItem(item)
+        }
+
+        onNotificationRemoved: {
+            notificationListModel.removeItem(id)
+        }
+
+        onNotificationsCleared: {
+            notificationListModel.clear()
+        }
+    }
+}
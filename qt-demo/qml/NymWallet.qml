@@ -44,6 +44,11 @@ Flickable {
             font.pointSize: 16
         }
 
+        NotificationCenter {
+            Layout.alignment: Qt.AlignRight
+            Layout.rightMargin: 30
+        }
+
         // I guess rather than 'visible' trick, a proper loader should have been used?
 		ColumnLayout {
 			id: accountFull
@@ -60,7 +65,7 @@ Flickable {
             Layout.topMargin: 10
 
 			ClientAccount {
-
+				id: clientAccount
 			}
 		}
 		
@@ -89,6 +94,10 @@ Flickable {
 					text: "open config"
 					onClicked: fileDialog.open();
 				}
+				Button {
+					text: "restore backup"
+					onClicked: restoreBackupDialog.open();
+				}
 			}
 
 			ConfigSummary{
@@ -111,9 +120,8 @@ Flickable {
 					Layout.fillHeight: false
 					Layout.fillWidth: false
 					onClicked: {
-						QmlBridge.confirmConfig()
-						configFull.visible = false
-						accountFull.visible = true
+						walletPassphraseDialog.create = !QmlBridge.walletExists("")
+						walletPassphraseDialog.open()
 					}
 				}
 			}
@@ -171,6 +179,197 @@ Flickable {
         onRejected: console.log("Cancel clicked")
     }
 
+    Dialog {
+        id: walletPassphraseDialog
+        parent: ApplicationWindow.contentItem
+        anchors.centerIn: ApplicationWindow.contentItem
+
+        width: Math.min(ApplicationWindow.contentItem.width * 2/3, 800)
+
+        // set if the wallet does not exist yet
+        property bool create: false
+
+        modal: true
+
+        closePolicy: Popup.CloseOnEscape
+        title: create ? qsTr("Create wallet") : qsTr("Unlock wallet")
+
+        ColumnLayout {
+            width: walletPassphraseDialog.availableWidth
+
+            Label {
+                Layout.fillWidth: true
+                wrapMode: Label.WordWrap
+                text: walletPassphraseDialog.create
+                    ? qsTr("The credential wallet does not exist yet. Please choose the passphrase it will be encrypted with.\nThe passphrase can't be recovered - if you lose it, all the credentials in the wallet will be lost as well.")
+                    : qsTr("Please enter the passphrase protecting your credential wallet.")
+            }
+
+            TextField {
+                id: walletPassphraseField
+                Layout.fillWidth: true
+                echoMode: TextInput.Password
+                placeholderText: qsTr("passphrase")
+                onAccepted: {
+                    if (walletPassphraseDialog.create) {
+                        walletPassphraseConfirmField.forceActiveFocus()
+                    } else {
+                        walletPassphraseDialog.accept()
+                    }
+                }
+            }
+
+            TextField {
+                id: walletPassphraseConfirmField
+                visible: walletPassphraseDialog.create
+                Layout.fillWidth: true
+                echoMode: TextInput.Password
+                placeholderText: qsTr("repeat the passphrase")
+                onAccepted: {
+                    if (walletPassphraseOkBtn.enabled) {
+                        walletPassphraseDialog.accept()
+                    }
+                }
+            }
+
+            Label {
+                visible: walletPassphraseDialog.create && walletPassphraseConfirmField.text != "" && walletPassphraseConfirmField.text != walletPassphraseField.text
+                text: qsTr("The passphrases do not match")
+                color: "orangered"
+            }
+
+            RowLayout {
+                Layout.alignment: Qt.AlignRight
+
+                Button {
+                    text: qsTr("Cancel")
+                    onClicked: walletPassphraseDialog.reject()
+                }
+
+                Button {
+                    id: walletPassphraseOkBtn
+                    text: walletPassphraseDialog.create ? qsTr("Create") : qsTr("Unlock")
+                    enabled: !walletPassphraseDialog.create || (walletPassphraseField.text != "" && walletPassphraseField.text == walletPassphraseConfirmField.text)
+                    onClicked: walletPassphraseDialog.accept()
+                }
+            }
+        }
+
+        onAccepted: {
+            var opened = create
+                ? QmlBridge.createWallet("", walletPassphraseField.text, walletPassphraseConfirmField.text)
+                : QmlBridge.confirmConfig(walletPassphraseField.text)
+            if (opened) {
+                configFull.visible = false
+                accountFull.visible = true
+            }
+            clearPassphrases()
+        }
+        onRejected: clearPassphrases()
+
+        function clearPassphrases() {
+            walletPassphraseField.clear()
+            walletPassphraseConfirmField.clear()
+        }
+    }
+
+    QtLabs.FileDialog {
+        id: backupFileDialog
+        nameFilters: [ "Wallet backups (*.nymbackup)", "All files (*)" ]
+        onAccepted: backupFileField.text = backupFileDialog.file
+    }
+
+    QtLabs.FileDialog {
+        id: restoredConfigDialog
+        fileMode: QtLabs.FileDialog.SaveFile
+        nameFilters: [ "Config files (*.toml)", "All files (*)" ]
+        onAccepted: restoredConfigField.text = restoredConfigDialog.file
+    }
+
+    Dialog {
+        id: restoreBackupDialog
+        parent: ApplicationWindow.contentItem
+        anchors.centerIn: ApplicationWindow.contentItem
+
+        width: Math.min(ApplicationWindow.contentItem.width * 2/3, 800)
+
+        modal: true
+
+        closePolicy: Popup.CloseOnEscape
+        title: qsTr("Restore wallet backup")
+
+        ColumnLayout {
+            width: restoreBackupDialog.availableWidth
+
+            Label {
+                Layout.fillWidth: true
+                wrapMode: Label.WordWrap
+                text: qsTr("The config contained in the backup will be saved to the chosen location, while the account key and the wallet will be restored to the locations specified by it. None of the files may already exist.")
+            }
+
+            RowLayout {
+                Layout.fillWidth: true
+
+                TextField {
+                    id: backupFileField
+                    Layout.fillWidth: true
+                    placeholderText: qsTr("backup file")
+                }
+
+                Button {
+                    text: qsTr("Browse...")
+                    onClicked: backupFileDialog.open()
+                }
+            }
+
+            RowLayout {
+                Layout.fillWidth: true
+
+                TextField {
+                    id: restoredConfigField
+                    Layout.fillWidth: true
+                    placeholderText: qsTr("where to save the restored config")
+                }
+
+                Button {
+                    text: qsTr("Browse...")
+                    onClicked: restoredConfigDialog.open()
+                }
+            }
+
+            TextField {
+                id: backupPassphraseField
+                Layout.fillWidth: true
+                echoMode: TextInput.Password
+                placeholderText: qsTr("passphrase of the backed up wallet")
+            }
+
+            RowLayout {
+                Layout.alignment: Qt.AlignRight
+
+                Button {
+                    text: qsTr("Cancel")
+                    onClicked: restoreBackupDialog.close()
+                }
+
+                Button {
+                    text: qsTr("Restore")
+                    enabled: backupFileField.text != "" && restoredConfigField.text != ""
+                    onClicked: {
+                        if (QmlBridge.restoreBackup(backupFileField.text, restoredConfigField.text, backupPassphraseField.text)) {
+                            configConfirmBtn.enabled = true
+                            configView.opacity = 1
+                            path.text = restoredConfigField.text
+                            restoreBackupDialog.close()
+                        }
+                    }
+                }
+            }
+        }
+
+        onClosed: backupPassphraseField.clear()
+    }
+
     Connections {
         target: QmlBridge
         onDisplayNotification: {
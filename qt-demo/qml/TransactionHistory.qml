@@ -0,0 +1,172 @@
+// TransactionHistory.qml - ledger of all operations performed with the wallet
+// Copyright (C) 2018-2019  Jedrzej Stuczynski.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+import QtQuick 2.12
+import QtQuick.Controls 2.5
+import QtQuick.Layouts 1.12
+import QtQuick.Controls.Material 2.12
+import CustomQmlTypes 1.0
+
+GroupBox {
+    id: historyBox
+    Layout.fillWidth: true
+    Layout.minimumHeight: 250
+    Layout.preferredHeight: 300
+    Layout.maximumHeight: 400
+    title: qsTr("Transaction History")
+
+    LedgerListModel {
+        id: ledgerListModel
+    }
+
+    function applyFilter() {
+        var opType = typeComboBox.currentIndex > 0 ? typeComboBox.currentText : ""
+        ledgerListModel.setFilter(opType, fromField.text, toField.text)
+    }
+
+    ColumnLayout {
+        anchors.fill: parent
+        spacing: 5
+
+        RowLayout {
+            spacing: 15
+
+            Label {
+                text: qsTr("Type:")
+                font.weight: Font.DemiBold
+            }
+
+            ComboBox {
+                id: typeComboBox
+                Layout.preferredWidth: 200
+                model: [qsTr("All")]
+                onActivated: applyFilter()
+            }
+
+            Label {
+                text: qsTr("From:")
+                font.weight: Font.DemiBold
+            }
+
+            TextField {
+                id: fromField
+                Layout.preferredWidth: 120
+                placeholderText: "YYYY-MM-DD"
+                onEditingFinished: applyFilter()
+            }
+
+            Label {
+                text: qsTr("To:")
+                font.weight: Font.DemiBold
+            }
+
+            TextField {
+                id: toField
+                Layout.preferredWidth: 120
+                placeholderText: "YYYY-MM-DD"
+                onEditingFinished: applyFilter()
+            }
+
+            Button {
+                text: qsTr("Clear")
+                onClicked: {
+                    typeComboBox.currentIndex = 0
+                    fromField.clear()
+                    toField.clear()
+                    applyFilter()
+                }
+            }
+        }
+
+        ScrollView {
+            Layout.fillWidth: true
+            Layout.fillHeight: true
+
+            ListView {
+                id: ledgerList
+                anchors.fill: parent
+                clip: true
+
+                model: ledgerListModel
+
+                delegate: Item {
+                    x: 5
+                    width: ledgerList.width
+                    height: EthereumTxs != "" ? 50 : 30
+
+                    Column {
+                        Row {
+                            spacing: 10
+
+                            Text {
+                                text: Time
+                            }
+                            Label {
+                                text: Type
+                                font.weight: Font.DemiBold
+                            }
+                            Text {
+                                visible: Amount != 0
+                                text: "(" + Amount + "Nym)"
+                            }
+                            Text {
+                                visible: Details != ""
+                                text: Details
+                            }
+                            Label {
+                                font.weight: Font.Black
+                                text: Success ? qsTr("OK") : qsTr("FAILED")
+                                color: Success ? "limegreen" : "orangered"
+                            }
+                            Label {
+                                visible: !Success && ErrorCategory != ""
+                                text: "(" + ErrorCategory + ")"
+                                color: "orangered"
+                            }
+                            Text {
+                                text: Success ? TendermintResult : Error
+                                elide: Text.ElideRight
+                                width: 300
+                            }
+                        }
+                        Text {
+                            visible: EthereumTxs != ""
+                            text: qsTr("Ethereum transactions: ") + EthereumTxs
+                            font.pointSize: 8
+                        }
+                    }
+                }
+            }
+        }
+    }
+
+    Connections {
+        target: QmlBridge
+
+        onAddLedgerListItem: {
+            ledgerListModel.addItem(item)
+        }
+
+        onAccountSwitched: {
+            ledgerListModel.clear()
+        }
+
+        onPopulateLedgerTypeComboBox: {
+            typeComboBox.model = [qsTr("All")].concat(types)
+            typeComboBox.currentIndex = 0
+        }
+    }
+}
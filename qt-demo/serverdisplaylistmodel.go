@@ -16,8 +16,6 @@
 package main
 
 import (
-	"fmt"
-
 	"github.com/therecipe/qt/core"
 )
 
@@ -86,7 +84,7 @@ func (m *ServerDisplayListModel) remove() {
 
 func (m *ServerDisplayListModel) add(item []*core.QVariant) {
 	if len(item) != 2 {
-		fmt.Println("trying to invalid element")
+		log.Warning("trying to add invalid element", "fields", len(item))
 		return
 	}
 	m.BeginInsertRows(core.NewQModelIndex(), len(m.modelData), len(m.modelData))